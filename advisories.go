@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// advisory is an updateinfo advisory that applies to a package.
+type advisory struct {
+	id, kind, severity, pkg string
+}
+
+// advisoryJSON is the JSON representation of an advisory.
+type advisoryJSON struct {
+	ID       string `json:"id"`
+	Kind     string `json:"kind"`
+	Severity string `json:"severity,omitempty"`
+	Package  string `json:"package"`
+}
+
+func (a advisory) MarshalJSON() ([]byte, error) {
+	return json.Marshal(advisoryJSON{a.id, a.kind, a.severity, a.pkg})
+}
+
+func (a *advisory) UnmarshalJSON(data []byte) error {
+	v := advisoryJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = advisory{id: v.ID, kind: v.Kind, severity: v.Severity, pkg: v.Package}
+	return nil
+}
+
+// advisoryRegex matches a line of yum updateinfo list.
+var advisoryRegex = regexp.MustCompile(`^(` + advisoryIDPattern + `)\s+(\S+)\s+(\S+)\s*$`)
+
+// advisoryCVERegex matches a line of yum updateinfo list cves.
+var advisoryCVERegex = regexp.MustCompile(`^\s*(CVE-\d{4}-\d{4,})\s+\S+\s+(\S+)\s*$`)
+
+// parseAdvisories parses the output of yum updateinfo list.
+func parseAdvisories(output []byte) []advisory {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	advisories := make([]advisory, 0)
+
+	for sc.Scan() {
+		matches := advisoryRegex.FindStringSubmatch(sc.Text())
+		if matches == nil {
+			continue
+		}
+
+		a := advisory{
+			id:   matches[1],
+			kind: matches[2],
+			pkg:  matches[3],
+		}
+		// security advisories are listed as Severity/Sec.
+		if strings.HasSuffix(a.kind, "/Sec.") {
+			a.severity = strings.TrimSuffix(a.kind, "/Sec.")
+			a.kind = "security"
+		}
+
+		advisories = append(advisories, a)
+	}
+
+	return advisories
+}
+
+// parseAdvisoryCVEs parses the CVEs of each package from the output
+// of yum updateinfo list cves.
+func parseAdvisoryCVEs(output []byte) map[string][]string {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	cves := map[string][]string{}
+
+	for sc.Scan() {
+		if m := advisoryCVERegex.FindStringSubmatch(sc.Text()); m != nil {
+			cves[m[2]] = append(cves[m[2]], m[1])
+		}
+	}
+
+	return cves
+}
+
+// buildYumUpdateInfoCommand returns the exec command that is used
+// to list the advisories of the available updates.
+func buildYumUpdateInfoCommand(config Config) *exec.Cmd {
+	cmd := defaultYumCommand()
+	cmd = append(cmd, "updateinfo", "list")
+	cmd = append(cmd, yumCacheArgs(config)...)
+	cmd = append(cmd, yumFilterArgs(config)...)
+	cmd = append(cmd, config.updatePackages...)
+	cmd = buildHostCommand(cmd)
+
+	return newCommand(cmd)
+}
+
+// listAdvisories returns the advisories of the available updates.
+func listAdvisories(config Config) ([]advisory, error) {
+	log.Infof("list advisories")
+
+	result := bytes.Buffer{}
+	cmd := buildYumUpdateInfoCommand(config)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("yum-updateinfo did not run successfully: %v", err)
+	}
+
+	return parseAdvisories(result.Bytes()), nil
+}
+
+// buildYumUpdateInfoCVEsCommand returns the exec command that is used
+// to list the CVEs of the available updates.
+func buildYumUpdateInfoCVEsCommand(config Config) *exec.Cmd {
+	cmd := defaultYumCommand()
+	cmd = append(cmd, "updateinfo", "list", "cves")
+	cmd = append(cmd, yumCacheArgs(config)...)
+	cmd = append(cmd, yumFilterArgs(config)...)
+	cmd = append(cmd, config.updatePackages...)
+	cmd = buildHostCommand(cmd)
+
+	return newCommand(cmd)
+}
+
+// listAdvisoryCVEs returns the CVEs of each package with an available update.
+func listAdvisoryCVEs(config Config) (map[string][]string, error) {
+	result := bytes.Buffer{}
+	cmd := buildYumUpdateInfoCVEsCommand(config)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("yum-updateinfo did not run successfully: %v", err)
+	}
+
+	return parseAdvisoryCVEs(result.Bytes()), nil
+}
+
+// excludeAdvisoryPackages returns the config with the packages fixed by the
+// excluded CVEs and advisories added to the excluded packages, as yum can not
+// exclude an advisory. The other updates of these packages are skipped too.
+func excludeAdvisoryPackages(config Config) (Config, error) {
+	if len(config.excludeCVEs) == 0 && len(config.excludeAdvisories) == 0 {
+		return config, nil
+	}
+
+	excluded := make([]string, 0)
+	exclude := func(nevra string) {
+		if name := nevraName(nevra); !containsString(excluded, name) {
+			excluded = append(excluded, name)
+		}
+	}
+
+	// the updates of the other categories install the fixes of the
+	// security advisories too, all the advisories are looked up.
+	lookup := config
+	lookup.category = categoryAll
+	lookup.includeCVEs = nil
+	lookup.includeAdvisories = nil
+
+	if len(config.excludeAdvisories) > 0 {
+		advisories, err := listAdvisories(lookup)
+		if err != nil {
+			return config, err
+		}
+		for _, a := range advisories {
+			if containsString(config.excludeAdvisories, a.id) {
+				exclude(a.pkg)
+			}
+		}
+	}
+
+	if len(config.excludeCVEs) > 0 {
+		cves, err := listAdvisoryCVEs(lookup)
+		if err != nil {
+			return config, err
+		}
+		packages := make([]string, 0, len(cves))
+		for pkg := range cves {
+			packages = append(packages, pkg)
+		}
+		sort.Strings(packages)
+		for _, pkg := range packages {
+			for _, cve := range cves[pkg] {
+				if containsString(config.excludeCVEs, cve) {
+					exclude(pkg)
+				}
+			}
+		}
+	}
+
+	if len(excluded) > 0 {
+		log.WithField("packages", excluded).Infof("exclude the packages of the excluded CVEs and advisories")
+	}
+	config.excludePackages = append(append([]string{}, config.excludePackages...), excluded...)
+	return config, nil
+}
+
+// hasSeverity checks if one of the advisories has the given severity.
+func hasSeverity(advisories []advisory, severity string) bool {
+	for _, a := range advisories {
+		if a.severity == severity {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validAdvisories = []string{
+	"RHSA-2021:0343 Important/Sec. sudo-1.8.23-10.el7_9.1.x86_64",
+	"RHSA-2021:0671 Critical/Sec.  bind-license-32:9.11.4-26.P2.el7_9.4.noarch",
+	"RHBA-2021:1234 bugfix         tzdata-2021a-1.el7.noarch",
+	"RHEA-2021:1-2  enhancement    tuned-2.11.0-11.el7_9.noarch  ",
+}
+
+func TestParseAdvisories(t *testing.T) {
+	output := strings.Join(append(validAdvisories,
+		"Loaded plugins: product-id, search-disabled-repos",
+		"updateinfo list done",
+		"",
+	), "\n")
+
+	advisories := parseAdvisories([]byte(output))
+	assert.Equal(t, []advisory{
+		{id: "RHSA-2021:0343", kind: "security", severity: "Important", pkg: "sudo-1.8.23-10.el7_9.1.x86_64"},
+		{id: "RHSA-2021:0671", kind: "security", severity: "Critical", pkg: "bind-license-32:9.11.4-26.P2.el7_9.4.noarch"},
+		{id: "RHBA-2021:1234", kind: "bugfix", pkg: "tzdata-2021a-1.el7.noarch"},
+		{id: "RHEA-2021:1-2", kind: "enhancement", pkg: "tuned-2.11.0-11.el7_9.noarch"},
+	}, advisories)
+
+	assert.True(t, hasSeverity(advisories, "Critical"))
+	assert.False(t, hasSeverity(advisories, "Low"))
+}
+
+func TestParseAdvisoriesAmazonFedora(t *testing.T) {
+	output := strings.Join([]string{
+		"Last metadata expiration check: 0:12:03 ago on Mon 01 Mar 2021.",
+		"ALAS2-2021-1695 important/Sec. sudo-1.8.23-10.amzn2.1.x86_64",
+		"ALAS-2021-1234  bugfix         tzdata-2021a-1.amzn1.noarch",
+		"ALASKERNEL-5.10-2022-001 Critical/Sec. kernel-5.10.75-79.358.amzn2.x86_64",
+		"FEDORA-2021-abcdef  Moderate/Sec.  bind-libs-32:9.16.15-1.fc34.x86_64",
+		"FEDORA-EPEL-2021-6ac3a9e2b8 enhancement htop-3.0.5-1.el8.x86_64",
+		"",
+	}, "\n")
+
+	assert.Equal(t, []advisory{
+		{id: "ALAS2-2021-1695", kind: "security", severity: "important", pkg: "sudo-1.8.23-10.amzn2.1.x86_64"},
+		{id: "ALAS-2021-1234", kind: "bugfix", pkg: "tzdata-2021a-1.amzn1.noarch"},
+		{id: "ALASKERNEL-5.10-2022-001", kind: "security", severity: "Critical", pkg: "kernel-5.10.75-79.358.amzn2.x86_64"},
+		{id: "FEDORA-2021-abcdef", kind: "security", severity: "Moderate", pkg: "bind-libs-32:9.16.15-1.fc34.x86_64"},
+		{id: "FEDORA-EPEL-2021-6ac3a9e2b8", kind: "enhancement", pkg: "htop-3.0.5-1.el8.x86_64"},
+	}, parseAdvisories([]byte(output)))
+}
+
+func TestBuildYumUpdateInfoCommand(t *testing.T) {
+	cmd := buildYumUpdateInfoCommand(Config{
+		excludePackages: []string{"etcd"},
+		severities:      []string{"Critical"},
+		updatePackages:  []string{"sudo"},
+	})
+	expected := "yum -y -q updateinfo list --security --exclude=etcd --sec-severity=Critical sudo"
+	assert.Equal(t, hostCommand+expected, strings.Join(cmd.Args, " "))
+}
+
+func TestExcludeAdvisoryPackages(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	testName = testDefaultFailure
+	config, err := excludeAdvisoryPackages(Config{excludePackages: []string{"etcd"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"etcd"}, config.excludePackages)
+
+	_, err = excludeAdvisoryPackages(Config{excludeCVEs: []string{"CVE-2021-3156"}})
+	assert.Error(t, err)
+
+	testName = testLivepatch
+	config, err = excludeAdvisoryPackages(Config{
+		excludePackages:   []string{"etcd"},
+		excludeAdvisories: []string{"RHSA-2021:0671", "RHSA-2021:3327"},
+		excludeCVEs:       []string{"CVE-2021-3156", "CVE-2021-3653"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"etcd", "bind-license", "kernel", "sudo"}, config.excludePackages)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// buildMakecacheCommand returns the exec command to download the metadata
+// of the repositories cached for longer than maxAge. The unavailable
+// repositories are skipped so the others are still refreshed. dnf has no
+// makecache fast, its makecache only downloads the expired metadata.
+func buildMakecacheCommand(maxAge time.Duration, dnf bool) *exec.Cmd {
+	expire := strconv.Itoa(int(maxAge.Seconds()))
+	cmd := []string{"yum", "-y", "makecache"}
+	if !dnf {
+		cmd = append(cmd, "fast")
+	}
+	cmd = append(cmd, "--setopt=*.metadata_expire="+expire, "--setopt=*.skip_if_unavailable=1")
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// yumCacheArgs returns the yum arguments restricting a command to
+// the cached metadata.
+func yumCacheArgs(config Config) []string {
+	if config.cacheOnly {
+		return []string{"-C"}
+	}
+	return nil
+}
+
+// refreshMetadataCache refreshes the metadata of the repositories cached
+// for longer than maxAge and returns the repositories whose metadata
+// can not be downloaded.
+func refreshMetadataCache(maxAge time.Duration) ([]string, error) {
+	log.WithField("component", "cache").Infof("refresh the metadata older than %s", maxAge)
+
+	stderr := bytes.Buffer{}
+	cmd := buildMakecacheCommand(maxAge, hostUsesDnf())
+	cmd.Stderr = &stderr
+
+	err := runCommand(cmd)
+	failures := parseRepoFailures(stderr.Bytes())
+	if err != nil {
+		return failures, fmt.Errorf("yum makecache did not run successfully: %v", err)
+	}
+	for _, id := range failures {
+		log.WithFields(log.Fields{"component": "cache", "repo": id}).Warnf("can not refresh the metadata")
+	}
+	return failures, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYumCacheArgs(t *testing.T) {
+	assert.Empty(t, yumCacheArgs(Config{}))
+	assert.Equal(t, []string{"-C"}, yumCacheArgs(Config{cacheOnly: true}))
+}
+
+func TestRefreshMetadataCache(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	testName = testRunUpdateAvailable
+	failures, err := refreshMetadataCache(6 * time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"internal-tools"}, failures)
+
+	testName = testDefaultFailure
+	_, err = refreshMetadataCache(6 * time.Hour)
+	assert.Error(t, err)
+}
+
+func TestMarkUnreachable(t *testing.T) {
+	repos := []repository{{id: "epel", reachable: true}, {id: "base", reachable: true}}
+	assert.Equal(t, []repository{
+		{id: "epel", reachable: true},
+		{id: "base"},
+		{id: "internal-tools"},
+	}, markUnreachable(repos, []string{"base", "internal-tools"}))
+}
+
+func TestFetchMetricsCacheOnly(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+	m.metadataMaxAge = 6 * time.Hour
+
+	m.fetchMetrics(Config{})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5
+yumsecupdater_repo_up{node="localhost",repo="internal-tools"} 0`)
+	assertMetricsOutput(t, string(data), `yumsecupdater_repo_cache_age_seconds{node="localhost",repo="rhel-7-server-rpms"}`)
+	assertMetricsNotInOutput(t, string(data), `yumsecupdater_repo_cache_age_seconds{node="localhost",repo="docker-ce-stable"}`)
+
+	// the checks do not use the cache when the refresh failed
+	var checks []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cmd := strings.Join(args, " ")
+		if strings.Contains(cmd, "makecache") {
+			testName = testDefaultFailure
+			defer func() { testName = testMetricsUpdateAvailable }()
+		}
+		if strings.Contains(cmd, "check-update") {
+			checks = append(checks, cmd)
+		}
+		return helperCommand(command, args...)
+	}
+	m.fetchMetrics(Config{})
+	assert.NotEmpty(t, checks)
+	for _, c := range checks {
+		assert.NotContains(t, c, " -C")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Categories of the advisories selecting the updates.
+const (
+	categorySecurity    = "security"
+	categoryBugfix      = "bugfix"
+	categoryEnhancement = "enhancement"
+	categoryAll         = "all"
+)
+
+const (
+	defaultCategory         string = categorySecurity
+	defaultCategoriesConfig string = ""
+)
+
+// CategoryPolicy is the update policy of an advisory category
+// run on its own schedule next to the policy of the flags.
+type CategoryPolicy struct {
+	Category        string   `json:"category"`
+	Interval        string   `json:"interval"`
+	Severities      []string `json:"severities"`
+	ExcludePackages []string `json:"excludePackages"`
+	UpdatePackages  []string `json:"updatePackages"`
+}
+
+// validateCategory checks if an advisory category is valid.
+func validateCategory(c string) error {
+	switch c {
+	case categorySecurity, categoryBugfix, categoryEnhancement, categoryAll:
+		return nil
+	}
+	return fmt.Errorf("invalid category: %s", c)
+}
+
+// updateCategory returns the advisory category of the updates
+// selected by the config, security by default.
+func updateCategory(config Config) string {
+	if config.category == "" {
+		return categorySecurity
+	}
+	return config.category
+}
+
+// categoryArg returns the yum argument selecting the advisories of
+// the category, none for all the updates.
+func categoryArg(category string) []string {
+	if category == categoryAll {
+		return nil
+	}
+	return []string{"--" + category}
+}
+
+// categoryUpdates returns the name of the updates of the category
+// used in the messages of the events.
+func categoryUpdates(category string) string {
+	switch category {
+	case categoryBugfix:
+		return "Bugfix updates"
+	case categoryEnhancement:
+		return "Enhancement updates"
+	case categoryAll:
+		return "Updates"
+	default:
+		return "Security updates"
+	}
+}
+
+// loadCategoriesConfig loads the category policies from a JSON file.
+func loadCategoriesConfig(path string) ([]CategoryPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can not read categories config: %v", err)
+	}
+
+	policies := []CategoryPolicy{}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("can not parse categories config: %v", err)
+	}
+
+	return policies, nil
+}
+
+// newCategoryConfig returns the config and the interval of a category policy.
+// The dry-run, update mode, pins, excluded CVEs and advisories, preflight
+// checks, kernel cleanup and services of the base config are kept, the
+// policy runs every interval when it has none.
+func newCategoryConfig(policy CategoryPolicy, base Config, interval time.Duration) (Config, time.Duration, error) {
+	if err := validateCategory(policy.Category); err != nil {
+		return Config{}, 0, err
+	}
+	// the targeted CVEs and advisories replace the category filter of yum,
+	// every policy would apply them.
+	if len(base.includeCVEs) > 0 || len(base.includeAdvisories) > 0 {
+		return Config{}, 0, fmt.Errorf("the CVEs and advisories can not be targeted with the categories config")
+	}
+	for _, s := range policy.Severities {
+		if err := validateSeverity(s); err != nil {
+			return Config{}, 0, err
+		}
+	}
+	if policy.Interval != "" {
+		d, err := parseDurationString(policy.Interval)
+		if err != nil {
+			return Config{}, 0, err
+		}
+		interval = d
+	}
+
+	config := Config{
+		dryRun:            base.dryRun,
+		updateMinimal:     base.updateMinimal,
+		category:          policy.Category,
+		excludePackages:   policy.ExcludePackages,
+		updatePackages:    policy.UpdatePackages,
+		severities:        policy.Severities,
+		restartServices:   base.restartServices,
+		pins:              base.pins,
+		excludeCVEs:       base.excludeCVEs,
+		excludeAdvisories: base.excludeAdvisories,
+		pinMode:           base.pinMode,
+		preflightChecks:   base.preflightChecks,
+		minFreeSpace:      base.minFreeSpace,
+		keepKernels:       base.keepKernels,
+	}
+	if config.excludePackages == nil {
+		config.excludePackages = []string{}
+	}
+	if config.updatePackages == nil {
+		config.updatePackages = []string{}
+	}
+	if config.severities == nil {
+		config.severities = []string{}
+	}
+
+	return config, interval, nil
+}
+
+// newCategoryConfigs returns the configs and the intervals of the category
+// policies, each category is updated by a single policy.
+func newCategoryConfigs(policies []CategoryPolicy, base Config, interval time.Duration) ([]Config, []time.Duration, error) {
+	configs := make([]Config, 0, len(policies))
+	intervals := make([]time.Duration, 0, len(policies))
+	seen := map[string]bool{updateCategory(base): true}
+
+	for _, p := range policies {
+		config, d, err := newCategoryConfig(p, base, interval)
+		if err != nil {
+			return nil, nil, err
+		}
+		if seen[config.category] {
+			return nil, nil, fmt.Errorf("category %s updated by several policies", config.category)
+		}
+		seen[config.category] = true
+		configs = append(configs, config)
+		intervals = append(intervals, d)
+	}
+
+	return configs, intervals, nil
+}
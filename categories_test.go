@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCategory(t *testing.T) {
+	for _, c := range []string{categorySecurity, categoryBugfix, categoryEnhancement, categoryAll} {
+		assert.NoError(t, validateCategory(c))
+	}
+	assert.Error(t, validateCategory("newpackage"))
+	assert.Error(t, validateCategory("Security"))
+}
+
+func TestUpdateCategory(t *testing.T) {
+	assert.Equal(t, categorySecurity, updateCategory(Config{}))
+	assert.Equal(t, categoryBugfix, updateCategory(Config{category: categoryBugfix}))
+}
+
+func TestLoadCategoriesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "categories.json")
+	data := `[{"category": "bugfix", "interval": "168h", "excludePackages": ["kernel*"]}]`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	policies, err := loadCategoriesConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []CategoryPolicy{{
+		Category:        categoryBugfix,
+		Interval:        "168h",
+		ExcludePackages: []string{"kernel*"},
+	}}, policies)
+
+	_, err = loadCategoriesConfig(filepath.Join(dir, "donotexist"))
+	assert.Error(t, err)
+}
+
+func TestNewCategoryConfigs(t *testing.T) {
+	base := Config{
+		dryRun:          true,
+		severities:      []string{"Important", "Critical"},
+		excludePackages: []string{"etcd"},
+		restartServices: []string{"sshd"},
+	}
+	policies := []CategoryPolicy{
+		{Category: categoryBugfix, Interval: "168h", ExcludePackages: []string{"kernel*"}},
+		{Category: categoryEnhancement, Severities: []string{"Moderate"}},
+	}
+
+	configs, intervals, err := newCategoryConfigs(policies, base, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []Config{
+		{
+			dryRun:          true,
+			category:        categoryBugfix,
+			excludePackages: []string{"kernel*"},
+			updatePackages:  []string{},
+			severities:      []string{},
+			restartServices: []string{"sshd"},
+		},
+		{
+			dryRun:          true,
+			category:        categoryEnhancement,
+			excludePackages: []string{},
+			updatePackages:  []string{},
+			severities:      []string{"Moderate"},
+			restartServices: []string{"sshd"},
+		},
+	}, configs)
+	assert.Equal(t, []time.Duration{168 * time.Hour, 24 * time.Hour}, intervals)
+
+	// the excluded CVEs and advisories stay excluded in the other categories
+	base.excludeCVEs = []string{"CVE-2021-3156"}
+	base.excludeAdvisories = []string{"RHSA-2021:0671"}
+	configs, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categoryAll}}, base, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"CVE-2021-3156"}, configs[0].excludeCVEs)
+	assert.Equal(t, []string{"RHSA-2021:0671"}, configs[0].excludeAdvisories)
+
+	testName = testLivepatch
+	defer func() { execCommand = exec.Command }()
+	var lookups []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		lookups = append(lookups, strings.Join(args, " "))
+		return helperCommand(command, args...)
+	}
+	config, err := excludeAdvisoryPackages(configs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bind-license", "sudo"}, config.excludePackages)
+	// the bugfix advisories have no CVEs, the security ones are looked up
+	config, err = excludeAdvisoryPackages(Config{category: categoryBugfix, excludeCVEs: base.excludeCVEs})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sudo"}, config.excludePackages)
+	assert.NotEmpty(t, lookups)
+	for _, l := range lookups {
+		assert.NotContains(t, l, "--bugfix")
+	}
+
+	// the targeted CVEs would be applied by every policy
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categoryBugfix}}, Config{includeCVEs: []string{"CVE-2021-3156"}}, time.Hour)
+	assert.Error(t, err)
+
+	// the security updates are already applied by the flags
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categorySecurity}}, base, time.Hour)
+	assert.Error(t, err)
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categoryBugfix}, {Category: categoryBugfix}}, base, time.Hour)
+	assert.Error(t, err)
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: "newpackage"}}, base, time.Hour)
+	assert.Error(t, err)
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categoryBugfix, Severities: []string{"severe"}}}, base, time.Hour)
+	assert.Error(t, err)
+	_, _, err = newCategoryConfigs([]CategoryPolicy{{Category: categoryBugfix, Interval: "weekly"}}, base, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestFetchMetricsCategories(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{})
+	m.fetchMetrics(Config{category: categoryBugfix})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_packages_with_update_total{category="bugfix",node="localhost"} 5
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5`)
+	assertMetricsOutput(t, string(data), `yumsecupdater_package_with_update{arch="x86_64",category="bugfix",name="117",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1`)
+
+	// the check of a category keeps the packages of the others
+	testName = testNoUpdateAvailable
+	m.fetchMetrics(Config{category: categoryBugfix})
+	data, err = ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_package_with_update{arch="x86_64",category="security",name="117",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1`)
+	assertMetricsNotInOutput(t, string(data), `category="bugfix",name="117"`)
+}
+
+func TestSetRunMetricsCategories(t *testing.T) {
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+
+	m.setRunMetrics(&RunResult{End: time.Unix(10, 0), UpdateMode: updateModeLatest})
+	m.setRunMetrics(&RunResult{End: time.Unix(20, 0), UpdateMode: updateModeMinimal, Category: categoryBugfix, Failed: true})
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	textfile := filepath.Join(dir, "yumsecupdater.prom")
+	assert.NoError(t, writeTextfile(textfile, m.registry))
+
+	data, err := ioutil.ReadFile(textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_last_run_success{category="bugfix",node="localhost"} 0
+yumsecupdater_last_run_success{category="security",node="localhost"} 1`)
+	assertMetricsOutput(t, string(data), `yumsecupdater_last_run_update_mode{category="bugfix",mode="update-minimal",node="localhost"} 1
+yumsecupdater_last_run_update_mode{category="security",mode="update",node="localhost"} 1`)
+}
+
+func TestYumFilterArgsCategories(t *testing.T) {
+	severities := []string{"Important", "Critical"}
+	var tests = []struct {
+		category string
+		expected []string
+	}{
+		{"", []string{"--security", "--sec-severity=Important", "--sec-severity=Critical"}},
+		{categorySecurity, []string{"--security", "--sec-severity=Important", "--sec-severity=Critical"}},
+		{categoryBugfix, []string{"--bugfix"}},
+		{categoryEnhancement, []string{"--enhancement"}},
+		{categoryAll, []string{}},
+	}
+	for _, tt := range tests {
+		args := yumFilterArgs(Config{category: tt.category, severities: severities})
+		assert.Equal(t, tt.expected, args, tt.category)
+	}
+}
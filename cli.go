@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Subcommands.
+const (
+	daemonCmd string = "daemon"
+	checkCmd  string = "check"
+	planCmd   string = "plan"
+	updateCmd string = "update"
+	statusCmd string = "status"
+	reportCmd string = "report"
+)
+
+// Exit codes of the subcommands.
+const (
+	exitUpToDate       int = 0
+	exitFailed         int = 1
+	exitUsage          int = 2
+	exitUpdated        int = 10
+	exitRebootRequired int = 11
+	exitSkipped        int = 12
+)
+
+// Output formats of the subcommands.
+const (
+	outputTable string = "table"
+	outputText  string = "text"
+	outputJSON  string = "json"
+)
+
+const (
+	defaultDaemonAddr string = "http://localhost:9080"
+	httpClientTimeout        = 30 * time.Second
+)
+
+var usage = `Usage: yumsecupdater [command] [flags]
+
+Commands:
+  daemon   Run the updates and the metrics periodically (default)
+  check    Print the packages with security updates
+  plan     Print the updates applied, excluded and pinned by the flags
+  update   Run the updates once and exit
+  status   Print the status of a running daemon
+  report   Print the history of the runs
+
+Exit codes of update:
+  0   up-to-date
+  1   failed
+  2   invalid usage
+  10  packages updated
+  11  reboot required
+  12  update skipped by the preflight checks
+
+Run 'yumsecupdater [command] -h' for the flags of a command.
+`
+
+// printUsage prints the usage of the binary.
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, usage)
+}
+
+// parseCommand returns the subcommand and its arguments. The daemon
+// is the default subcommand so the flags can be passed directly.
+func parseCommand(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return daemonCmd, args
+	}
+	return args[0], args[1:]
+}
+
+// nodeName returns the name of the node from the environment or the hostname.
+func nodeName() string {
+	if name := os.Getenv(nodeIDEnv); name != "" {
+		return name
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+// validateOutput checks if an output format is allowed.
+func validateOutput(output string, allowed ...string) error {
+	if !containsString(allowed, output) {
+		return fmt.Errorf("invalid output: %s, allowed values: %s", output, strings.Join(allowed, ","))
+	}
+	return nil
+}
+
+// checkCommand prints the packages with security updates.
+func checkCommand(args []string, w io.Writer) int {
+	var (
+		config = Config{}
+		output string
+	)
+
+	fs := flag.NewFlagSet(checkCmd, flag.ContinueOnError)
+	addYumFlags(fs, &config)
+	fs.StringVar(&output, "output", outputTable, "Output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(output, outputTable, outputJSON); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := parseYumFlags(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	config, err := excludeAdvisoryPackages(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	packages, err := listUpdatesAvailable(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	packages, pinned := applyPins(config.pins, packages)
+	for _, p := range pinned {
+		fmt.Fprintf(os.Stderr, "%s.%s %s held back by the pin %s\n", p.pkg.name, p.pkg.arch, p.pkg.version, p.pin)
+	}
+
+	if err := printUpdates(w, packages, output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	return exitUpToDate
+}
+
+// planCommand prints the effective plan of the updates, with the updates
+// suppressed by each exclude pattern and pin.
+func planCommand(args []string, w io.Writer) int {
+	var (
+		config = Config{}
+		output string
+	)
+
+	fs := flag.NewFlagSet(planCmd, flag.ContinueOnError)
+	addYumFlags(fs, &config)
+	fs.StringVar(&output, "output", outputTable, "Output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(output, outputTable, outputJSON); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := parseYumFlags(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	config, err := excludeAdvisoryPackages(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	plan, err := buildUpdatePlan(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	if err := printPlan(w, plan, output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	return exitUpToDate
+}
+
+// printUpdates prints the packages with updates as a table or JSON.
+func printUpdates(w io.Writer, packages []packageWithUpdate, output string) error {
+	if output == outputJSON {
+		return printJSON(w, packages)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tARCH\tVERSION\tREPO")
+	for _, p := range packages {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.name, p.arch, p.version, p.repo)
+	}
+	return tw.Flush()
+}
+
+// printJSON prints a value as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// updateCommand runs the updates once and exits with a code
+// describing the result.
+func updateCommand(args []string, w io.Writer) int {
+	var (
+		config = Config{}
+		output string
+		file   string
+	)
+
+	fs := flag.NewFlagSet(updateCmd, flag.ContinueOnError)
+	addYumFlags(fs, &config)
+	addPreflightFlags(fs)
+	fs.BoolVar(&config.dryRun, "dry-run", defaultDryRun, "Enable dry-run mode, do not run any update")
+	fs.BoolVar(&config.updateMinimal, "update-minimal", defaultUpdateMinimal, "Install the lowest versions fixing the advisories with yum update-minimal instead of the newest versions")
+	fs.IntVar(&config.keepKernels, "keep-kernels", defaultKeepKernels, "Number of the newest kernels kept with the running kernel by the cleanup after the updates, disabled if 0")
+	fs.StringVar(&output, "output", outputText, "Output format: text or json")
+	fs.StringVar(&file, "history-file", defaultHistoryFile, "File where the result is added to the history of the runs")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(output, outputText, outputJSON); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := parseYumFlags(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := parsePreflightFlags(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := validateKeepKernels(config.keepKernels); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	result := runOnce(config)
+
+	if file != "" {
+		history := newHistory(defaultHistorySize, file)
+		if err := history.load(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if err := history.add(result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if output == outputJSON {
+		printJSON(w, result)
+	} else {
+		fmt.Fprint(w, result.summary(nodeName()))
+	}
+
+	return updateExitCode(result)
+}
+
+// updateExitCode returns the exit code describing a result.
+func updateExitCode(result *RunResult) int {
+	switch {
+	case result.Failed:
+		return exitFailed
+	case result.RebootRequired:
+		return exitRebootRequired
+	case result.Skipped:
+		return exitSkipped
+	case result.Updated:
+		return exitUpdated
+	default:
+		return exitUpToDate
+	}
+}
+
+// getDaemonAPI decodes the JSON returned by a path of the daemon API.
+func getDaemonAPI(addr, path string, v interface{}) error {
+	client := &http.Client{Timeout: httpClientTimeout}
+	resp, err := client.Get(strings.TrimSuffix(addr, "/") + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusCommand prints the status of a running daemon.
+func statusCommand(args []string, w io.Writer) int {
+	var addr string
+
+	fs := flag.NewFlagSet(statusCmd, flag.ContinueOnError)
+	fs.StringVar(&addr, "addr", defaultDaemonAddr, "Address of the daemon API")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	status := map[string]interface{}{}
+	if err := getDaemonAPI(addr, statusPath, &status); err != nil {
+		fmt.Fprintf(os.Stderr, "can not get status: %v\n", err)
+		return exitFailed
+	}
+
+	printJSON(w, status)
+
+	return exitUpToDate
+}
+
+// reportCommand prints the history of the runs from a history
+// file or from a running daemon.
+func reportCommand(args []string, w io.Writer) int {
+	var (
+		addr   string
+		file   string
+		output string
+	)
+
+	fs := flag.NewFlagSet(reportCmd, flag.ContinueOnError)
+	fs.StringVar(&addr, "addr", defaultDaemonAddr, "Address of the daemon API, used if -history-file is not set")
+	fs.StringVar(&file, "history-file", defaultHistoryFile, "History file to read")
+	fs.StringVar(&output, "output", outputTable, "Output format: table, text for the summary of every run, or json")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if err := validateOutput(output, outputTable, outputText, outputJSON); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	var (
+		results []*RunResult
+		err     error
+	)
+	if file != "" {
+		results, err = readHistoryFile(file)
+	} else {
+		err = getDaemonAPI(addr, historyPath, &results)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can not get history: %v\n", err)
+		return exitFailed
+	}
+
+	if err := printReport(w, results, output, nodeName()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+
+	return exitUpToDate
+}
+
+// printReport prints the results of the runs as a table, text summaries or JSON.
+func printReport(w io.Writer, results []*RunResult, output, node string) error {
+	switch output {
+	case outputJSON:
+		return printJSON(w, results)
+	case outputText:
+		for i, r := range results {
+			if i > 0 {
+				fmt.Fprintln(w, "---")
+			}
+			fmt.Fprint(w, r.summary(node))
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tDURATION\tDRY-RUN\tRESULT")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n",
+			r.Start.Format("2006-01-02 15:04:05"),
+			r.End.Sub(r.Start).Round(time.Second),
+			r.DryRun,
+			r)
+	}
+	return tw.Flush()
+}
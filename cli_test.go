@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	var tests = []struct {
+		args    []string
+		command string
+		rest    []string
+	}{
+		{[]string{}, daemonCmd, []string{}},
+		{[]string{"--dry-run=true", "-interval", "1h"}, daemonCmd, []string{"--dry-run=true", "-interval", "1h"}},
+		{[]string{"daemon", "-dry-run"}, daemonCmd, []string{"-dry-run"}},
+		{[]string{"check", "-output", "json"}, checkCmd, []string{"-output", "json"}},
+		{[]string{"plan", "-exclude-packages", "etcd"}, planCmd, []string{"-exclude-packages", "etcd"}},
+		{[]string{"unknown"}, "unknown", []string{}},
+	}
+
+	for _, tt := range tests {
+		command, rest := parseCommand(tt.args)
+		assert.Equal(t, tt.command, command)
+		assert.Equal(t, tt.rest, rest)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	out := bytes.Buffer{}
+	assert.Equal(t, exitUpToDate, checkCommand([]string{}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, []string{"NAME", "ARCH", "VERSION", "REPO"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"117", "x86_64", "1:1.0.2k-21.el7_9", "rhel-7-server-rpms"}, strings.Fields(lines[1]))
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, checkCommand([]string{"-output", "json"}, &out))
+	packages := []packageWithUpdate{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &packages))
+	assert.Len(t, packages, 5)
+
+	assert.Equal(t, exitUsage, checkCommand([]string{"-output", "yaml"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-severities", "severe"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-cves", "CVE-2021"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-category", "bugfixes"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-pins", "docker-ce>20.10.7"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-pin-mode", "lock"}, &out))
+	assert.Equal(t, exitUsage, checkCommand([]string{"-exclude-advisories", "RHSA-2021:0343,sudo"}, &out))
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, checkCommand([]string{"-exclude-advisories", "RHSA-2021:0343"}, &out))
+
+	testName = testDefaultFailure
+	assert.Equal(t, exitFailed, checkCommand([]string{}, &out))
+}
+
+func TestPlanCommand(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	out := bytes.Buffer{}
+	assert.Equal(t, exitUpToDate, planCommand([]string{"-exclude-packages", "117,etcd", "-pins", "pkg-x86_64<=1.13.0"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, []string{"ACTION", "NAME", "ARCH", "VERSION", "REPO", "REASON"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"update", "118", "x86_64", "1:1.0.2k-21.el7_9", "rhel-7-server-rpms", "-"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"exclude", "117", "x86_64", "1:1.0.2k-21.el7_9", "rhel-7-server-rpms", "117"}, strings.Fields(lines[4]))
+	assert.Equal(t, "pin", strings.Fields(lines[5])[0])
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, planCommand([]string{"-exclude-packages", "etcd", "-output", "json"}, &out))
+	plan := updatePlanJSON{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &plan))
+	assert.Len(t, plan.Updates, 5)
+	assert.Equal(t, []string{"etcd"}, plan.UnmatchedExcludes)
+
+	assert.Equal(t, exitUsage, planCommand([]string{"-output", "yaml"}, &out))
+
+	testName = testDefaultFailure
+	assert.Equal(t, exitFailed, planCommand([]string{}, &out))
+}
+
+func TestUpdateCommand(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+
+	out := bytes.Buffer{}
+	assert.Equal(t, exitRebootRequired, updateCommand([]string{"-history-file", path}, &out))
+	assert.Contains(t, out.String(), "Result: 5 packages updated, reboot scheduled")
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, updateCommand([]string{"-dry-run", "-output", "json", "-history-file", path}, &out))
+	result := RunResult{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	assert.True(t, result.DryRun)
+
+	results, err := readHistoryFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	testName = testDefaultFailure
+	assert.Equal(t, exitFailed, updateCommand([]string{}, &out))
+}
+
+func TestUpdateExitCode(t *testing.T) {
+	assert.Equal(t, exitUpToDate, updateExitCode(&RunResult{}))
+	assert.Equal(t, exitUpdated, updateExitCode(&RunResult{Updated: true}))
+	assert.Equal(t, exitRebootRequired, updateExitCode(&RunResult{Updated: true, RebootRequired: true}))
+	assert.Equal(t, exitFailed, updateExitCode(&RunResult{Updated: true, Failed: true}))
+}
+
+func TestStatusAndReportCommands(t *testing.T) {
+	history := newHistory(2, "")
+	history.add(testRunResult())
+
+	status := &Status{}
+	status.setNextRun(time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC))
+
+	mux := http.NewServeMux()
+	mux.Handle(statusPath, status)
+	mux.Handle(historyPath, history)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	out := bytes.Buffer{}
+	assert.Equal(t, exitUpToDate, statusCommand([]string{"-addr", server.URL}, &out))
+	assert.Contains(t, out.String(), `"nextRun": "2021-10-02T12:00:00Z"`)
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, reportCommand([]string{"-addr", server.URL}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "2021-10-01 12:00:00  5m0s      false    1 packages updated, reboot scheduled")
+
+	out.Reset()
+	assert.Equal(t, exitUpToDate, reportCommand([]string{"-addr", server.URL, "-output", "text"}, &out))
+	assert.Contains(t, out.String(), "Packages updated (1):")
+
+	assert.Equal(t, exitFailed, statusCommand([]string{"-addr", server.URL + "/invalid"}, &out))
+	assert.Equal(t, exitFailed, reportCommand([]string{"-history-file", "donotexist"}, &out))
+	assert.Equal(t, exitUsage, reportCommand([]string{"-output", "yaml"}, &out))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PackageChange is a package that changed during an update.
+type PackageChange struct {
+	Name     string `json:"name"`
+	Arch     string `json:"arch"`
+	OldNEVRA string `json:"oldNevra,omitempty"`
+	NewNEVRA string `json:"newNevra,omitempty"`
+}
+
+// PackageDiff holds the packages that changed during an update.
+type PackageDiff struct {
+	Upgraded   []PackageChange `json:"upgraded"`
+	Installed  []PackageChange `json:"installed"`
+	Removed    []PackageChange `json:"removed"`
+	Downgraded []PackageChange `json:"downgraded"`
+}
+
+// empty checks if no packages changed.
+func (d PackageDiff) empty() bool {
+	return len(d.Upgraded)+len(d.Installed)+len(d.Removed)+len(d.Downgraded) == 0
+}
+
+// diffPackages returns the changes between two snapshots of the installed packages.
+// Packages that can be installed in several versions, like the kernel,
+// are reported as installed or removed.
+func diffPackages(before, after []installedPackage) PackageDiff {
+	type key struct{ name, arch string }
+
+	group := func(packages []installedPackage) map[key]map[string]installedPackage {
+		groups := map[key]map[string]installedPackage{}
+		for _, p := range packages {
+			k := key{p.name, p.arch}
+			if groups[k] == nil {
+				groups[k] = map[string]installedPackage{}
+			}
+			groups[k][p.evr()] = p
+		}
+		return groups
+	}
+
+	// keeps the packages of a that are not in b.
+	subtract := func(a, b map[string]installedPackage) []installedPackage {
+		result := []installedPackage{}
+		for evr, p := range a {
+			if _, ok := b[evr]; !ok {
+				result = append(result, p)
+			}
+		}
+		return result
+	}
+
+	beforeGroups := group(before)
+	afterGroups := group(after)
+
+	keys := map[key]struct{}{}
+	for k := range beforeGroups {
+		keys[k] = struct{}{}
+	}
+	for k := range afterGroups {
+		keys[k] = struct{}{}
+	}
+
+	diff := PackageDiff{
+		Upgraded:   []PackageChange{},
+		Installed:  []PackageChange{},
+		Removed:    []PackageChange{},
+		Downgraded: []PackageChange{},
+	}
+
+	for k := range keys {
+		removed := subtract(beforeGroups[k], afterGroups[k])
+		installed := subtract(afterGroups[k], beforeGroups[k])
+
+		if len(removed) == 1 && len(installed) == 1 {
+			change := PackageChange{
+				Name:     k.name,
+				Arch:     k.arch,
+				OldNEVRA: removed[0].nevra(),
+				NewNEVRA: installed[0].nevra(),
+			}
+			if compareEVR(installed[0].evr(), removed[0].evr()) < 0 {
+				diff.Downgraded = append(diff.Downgraded, change)
+			} else {
+				diff.Upgraded = append(diff.Upgraded, change)
+			}
+			continue
+		}
+
+		for _, p := range removed {
+			diff.Removed = append(diff.Removed, PackageChange{Name: k.name, Arch: k.arch, OldNEVRA: p.nevra()})
+		}
+		for _, p := range installed {
+			diff.Installed = append(diff.Installed, PackageChange{Name: k.name, Arch: k.arch, NewNEVRA: p.nevra()})
+		}
+	}
+
+	for _, changes := range [][]PackageChange{diff.Upgraded, diff.Installed, diff.Removed, diff.Downgraded} {
+		sort.Slice(changes, func(i, j int) bool {
+			if changes[i].Name != changes[j].Name {
+				return changes[i].Name < changes[j].Name
+			}
+			if changes[i].Arch != changes[j].Arch {
+				return changes[i].Arch < changes[j].Arch
+			}
+			return changes[i].OldNEVRA+changes[i].NewNEVRA < changes[j].OldNEVRA+changes[j].NewNEVRA
+		})
+	}
+
+	return diff
+}
+
+// logPackageDiff logs the changes of an update.
+func logPackageDiff(diff PackageDiff) {
+	logger := log.WithField("component", "diff")
+
+	changes := map[string][]PackageChange{
+		"upgraded":   diff.Upgraded,
+		"installed":  diff.Installed,
+		"removed":    diff.Removed,
+		"downgraded": diff.Downgraded,
+	}
+	for _, change := range []string{"upgraded", "installed", "removed", "downgraded"} {
+		for _, c := range changes[change] {
+			logger.WithFields(log.Fields{
+				"change": change,
+				"old":    c.OldNEVRA,
+				"new":    c.NewNEVRA,
+			}).Infof("%s.%s %s", c.Name, c.Arch, change)
+		}
+	}
+
+	logger.Infof("%d upgraded, %d installed, %d removed, %d downgraded",
+		len(diff.Upgraded), len(diff.Installed), len(diff.Removed), len(diff.Downgraded))
+}
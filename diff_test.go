@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPackages(t *testing.T) {
+	before := []installedPackage{
+		{name: "openssl-libs", epoch: "1", version: "1.0.2k", release: "19.el7", arch: "x86_64"},
+		{name: "sudo", version: "1.8.23", release: "10.el7", arch: "x86_64"},
+		{name: "kernel", version: "3.10.0", release: "1127.el7", arch: "x86_64"},
+		{name: "kernel", version: "3.10.0", release: "1160.el7", arch: "x86_64"},
+		{name: "tzdata", version: "2021a", release: "1.el7", arch: "noarch"},
+		{name: "old-dep", version: "1.0", release: "1.el7", arch: "noarch"},
+	}
+	after := []installedPackage{
+		{name: "openssl-libs", epoch: "1", version: "1.0.2k", release: "21.el7_9", arch: "x86_64"},
+		{name: "sudo", version: "1.8.23", release: "10.el7", arch: "x86_64"},
+		{name: "kernel", version: "3.10.0", release: "1127.el7", arch: "x86_64"},
+		{name: "kernel", version: "3.10.0", release: "1160.el7", arch: "x86_64"},
+		{name: "kernel", version: "3.10.0", release: "1160.25.1.el7", arch: "x86_64"},
+		{name: "tzdata", version: "2020a", release: "1.el7", arch: "noarch"},
+		{name: "new-dep", version: "2.0", release: "1.el7", arch: "noarch"},
+	}
+
+	diff := diffPackages(before, after)
+	assert.Equal(t, PackageDiff{
+		Upgraded: []PackageChange{
+			{Name: "openssl-libs", Arch: "x86_64", OldNEVRA: "openssl-libs-1:1.0.2k-19.el7.x86_64", NewNEVRA: "openssl-libs-1:1.0.2k-21.el7_9.x86_64"},
+		},
+		Installed: []PackageChange{
+			{Name: "kernel", Arch: "x86_64", NewNEVRA: "kernel-3.10.0-1160.25.1.el7.x86_64"},
+			{Name: "new-dep", Arch: "noarch", NewNEVRA: "new-dep-2.0-1.el7.noarch"},
+		},
+		Removed: []PackageChange{
+			{Name: "old-dep", Arch: "noarch", OldNEVRA: "old-dep-1.0-1.el7.noarch"},
+		},
+		Downgraded: []PackageChange{
+			{Name: "tzdata", Arch: "noarch", OldNEVRA: "tzdata-2021a-1.el7.noarch", NewNEVRA: "tzdata-2020a-1.el7.noarch"},
+		},
+	}, diff)
+	assert.False(t, diff.empty())
+
+	assert.True(t, diffPackages(before, before).empty())
+}
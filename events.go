@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Lifecycle events sent during a run.
+const (
+	eventUpdatesAvailable       = "UpdatesAvailable"
+	eventCriticalUpdatesPending = "CriticalUpdatesPending"
+	eventUpdateStarted          = "UpdateStarted"
+	eventUpdateSucceeded        = "UpdateSucceeded"
+	eventUpdateFailed           = "UpdateFailed"
+	eventUpdateSkipped          = "UpdateSkipped"
+	eventRebootRequired         = "RebootRequired"
+	eventRunCompleted           = "RunCompleted"
+
+	// eventUpdatesChecked is sent each time the metrics
+	// refresh the list of packages with updates.
+	eventUpdatesChecked = "UpdatesChecked"
+	// eventRebootCleared is sent when the reboot signals are
+	// cleared, once no reboot is required anymore.
+	eventRebootCleared = "RebootCleared"
+)
+
+// validateEventReason checks if an event reason is valid.
+func validateEventReason(reason string) error {
+	var allowedReasons = map[string]struct{}{
+		eventUpdatesAvailable:       {},
+		eventCriticalUpdatesPending: {},
+		eventUpdateStarted:          {},
+		eventUpdateSucceeded:        {},
+		eventUpdateFailed:           {},
+		eventUpdateSkipped:          {},
+		eventRebootRequired:         {},
+		eventRunCompleted:           {},
+		eventUpdatesChecked:         {},
+		eventRebootCleared:          {},
+	}
+
+	if _, ok := allowedReasons[reason]; !ok {
+		return fmt.Errorf("invalid event: %s", reason)
+	}
+	return nil
+}
+
+// Event describes a step of the update lifecycle.
+type Event struct {
+	Reason  string
+	Message string
+	// Category is the advisory category of the updates of the
+	// UpdatesAvailable and UpdatesChecked events, security if empty.
+	Category string
+	Time     time.Time
+	Packages []packageWithUpdate
+	Result   *RunResult
+}
+
+// EventSink receives the lifecycle events.
+type EventSink interface {
+	Send(e Event)
+}
+
+// eventSinks holds the sinks the events are sent to.
+var eventSinks []EventSink
+
+// eventFlusher is an EventSink sending the events in the background.
+type eventFlusher interface {
+	flush()
+}
+
+// flushEvents waits for the sinks to send the events in the background.
+func flushEvents() {
+	for _, s := range eventSinks {
+		if f, ok := s.(eventFlusher); ok {
+			f.flush()
+		}
+	}
+}
+
+// sendEvent sends an event to all the registered sinks.
+func sendEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, sink := range eventSinks {
+		sink.Send(e)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSink records the reasons of the events it receives.
+type recordSink struct {
+	reasons []string
+}
+
+func (r *recordSink) Send(e Event) {
+	r.reasons = append(r.reasons, e.Reason)
+}
+
+func withRecordSink() (*recordSink, func()) {
+	sink := &recordSink{}
+	eventSinks = []EventSink{sink}
+	return sink, func() { eventSinks = nil }
+}
+
+func TestSendEvent(t *testing.T) {
+	sink, reset := withRecordSink()
+	defer reset()
+
+	sendEvent(Event{Reason: eventUpdateStarted})
+	sendEvent(Event{Reason: eventUpdateSucceeded})
+	assert.Equal(t, []string{eventUpdateStarted, eventUpdateSucceeded}, sink.reasons)
+}
+
+func TestRunEvents(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	sink, reset := withRecordSink()
+	defer reset()
+
+	result := &RunResult{}
+	assert.NoError(t, run(Config{}, result))
+	assert.True(t, result.Updated)
+	assert.True(t, result.RebootRequired)
+	assert.Len(t, result.Packages, 5)
+	assert.Len(t, result.Advisories, 4)
+	assert.NotNil(t, result.Diff)
+	assert.True(t, result.Diff.empty())
+	assert.Equal(t, []string{
+		eventUpdatesAvailable,
+		eventCriticalUpdatesPending,
+		eventUpdateStarted,
+		eventUpdateSucceeded,
+		eventRebootRequired,
+	}, sink.reasons)
+
+	sink.reasons = nil
+	assert.NoError(t, run(Config{dryRun: true}, &RunResult{}))
+	assert.Equal(t, []string{eventUpdatesAvailable, eventCriticalUpdatesPending}, sink.reasons)
+}
+
+func TestValidateEventReason(t *testing.T) {
+	assert.NoError(t, validateEventReason(eventUpdateFailed))
+	assert.NoError(t, validateEventReason(eventUpdateSkipped))
+	assert.Error(t, validateEventReason("updatefailed"))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	historyPath string = "/api/v1/history"
+
+	defaultHistorySize int    = 30
+	defaultHistoryFile string = ""
+)
+
+// History keeps the results of the last runs, optionally persisted to a file.
+type History struct {
+	mutex   sync.RWMutex
+	size    int
+	path    string
+	results []*RunResult
+}
+
+// runHistory is the history shared by the run loop and the http server.
+var runHistory = newHistory(defaultHistorySize, defaultHistoryFile)
+
+// newHistory returns a History keeping size results, persisted to
+// path if not empty.
+func newHistory(size int, path string) *History {
+	return &History{
+		size:    size,
+		path:    path,
+		results: []*RunResult{},
+	}
+}
+
+// load reads the history from its file if it exists.
+func (h *History) load() error {
+	if h.path == "" {
+		return nil
+	}
+
+	results, err := readHistoryFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.results = results
+	h.trim()
+
+	return nil
+}
+
+// readHistoryFile reads the results of a history file.
+func readHistoryFile(path string) ([]*RunResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*RunResult{}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("can not parse history file %s: %v", path, err)
+	}
+
+	return results, nil
+}
+
+// add appends a result to the history and persists it.
+func (h *History) add(r *RunResult) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.results = append(h.results, r)
+	h.trim()
+
+	if h.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(h.results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(h.path, data); err != nil {
+		return fmt.Errorf("can not write history file: %v", err)
+	}
+
+	return nil
+}
+
+// trim drops the oldest results above the size of the history.
+func (h *History) trim() {
+	if h.size > 0 && len(h.results) > h.size {
+		h.results = h.results[len(h.results)-h.size:]
+	}
+}
+
+// list returns the results from the oldest to the newest.
+func (h *History) list() []*RunResult {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	results := make([]*RunResult, len(h.results))
+	copy(results, h.results)
+	return results
+}
+
+// last returns the newest result or nil.
+func (h *History) last() *RunResult {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if len(h.results) == 0 {
+		return nil
+	}
+	return h.results[len(h.results)-1]
+}
+
+// Send implements EventSink.
+func (h *History) Send(e Event) {
+	if e.Reason != eventRunCompleted || e.Result == nil {
+		return
+	}
+	if err := h.add(e.Result); err != nil {
+		log.WithField("component", "history").Error(err)
+	}
+}
+
+// ServeHTTP writes the history as JSON.
+func (h *History) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.list()); err != nil {
+		log.Errorf("can not encode history: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.json")
+	h := newHistory(2, path)
+	assert.NoError(t, h.load())
+	assert.Nil(t, h.last())
+
+	first := testRunResult()
+	second := &RunResult{Failed: true, Errors: []string{"failed"}}
+	third := &RunResult{}
+
+	h.Send(Event{Reason: eventRunCompleted, Result: first})
+	h.Send(Event{Reason: eventUpdateFailed})
+	h.Send(Event{Reason: eventRunCompleted, Result: second})
+	h.Send(Event{Reason: eventRunCompleted, Result: third})
+
+	assert.Equal(t, []*RunResult{second, third}, h.list())
+	assert.Equal(t, third, h.last())
+
+	// reload from the file
+	loaded := newHistory(2, path)
+	assert.NoError(t, loaded.load())
+	assert.Len(t, loaded.list(), 2)
+	assert.True(t, loaded.list()[0].Failed)
+
+	loaded = newHistory(1, path)
+	assert.NoError(t, loaded.load())
+	assert.Len(t, loaded.list(), 1)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("invalid"), 0600))
+	assert.Error(t, newHistory(2, path).load())
+}
+
+func TestHistoryServeHTTP(t *testing.T) {
+	h := newHistory(2, "")
+	h.Send(Event{Reason: eventRunCompleted, Result: testRunResult()})
+
+	req, err := http.NewRequest("GET", historyPath, nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	results := []*RunResult{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &results))
+	assert.Equal(t, []*RunResult{testRunResult()}, results)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultKeepKernels int = 0
+
+// kernelRelease returns the version-release.arch of a kernel package,
+// the format of uname -r.
+func kernelRelease(k installedPackage) string {
+	return fmt.Sprintf("%s-%s.%s", k.version, k.release, k.arch)
+}
+
+// validateKeepKernels checks if the number of kernels kept by the cleanup is valid.
+func validateKeepKernels(keep int) error {
+	if keep < 0 {
+		return fmt.Errorf("invalid number of kernels to keep: %d", keep)
+	}
+	return nil
+}
+
+// buildDnfCheckCommand returns the exec command to check if dnf is the
+// package manager of the host.
+func buildDnfCheckCommand() *exec.Cmd {
+	cmd := []string{"test", "-x", "/usr/bin/dnf"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// hostUsesDnf returns true if the host has dnf, yum is an alias of dnf then
+// and package-cleanup has no --oldkernels.
+func hostUsesDnf() bool {
+	return runCommand(buildDnfCheckCommand()) == nil
+}
+
+// buildKernelCleanupCommand returns the exec command to remove the
+// kernels older than the keep newest ones, package-cleanup never removes
+// the running kernel. dnf has no package-cleanup --oldkernels and its
+// remove --oldinstallonly removes all the installonly packages, the old
+// kernels are removed by name instead.
+func buildKernelCleanupCommand(keep int, old []string, dnf bool) *exec.Cmd {
+	cmd := []string{"package-cleanup", "-y", "-q", "--oldkernels", "--count=" + strconv.Itoa(keep)}
+	if dnf {
+		cmd = append([]string{"dnf", "-y", "-q", "remove"}, old...)
+	}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// oldKernels returns the kernels removed by a cleanup keeping the keep
+// newest kernels and the running kernel.
+func oldKernels(kernels []installedPackage, running string, keep int) []installedPackage {
+	sorted := append([]installedPackage{}, kernels...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareEVR(sorted[i].evr(), sorted[j].evr()) > 0
+	})
+
+	old := make([]installedPackage, 0)
+	for i, k := range sorted {
+		if i < keep || kernelRelease(k) == running {
+			continue
+		}
+		old = append(old, k)
+	}
+	return old
+}
+
+// cleanupKernels removes the kernels older than the keep newest ones and
+// returns the kernels removed, listed before and after the cleanup. The
+// cleanup is not run when the running kernel is not one of the installed
+// kernel packages, as it could not be told apart from the old ones.
+func cleanupKernels(keep int) ([]string, error) {
+	running, err := runningKernel()
+	if err != nil {
+		return nil, err
+	}
+	kernels, err := listInstalledPackages(kernelPackage)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, k := range kernels {
+		if kernelRelease(k) == running {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("running kernel %s is not an installed kernel package, do not remove the old kernels", running)
+	}
+
+	old := oldKernels(kernels, running, keep)
+	if len(old) == 0 {
+		log.WithField("component", "kernels").Infof("no old kernels to remove")
+		return nil, nil
+	}
+
+	expected := make([]string, 0, len(old))
+	for _, k := range old {
+		expected = append(expected, k.nevra())
+	}
+	log.WithFields(log.Fields{"component": "kernels", "kernels": expected}).Infof("remove old kernels")
+
+	dnf := hostUsesDnf()
+	if err := runCommand(buildKernelCleanupCommand(keep, expected, dnf)); err != nil {
+		if dnf {
+			return nil, fmt.Errorf("dnf remove did not run successfully: %v", err)
+		}
+		return nil, fmt.Errorf("package-cleanup did not run successfully: %v", err)
+	}
+
+	// the kernels still installed are listed again to report the
+	// kernels actually removed.
+	after, err := listInstalledPackages(kernelPackage)
+	if err != nil {
+		return nil, err
+	}
+	return removedKernels(kernels, after), nil
+}
+
+// removedKernels returns the kernels installed before and not after a cleanup.
+func removedKernels(before, after []installedPackage) []string {
+	installed := map[string]bool{}
+	for _, k := range after {
+		installed[k.nevra()] = true
+	}
+	removed := make([]string, 0)
+	for _, k := range before {
+		if !installed[k.nevra()] {
+			removed = append(removed, k.nevra())
+		}
+	}
+	return removed
+}
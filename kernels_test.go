@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// helperKernelsFileEnv is the file of the kernels still installed after
+// the cleanup of the helper process.
+const helperKernelsFileEnv = "YUMSECUPDATER_TEST_KERNELS_FILE"
+
+func TestOldKernels(t *testing.T) {
+	kernels := parseInstalledPackages([]byte(strings.Join(validInstalledKernels, "\n")))
+	nevras := func(kernels []installedPackage) []string {
+		s := make([]string, 0, len(kernels))
+		for _, k := range kernels {
+			s = append(s, k.nevra())
+		}
+		return s
+	}
+
+	var tests = []struct {
+		running  string
+		keep     int
+		expected []string
+	}{
+		// the running kernel is kept with the newest one
+		{validRunningKernel, 1, []string{"kernel-3.10.0-1160.6.1.el7.x86_64"}},
+		{validRunningKernel, 2, []string{}},
+		{"3.10.0-1160.45.1.el7.x86_64", 1, []string{"kernel-3.10.0-1160.6.1.el7.x86_64", "kernel-3.10.0-1160.el7.x86_64"}},
+		{"3.10.0-1160.6.1.el7.x86_64", 1, []string{"kernel-3.10.0-1160.el7.x86_64"}},
+		{validRunningKernel, 5, []string{}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, nevras(oldKernels(kernels, tt.running, tt.keep)), tt.running)
+	}
+}
+
+func TestValidateKeepKernels(t *testing.T) {
+	assert.NoError(t, validateKeepKernels(0))
+	assert.NoError(t, validateKeepKernels(2))
+	assert.Error(t, validateKeepKernels(-1))
+}
+
+func TestRemovedKernels(t *testing.T) {
+	kernels := parseInstalledPackages([]byte(strings.Join(validInstalledKernels, "\n")))
+	assert.Equal(t, []string{"kernel-3.10.0-1160.6.1.el7.x86_64"}, removedKernels(kernels, kernels[:2]))
+	assert.Empty(t, removedKernels(kernels, kernels))
+}
+
+func TestCleanupKernels(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	kernelsFile := filepath.Join(dir, "kernels")
+	os.Setenv(helperKernelsFileEnv, kernelsFile)
+	defer os.Unsetenv(helperKernelsFileEnv)
+
+	testName = testRunUpdateAvailable
+	removed, err := cleanupKernels(3)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	// the kernels are listed again after the cleanup
+	removed, err = cleanupKernels(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kernel-3.10.0-1160.6.1.el7.x86_64"}, removed)
+
+	// the removed kernel is not installed anymore
+	removed, err = cleanupKernels(1)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	assert.NoError(t, os.Remove(kernelsFile))
+	result := &RunResult{}
+	assert.NoError(t, run(Config{keepKernels: 1}, result))
+	assert.Equal(t, []string{"kernel-3.10.0-1160.6.1.el7.x86_64"}, result.RemovedKernels)
+	assert.Contains(t, result.summary("localhost"), "Kernels removed: kernel-3.10.0-1160.6.1.el7.x86_64")
+
+	// the cleanup is skipped when nothing is updated
+	assert.NoError(t, os.Remove(kernelsFile))
+	result = &RunResult{}
+	assert.NoError(t, run(Config{keepKernels: 1, pins: []versionPin{{pattern: "*", version: "0"}}}, result))
+	assert.False(t, result.Updated)
+	assert.Empty(t, result.RemovedKernels)
+	assert.NoFileExists(t, kernelsFile)
+
+	// dnf only removes the old kernels
+	var removals []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		cmd := strings.Join(args, " ")
+		if strings.Contains(cmd, "test -x /usr/bin/dnf") || strings.Contains(cmd, "dnf -y -q remove") {
+			if strings.Contains(cmd, "remove") {
+				removals = append(removals, cmd)
+				ioutil.WriteFile(kernelsFile, []byte(strings.Join(validInstalledKernels[:2], "\n")), 0644)
+			}
+			testName = testNoUpdateAvailable
+			defer func() { testName = testRunUpdateAvailable }()
+		}
+		return helperCommand(command, args...)
+	}
+	removed, err = cleanupKernels(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kernel-3.10.0-1160.6.1.el7.x86_64"}, removed)
+	assert.Len(t, removals, 1)
+	assert.True(t, strings.HasSuffix(removals[0], "dnf -y -q remove kernel-3.10.0-1160.6.1.el7.x86_64"), removals[0])
+	execCommand = helperCommand
+
+	testName = testDefaultFailure
+	_, err = cleanupKernels(1)
+	assert.Error(t, err)
+}
+
+func TestFetchMetricsInstalledKernels(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_installed_kernels{node="localhost"} 3`)
+}
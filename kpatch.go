@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// commandNotFoundExitCode is the exit code of nsenter when the
+// command does not exist on the host.
+const commandNotFoundExitCode = 127
+
+var (
+	// livepatchLoadedRegex matches a module of the loaded section of kpatch list.
+	livepatchLoadedRegex = regexp.MustCompile(`^(\S+)\s+\[enabled\]\s*$`)
+	// livepatchInstalledRegex matches a module of the installed section of kpatch list.
+	livepatchInstalledRegex = regexp.MustCompile(`^(\S+)\s+\((\S+)\)\s*$`)
+	// changelogEntryRegex matches the header of a kernel changelog entry
+	// with the version-release of the kernel.
+	changelogEntryRegex = regexp.MustCompile(`^\*.*\[(\S+)\]\s*$`)
+	cveRegex            = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+)
+
+// livepatch is a kpatch module of the host.
+type livepatch struct {
+	module, kernel string
+	loaded         bool
+}
+
+// livepatchState holds the live patches loaded in the running kernel
+// and the CVEs they fix.
+type livepatchState struct {
+	patches []livepatch
+	cves    map[string]bool
+}
+
+// covers returns true if the live patches fix all the cves.
+func (s livepatchState) covers(cves []string) bool {
+	if len(cves) == 0 {
+		return false
+	}
+	for _, cve := range cves {
+		if !s.cves[cve] {
+			return false
+		}
+	}
+	return true
+}
+
+// modules returns the names of the loaded live patches.
+func (s livepatchState) modules() []string {
+	modules := make([]string, 0, len(s.patches))
+	for _, p := range s.patches {
+		modules = append(modules, p.module)
+	}
+	return modules
+}
+
+// buildKpatchListCommand returns the exec command to list the live patches.
+func buildKpatchListCommand() *exec.Cmd {
+	cmd := []string{"kpatch", "list"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildChangelogCommand returns the exec command to get the changelog of a package.
+func buildChangelogCommand(pkg string) *exec.Cmd {
+	cmd := []string{"rpm", "-q", "--changelog", pkg}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// parseKpatchList parses the installed and loaded modules from the output of kpatch list.
+func parseKpatchList(output []byte) []livepatch {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	patches := make([]livepatch, 0)
+	loaded := make([]string, 0)
+	section := ""
+
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "Loaded patch modules:"):
+			section = "loaded"
+			continue
+		case strings.HasPrefix(line, "Installed patch modules:"):
+			section = "installed"
+			continue
+		}
+
+		if section == "loaded" {
+			if m := livepatchLoadedRegex.FindStringSubmatch(line); m != nil {
+				loaded = append(loaded, m[1])
+			}
+		}
+		if section == "installed" {
+			if m := livepatchInstalledRegex.FindStringSubmatch(line); m != nil {
+				patches = append(patches, livepatch{module: m[1], kernel: m[2]})
+			}
+		}
+	}
+
+	installed := map[string]bool{}
+	for i := range patches {
+		installed[patches[i].module] = true
+		patches[i].loaded = containsString(loaded, patches[i].module)
+	}
+	// loaded without kpatch install, like with kpatch load
+	for _, module := range loaded {
+		if !installed[module] {
+			patches = append(patches, livepatch{module: module, loaded: true})
+		}
+	}
+
+	return patches
+}
+
+// listLivepatches returns the kpatch modules, none if kpatch is not installed.
+func listLivepatches() ([]livepatch, error) {
+	result := bytes.Buffer{}
+	cmd := buildKpatchListCommand()
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == commandNotFoundExitCode {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("kpatch list did not run successfully: %v", err)
+	}
+
+	return parseKpatchList(result.Bytes()), nil
+}
+
+// kpatchPackageName returns the name of the kpatch-patch package of
+// a kernel, like kpatch-patch-3_10_0-1160_6_1 for 3.10.0-1160.6.1.el7.x86_64.
+func kpatchPackageName(kernel string) string {
+	i := strings.Index(kernel, "-")
+	if i < 0 {
+		return ""
+	}
+	version, release := kernel[:i], kernel[i+1:]
+	if j := strings.Index(release, ".el"); j >= 0 {
+		release = release[:j]
+	}
+	return fmt.Sprintf("kpatch-patch-%s-%s",
+		strings.ReplaceAll(version, ".", "_"), strings.ReplaceAll(release, ".", "_"))
+}
+
+// parseCVEs returns the CVEs mentioned in the output, without duplicates.
+func parseCVEs(output []byte) []string {
+	cves := make([]string, 0)
+	for _, cve := range cveRegex.FindAllString(string(output), -1) {
+		if !containsString(cves, cve) {
+			cves = append(cves, cve)
+		}
+	}
+	return cves
+}
+
+// parseChangelogCVEsSince returns the CVEs of the kernel changelog
+// entries newer than the since version-release.
+func parseChangelogCVEsSince(output []byte, since string) []string {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	cves := make([]string, 0)
+	newer := false
+
+	for sc.Scan() {
+		line := sc.Text()
+		if m := changelogEntryRegex.FindStringSubmatch(line); m != nil {
+			newer = compareEVR(m[1], since) > 0
+			continue
+		}
+		if !newer {
+			continue
+		}
+		for _, cve := range cveRegex.FindAllString(line, -1) {
+			if !containsString(cves, cve) {
+				cves = append(cves, cve)
+			}
+		}
+	}
+
+	return cves
+}
+
+// packageChangelog returns the changelog of an installed package.
+func packageChangelog(pkg string) ([]byte, error) {
+	result := bytes.Buffer{}
+	cmd := buildChangelogCommand(pkg)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("rpm changelog of %s did not run successfully: %v", pkg, err)
+	}
+	return result.Bytes(), nil
+}
+
+// getLivepatchState returns the live patches loaded in the running kernel
+// and the CVEs listed in the changelog of their kpatch-patch package.
+func getLivepatchState(running string) (livepatchState, error) {
+	state := livepatchState{cves: map[string]bool{}}
+
+	patches, err := listLivepatches()
+	if err != nil {
+		return state, err
+	}
+	for _, p := range patches {
+		if p.loaded {
+			state.patches = append(state.patches, p)
+		}
+	}
+	if len(state.patches) == 0 {
+		return state, nil
+	}
+
+	changelog, err := packageChangelog(kpatchPackageName(running))
+	if err != nil {
+		return state, err
+	}
+	for _, cve := range parseCVEs(changelog) {
+		state.cves[cve] = true
+	}
+
+	log.WithFields(log.Fields{"modules": state.modules(), "cves": len(state.cves)}).
+		Infof("kernel live patched")
+
+	return state, nil
+}
+
+// kernelCVEs returns the CVEs fixed by the newest installed kernel
+// since the running kernel.
+func kernelCVEs(kernel kernelInfo) ([]string, error) {
+	changelog, err := packageChangelog(fmt.Sprintf("%s-%s", kernelPackage, kernel.installed))
+	if err != nil {
+		return nil, err
+	}
+	// uname -r ends with the arch, not the changelog entries
+	running := kernel.running
+	if i := strings.LastIndex(running, "."); i >= 0 {
+		running = running[:i]
+	}
+	return parseChangelogCVEsSince(changelog, running), nil
+}
+
+// livepatchCoversReboot returns true if the kernel is the only reason
+// of the reboot and the loaded live patches fix all the CVEs of the newest
+// installed kernel, the modules of the live patches are returned.
+func livepatchCoversReboot(reasons []string, kernel kernelInfo) (bool, []string) {
+	if len(reasons) != 1 || reasons[0] != rebootReasonKernel || !kernel.outdated() {
+		return false, nil
+	}
+
+	state, err := getLivepatchState(kernel.running)
+	if err != nil {
+		log.Error(err)
+		return false, nil
+	}
+	if len(state.patches) == 0 {
+		return false, nil
+	}
+
+	cves, err := kernelCVEs(kernel)
+	if err != nil {
+		log.Error(err)
+		return false, nil
+	}
+	if !state.covers(cves) {
+		log.WithField("cves", cves).Infof("kernel CVEs not covered by the live patches")
+		return false, nil
+	}
+	return true, state.modules()
+}
+
+// mitigatedAdvisories returns the advisories of kernel packages with
+// all their CVEs fixed by the live patches.
+func mitigatedAdvisories(advisories []advisory, cves map[string][]string, state livepatchState) []advisory {
+	mitigated := make([]advisory, 0)
+	for _, a := range advisories {
+		if !strings.HasPrefix(a.pkg, kernelPackage+"-") {
+			continue
+		}
+		if state.covers(cves[a.pkg]) {
+			mitigated = append(mitigated, a)
+		}
+	}
+	return mitigated
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validKernelRebootRequired = []string{
+	"Core libraries or services have been updated since boot-up:",
+	"  * kernel",
+	"",
+	"Reboot is required to fully utilize these updates.",
+}
+
+var validKpatchList = []string{
+	"Loaded patch modules:",
+	"kpatch_3_10_0_1160_1_1 [enabled]",
+	"livepatch_test [enabled]",
+	"",
+	"Installed patch modules:",
+	"kpatch_3_10_0_1160_1_1 (3.10.0-1160.el7.x86_64)",
+	"kpatch_3_10_0_1160_6_1_1_1 (3.10.0-1160.6.1.el7.x86_64)",
+}
+
+var validKpatchChangelog = []string{
+	"* Wed Sep 08 2021 Joe Lawrence <joe.lawrence@redhat.com> [1-1.el7]",
+	"- kernel: race condition in the net scheduler [1995560] {CVE-2021-3653}",
+	"- kernel: size_t-to-int conversion in the filesystem layer [1970273] {CVE-2021-33909}",
+	"- kernel: memory corruption in net/packet [1876998] {CVE-2020-14386}",
+}
+
+var validKernelChangelog = []string{
+	"* Tue Sep 07 2021 Rado Vrbovsky <rvrbovsk@redhat.com> [3.10.0-1160.45.1.el7]",
+	"- [fs] seq_file: disallow extremely large seq buffer allocations (Ian Kent) [1975190] {CVE-2021-33909}",
+	"- [kvm] nSVM: avoid picking up unsupported bits from L2 (Jon Maloy) [1995560] {CVE-2021-3653}",
+	"",
+	"* Mon Nov 23 2020 Jan Stancek <jstancek@redhat.com> [3.10.0-1160.6.1.el7]",
+	"- [net] packet: fix overflow in tpacket_rcv (Hangbin Liu) [1876998] {CVE-2020-14386}",
+	"",
+	"* Fri Sep 18 2020 Jan Stancek <jstancek@redhat.com> [3.10.0-1160.el7]",
+	"- [fs] bootguard: secure boot bypass (Jan Stancek) [1825243] {CVE-2020-10713}",
+}
+
+var validAdvisoryCVEs = []string{
+	"CVE-2021-33909 Important/Sec. kernel-3.10.0-1160.45.1.el7.x86_64",
+	"CVE-2021-3653  Important/Sec. kernel-3.10.0-1160.45.1.el7.x86_64",
+	"CVE-2021-3156  Important/Sec. sudo-1.8.23-10.el7_9.1.x86_64",
+	"updateinfo list done",
+}
+
+const validKernelAdvisory = "RHSA-2021:3327 Important/Sec. kernel-3.10.0-1160.45.1.el7.x86_64"
+
+func TestParseKpatchList(t *testing.T) {
+	patches := parseKpatchList([]byte(strings.Join(validKpatchList, "\n")))
+	assert.Equal(t, []livepatch{
+		{module: "kpatch_3_10_0_1160_1_1", kernel: "3.10.0-1160.el7.x86_64", loaded: true},
+		{module: "kpatch_3_10_0_1160_6_1_1_1", kernel: "3.10.0-1160.6.1.el7.x86_64"},
+		{module: "livepatch_test", loaded: true},
+	}, patches)
+
+	assert.Empty(t, parseKpatchList([]byte("Loaded patch modules:\n\nInstalled patch modules:\n")))
+}
+
+func TestKpatchPackageName(t *testing.T) {
+	assert.Equal(t, "kpatch-patch-3_10_0-1160", kpatchPackageName("3.10.0-1160.el7.x86_64"))
+	assert.Equal(t, "kpatch-patch-3_10_0-1160_6_1", kpatchPackageName("3.10.0-1160.6.1.el7.x86_64"))
+	assert.Equal(t, "kpatch-patch-4_18_0-305_3_1", kpatchPackageName("4.18.0-305.3.1.el8_4.x86_64"))
+	assert.Equal(t, "", kpatchPackageName("invalid"))
+}
+
+func TestParseChangelogCVEsSince(t *testing.T) {
+	changelog := []byte(strings.Join(validKernelChangelog, "\n"))
+	assert.Equal(t, []string{"CVE-2021-33909", "CVE-2021-3653", "CVE-2020-14386"},
+		parseChangelogCVEsSince(changelog, "3.10.0-1160.el7"))
+	assert.Equal(t, []string{"CVE-2021-33909", "CVE-2021-3653"},
+		parseChangelogCVEsSince(changelog, "3.10.0-1160.6.1.el7"))
+	assert.Empty(t, parseChangelogCVEsSince(changelog, "3.10.0-1160.45.1.el7"))
+}
+
+func TestLivepatchStateCovers(t *testing.T) {
+	state := livepatchState{cves: map[string]bool{"CVE-2021-33909": true, "CVE-2021-3653": true}}
+	assert.True(t, state.covers([]string{"CVE-2021-33909"}))
+	assert.False(t, state.covers([]string{"CVE-2021-33909", "CVE-2020-14386"}))
+	assert.False(t, state.covers(nil))
+}
+
+func TestMitigatedAdvisories(t *testing.T) {
+	state := livepatchState{cves: map[string]bool{"CVE-2021-33909": true, "CVE-2021-3653": true, "CVE-2021-3156": true}}
+	cves := parseAdvisoryCVEs([]byte(strings.Join(validAdvisoryCVEs, "\n")))
+	advisories := parseAdvisories([]byte(strings.Join(append(validAdvisories, validKernelAdvisory), "\n")))
+
+	// only the kernel is live patched
+	assert.Equal(t, []advisory{
+		{id: "RHSA-2021:3327", kind: "security", severity: "Important", pkg: "kernel-3.10.0-1160.45.1.el7.x86_64"},
+	}, mitigatedAdvisories(advisories, cves, state))
+
+	delete(state.cves, "CVE-2021-3653")
+	assert.Empty(t, mitigatedAdvisories(advisories, cves, state))
+}
+
+func TestGetLivepatchState(t *testing.T) {
+	testName = testLivepatch
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	state, err := getLivepatchState(validRunningKernel)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kpatch_3_10_0_1160_1_1", "livepatch_test"}, state.modules())
+	assert.Len(t, state.cves, 3)
+
+	// no live patch loaded
+	testName = testRunUpdateAvailable
+	state, err = getLivepatchState(validRunningKernel)
+	assert.NoError(t, err)
+	assert.Empty(t, state.patches)
+}
+
+func TestRunLivepatchCoversReboot(t *testing.T) {
+	s := &recordSignaler{}
+	defer withRecordSignalers(s)()
+
+	testName = testLivepatch
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	result := &RunResult{}
+	assert.NoError(t, run(Config{}, result))
+	assert.False(t, result.RebootRequired)
+	assert.Empty(t, result.RebootReasons)
+	assert.Equal(t, []string{"kpatch_3_10_0_1160_1_1", "livepatch_test"}, result.Livepatches)
+	assert.Empty(t, s.reasons)
+	assert.Equal(t, []string{"sshd.service", "chronyd.service", "getty@tty1.service"}, result.ServicesNeedingRestart)
+
+	// the services are restarted without the reboot
+	result = &RunResult{}
+	assert.NoError(t, run(Config{restartServices: []string{"sshd"}}, result))
+	assert.Equal(t, []string{"sshd.service"}, result.RestartedServices)
+	assert.NotContains(t, result.ServicesNeedingRestart, "sshd.service")
+	assert.Empty(t, s.reasons)
+
+	// the reboot is also required for glibc and systemd
+	testName = testRunUpdateAvailable
+	assert.NoError(t, run(Config{}, &RunResult{}))
+	assert.Len(t, s.reasons, 1)
+}
+
+func TestFetchMetricsLivepatch(t *testing.T) {
+	testName = testLivepatch
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_livepatch_info{kernel="3.10.0-1160.el7.x86_64",module="kpatch_3_10_0_1160_1_1",node="localhost"} 1
+yumsecupdater_livepatch_info{kernel="",module="livepatch_test",node="localhost"} 1
+yumsecupdater_advisory_mitigated{advisory="RHSA-2021:3327",node="localhost",package="kernel-3.10.0-1160.45.1.el7.x86_64"} 1`)
+	assertMetricsNotInOutput(t, string(data), `yumsecupdater_advisory_mitigated{advisory="RHSA-2021:0343"`)
+}
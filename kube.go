@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	nodeMetadataPrefix string = "yumsecupdater/"
+
+	pendingUpdatesKey string = nodeMetadataPrefix + "pending-security-updates"
+	lastUpdateKey     string = nodeMetadataPrefix + "last-update"
+	rebootRequiredKey string = nodeMetadataPrefix + "reboot-required"
+
+	// events of cluster-scoped objects are stored in the default namespace.
+	nodeEventsNamespace string = "default"
+	eventComponent      string = "yumsecupdater"
+)
+
+// nodeLabelKeys are the keys that are also set as labels, the
+// other values are not valid label values.
+var nodeLabelKeys = map[string]struct{}{
+	pendingUpdatesKey: {},
+	rebootRequiredKey: {},
+}
+
+// NodeReporter reports the update lifecycle on the Node object
+// with events, annotations and optionally labels.
+type NodeReporter struct {
+	client   kubernetes.Interface
+	nodeName string
+	labels   bool
+}
+
+// newInClusterClient returns a kubernetes client using the service account of the pod.
+func newInClusterClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can not load in-cluster config: %v", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// newNodeReporter returns a NodeReporter for the given node.
+func newNodeReporter(client kubernetes.Interface, nodeName string, labels bool) *NodeReporter {
+	return &NodeReporter{
+		client:   client,
+		nodeName: nodeName,
+		labels:   labels,
+	}
+}
+
+// isSecurityEvent returns true if the event is about the security updates,
+// the only ones counted by the pending-security-updates annotation.
+func isSecurityEvent(e Event) bool {
+	return e.Category == "" || e.Category == categorySecurity
+}
+
+// Send implements EventSink.
+func (n *NodeReporter) Send(e Event) {
+	var err error
+
+	switch e.Reason {
+	case eventCriticalUpdatesPending, eventRunCompleted:
+		// not reported on the node
+		return
+	case eventUpdatesChecked:
+		if !isSecurityEvent(e) {
+			return
+		}
+		err = n.patchNode(map[string]string{
+			pendingUpdatesKey: strconv.Itoa(len(e.Packages)),
+		})
+	case eventUpdatesAvailable:
+		if err = n.createEvent(e); err != nil || !isSecurityEvent(e) {
+			break
+		}
+		err = n.patchNode(map[string]string{
+			pendingUpdatesKey: strconv.Itoa(len(e.Packages)),
+		})
+	case eventUpdateSucceeded:
+		if err = n.createEvent(e); err != nil {
+			break
+		}
+		err = n.patchNode(map[string]string{
+			lastUpdateKey:     e.Time.UTC().Format(time.RFC3339),
+			rebootRequiredKey: "false",
+		})
+	case eventRebootRequired:
+		if err = n.createEvent(e); err != nil {
+			break
+		}
+		err = n.patchNode(map[string]string{
+			rebootRequiredKey: "true",
+		})
+	case eventRebootCleared:
+		// only the annotation is reset, no event is recorded
+		err = n.patchNode(map[string]string{
+			rebootRequiredKey: "false",
+		})
+	default:
+		err = n.createEvent(e)
+	}
+
+	if err != nil {
+		log.WithField("component", "kube").
+			Errorf("can not report %s on node %s: %v", e.Reason, n.nodeName, err)
+	}
+}
+
+// createEvent creates a kubernetes Event on the Node object.
+func (n *NodeReporter) createEvent(e Event) error {
+	eventType := corev1.EventTypeNormal
+	if e.Reason == eventUpdateFailed || e.Reason == eventUpdateSkipped {
+		eventType = corev1.EventTypeWarning
+	}
+
+	timestamp := metav1.NewTime(e.Time)
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// same naming as the events recorded by client-go.
+			Name:      fmt.Sprintf("%s.%x", n.nodeName, time.Now().UnixNano()),
+			Namespace: nodeEventsNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       n.nodeName,
+			// the kubelet uses the node name as UID for the node events.
+			UID: types.UID(n.nodeName),
+		},
+		Reason:  e.Reason,
+		Message: e.Message,
+		Type:    eventType,
+		Source: corev1.EventSource{
+			Component: eventComponent,
+			Host:      n.nodeName,
+		},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+	}
+
+	_, err := n.client.CoreV1().Events(nodeEventsNamespace).
+		Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
+
+// patchNode sets the given annotations, and labels if enabled, on the node.
+func (n *NodeReporter) patchNode(values map[string]string) error {
+	metadata := map[string]map[string]string{
+		"annotations": values,
+	}
+	if n.labels {
+		labels := map[string]string{}
+		for k, v := range values {
+			if _, ok := nodeLabelKeys[k]; ok {
+				labels[k] = v
+			}
+		}
+		if len(labels) > 0 {
+			metadata["labels"] = labels
+		}
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+
+	_, err = n.client.CoreV1().Nodes().
+		Patch(context.TODO(), n.nodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
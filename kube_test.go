@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newFakeNodeReporter(labels bool) *NodeReporter {
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+	})
+	return newNodeReporter(client, "node1", labels)
+}
+
+func getFakeNode(t *testing.T, n *NodeReporter) *corev1.Node {
+	node, err := n.client.CoreV1().Nodes().Get(context.TODO(), n.nodeName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	return node
+}
+
+func TestNodeReporterEvents(t *testing.T) {
+	n := newFakeNodeReporter(false)
+
+	n.Send(Event{Reason: eventUpdateStarted, Message: "started", Time: time.Now()})
+	n.Send(Event{Reason: eventUpdateFailed, Message: "failed", Time: time.Now()})
+
+	events, err := n.client.CoreV1().Events(nodeEventsNamespace).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, events.Items, 2)
+
+	types := map[string]string{}
+	for _, e := range events.Items {
+		assert.Equal(t, "Node", e.InvolvedObject.Kind)
+		assert.Equal(t, "node1", e.InvolvedObject.Name)
+		assert.Equal(t, eventComponent, e.Source.Component)
+		types[e.Reason] = e.Type
+	}
+	assert.Equal(t, corev1.EventTypeNormal, types[eventUpdateStarted])
+	assert.Equal(t, corev1.EventTypeWarning, types[eventUpdateFailed])
+}
+
+func TestNodeReporterAnnotations(t *testing.T) {
+	n := newFakeNodeReporter(false)
+
+	n.Send(Event{
+		Reason:   eventUpdatesChecked,
+		Packages: make([]packageWithUpdate, 12),
+	})
+	node := getFakeNode(t, n)
+	assert.Equal(t, "12", node.Annotations[pendingUpdatesKey])
+	assert.Empty(t, node.Labels)
+
+	// the other categories do not overwrite the security updates
+	n.Send(Event{
+		Reason:   eventUpdatesChecked,
+		Category: categoryBugfix,
+		Packages: make([]packageWithUpdate, 40),
+	})
+	n.Send(Event{
+		Reason:   eventUpdatesAvailable,
+		Category: categoryEnhancement,
+		Packages: make([]packageWithUpdate, 40),
+	})
+	node = getFakeNode(t, n)
+	assert.Equal(t, "12", node.Annotations[pendingUpdatesKey])
+
+	n.Send(Event{Reason: eventRebootRequired, Time: time.Now()})
+	node = getFakeNode(t, n)
+	assert.Equal(t, "true", node.Annotations[rebootRequiredKey])
+
+	// cleared when no reboot is required anymore, without an update
+	n.Send(Event{Reason: eventRebootCleared, Time: time.Now()})
+	node = getFakeNode(t, n)
+	assert.Equal(t, "false", node.Annotations[rebootRequiredKey])
+	n.Send(Event{Reason: eventRebootRequired, Time: time.Now()})
+
+	updateTime := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	n.Send(Event{Reason: eventUpdateSucceeded, Time: updateTime})
+	node = getFakeNode(t, n)
+	assert.Equal(t, "2021-10-01T12:00:00Z", node.Annotations[lastUpdateKey])
+	assert.Equal(t, "false", node.Annotations[rebootRequiredKey])
+	assert.Equal(t, "12", node.Annotations[pendingUpdatesKey])
+}
+
+func TestNodeReporterLabels(t *testing.T) {
+	n := newFakeNodeReporter(true)
+
+	n.Send(Event{
+		Reason:   eventUpdatesChecked,
+		Packages: make([]packageWithUpdate, 3),
+	})
+	n.Send(Event{Reason: eventUpdateSucceeded, Time: time.Now()})
+
+	node := getFakeNode(t, n)
+	assert.Equal(t, "3", node.Labels[pendingUpdatesKey])
+	assert.Equal(t, "false", node.Labels[rebootRequiredKey])
+	assert.NotContains(t, node.Labels, lastUpdateKey)
+	assert.Contains(t, node.Annotations, lastUpdateKey)
+}
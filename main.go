@@ -1,35 +1,105 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/avast/retry-go/v3"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	excludePackages        string
 	updatePackages         string
 	severities             string
+	category               string
+	pins                   string
+	pinMode                string
+	includeCVEs            string
+	excludeCVEs            string
+	includeAdvisories      string
+	excludeAdvisories      string
 	updateIntervalDuration time.Duration
 
+	splay             string
+	intervalSplay     string
+	splayFromNodeName bool
+	splayDurationMax  time.Duration
+	intervalSplayMax  time.Duration
+
 	metrics                 bool
 	metricsAddr             string
 	metricsPort             string
 	metricsInterval         string
 	metricsIntervalDuration time.Duration
+	metadataMaxAge          string
+	metadataMaxAgeDuration  time.Duration
+
+	kubeEvents     bool
+	kubeNodeLabels bool
+
+	webhooksConfig string
+
+	smtpHost     string
+	smtpPort     string
+	smtpUsername string
+	smtpFrom     string
+	smtpTo       string
+	smtpStartTLS bool
+	smtpSkipNoop bool
+
+	sbomDir string
+
+	historyFile     string
+	historySize     int
+	reportDir       string
+	reportRetention int
+
+	once            bool
+	metricsTextfile string
+	pushgatewayURL  string
+
+	otelEndpoint string
+	otelProtocol string
+	otelInsecure bool
+	otelInterval string
+
+	healthStuckIntervals int
+
+	servicesToRestart string
+
+	rebootSignals        string
+	sentinelFile         string
+	sentinelCommand      string
+	rebootCoordinatorURL string
+
+	advisoryDir string
+
+	categoriesConfig string
 
 	// this is used for testing
 	execCommand = exec.Command
 	// used by exec to avoid executing yum concurrently
 	mutex = &sync.Mutex{}
+	// delay between the checks of a running yum, used for testing
+	yumRunningDelay = 10 * time.Second
+)
+
+// Modes of the updates, the yum commands applying them.
+const (
+	updateModeLatest  = "update"
+	updateModeMinimal = "update-minimal"
 )
 
 // Default values.
@@ -39,11 +109,51 @@ const (
 	defaultExcludePackages string = ""
 	defaultUpdatePackages  string = ""
 	defaultDryRun          bool   = false
+	defaultUpdateMinimal   bool   = false
+
+	defaultIncludeCVEs       string = ""
+	defaultExcludeCVEs       string = ""
+	defaultIncludeAdvisories string = ""
+	defaultExcludeAdvisories string = ""
+
+	defaultSplay             string = "0s"
+	defaultIntervalSplay     string = "0s"
+	defaultSplayFromNodeName bool   = false
 
 	defaultMetrics         bool   = true
 	defaultMetricsAddr     string = "0.0.0.0"
 	defaultMetricsPort     string = "9080"
 	defaultMetricsInterval string = "1h"
+	defaultMetadataMaxAge  string = "0s"
+
+	defaultKubeEvents     bool = false
+	defaultKubeNodeLabels bool = false
+
+	defaultWebhooksConfig string = ""
+
+	defaultSMTPHost     string = ""
+	defaultSMTPPort     string = "587"
+	defaultSMTPUsername string = ""
+	defaultSMTPFrom     string = ""
+	defaultSMTPTo       string = ""
+	defaultSMTPStartTLS bool   = true
+	defaultSMTPSkipNoop bool   = false
+
+	defaultSBOMDir string = ""
+
+	defaultReportDir       string = ""
+	defaultReportRetention int    = 30
+
+	defaultOnce            bool   = false
+	defaultMetricsTextfile string = ""
+	defaultPushgatewayURL  string = ""
+
+	defaultOTelEndpoint string = ""
+	defaultOTelProtocol string = otelProtocolGRPC
+	defaultOTelInsecure bool   = false
+	defaultOTelInterval string = "1m"
+
+	defaultHealthStuckIntervals int = 3
 )
 
 const (
@@ -51,19 +161,67 @@ const (
 	yumPID                       = "/var/run/yum.pid"
 	yumNeedUpdateExitCode int    = 100
 	requireRebootExitCode int    = 1
-
-	sentinelFile string = "/var/run/reboot-required"
 )
 
 // Config holds the general config.
 type Config struct {
 	dryRun          bool
+	updateMinimal   bool
 	excludePackages []string
 	updatePackages  []string
 	severities      []string
+	restartServices []string
+	// category selects the advisories of the updates, security if empty.
+	category string
+	// pins hold back the updates beyond their versions, enforced
+	// according to the pinMode.
+	pins    []versionPin
+	pinMode string
+	// pinTargets are the name-[epoch:]version-release.arch of the newest
+	// versions allowed by the pins, updated to on their own.
+	pinTargets []string
+	// preflightChecks are run before the updates, which are skipped
+	// when one of them fails.
+	preflightChecks []string
+	minFreeSpace    []freeSpaceThreshold
+	// keepKernels is the number of the newest kernels kept by the
+	// cleanup after the updates, the cleanup is disabled if 0.
+	keepKernels int
+	// cacheOnly restricts the checks to the cached metadata.
+	cacheOnly bool
+
+	// includeCVEs and includeAdvisories select exactly these updates
+	// instead of the security updates of the severities.
+	includeCVEs       []string
+	includeAdvisories []string
+	excludeCVEs       []string
+	excludeAdvisories []string
 }
 
 func main() {
+	command, args := parseCommand(os.Args[1:])
+
+	switch command {
+	case daemonCmd:
+		daemonCommand(args)
+	case checkCmd:
+		os.Exit(checkCommand(args, os.Stdout))
+	case planCmd:
+		os.Exit(planCommand(args, os.Stdout))
+	case updateCmd:
+		os.Exit(updateCommand(args, os.Stdout))
+	case statusCmd:
+		os.Exit(statusCommand(args, os.Stdout))
+	case reportCmd:
+		os.Exit(reportCommand(args, os.Stdout))
+	default:
+		printUsage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+}
+
+// daemonCommand runs the updates and the metrics periodically.
+func daemonCommand(args []string) {
 	var (
 		config         = Config{}
 		updateInverval string
@@ -71,47 +229,245 @@ func main() {
 		wg sync.WaitGroup
 	)
 
-	flag.StringVar(&excludePackages, "exclude-packages", defaultExcludePackages, "Names of packages to exclude separated with a comma")
-	flag.StringVar(&updatePackages, "update-packages", defaultUpdatePackages, "Names of packages to specifically update separated with a comma, default to all")
-	flag.StringVar(&severities, "severities", defaultSeverities, "Security severities to include separated with a comma, allowed values: Low,Moderate,Medium,Important,Critical")
-	flag.StringVar(&updateInverval, "interval", defaultUpdateInterval, "Interval between updates")
-	flag.BoolVar(&metrics, "metrics", defaultMetrics, "Enable metrics exporter")
-	flag.StringVar(&metricsAddr, "metrics-addr", defaultMetricsAddr, "IP Address to expose the http metrics")
-	flag.StringVar(&metricsPort, "metrics-port", defaultMetricsPort, "Port to expose the http metrics")
-	flag.StringVar(&metricsInterval, "metrics-interval", defaultMetricsInterval, "Interval between metrics checks")
-	flag.BoolVar(&config.dryRun, "dry-run", defaultDryRun, "Enable dry-run mode, do not run any update")
-	flag.Parse()
-
-	config.excludePackages = parseCommaSeparatedFlagValues(excludePackages)
-	config.updatePackages = parseCommaSeparatedFlagValues(updatePackages)
-
-	config.severities = parseCommaSeparatedFlagValues(severities)
-	for _, s := range config.severities {
-		if err := validateSeverity(s); err != nil {
-			log.Fatal(err)
-		}
+	fs := flag.NewFlagSet(daemonCmd, flag.ExitOnError)
+	addYumFlags(fs, &config)
+	addPreflightFlags(fs)
+	fs.BoolVar(&config.dryRun, "dry-run", defaultDryRun, "Enable dry-run mode, do not run any update")
+	fs.BoolVar(&config.updateMinimal, "update-minimal", defaultUpdateMinimal, "Install the lowest versions fixing the advisories with yum update-minimal instead of the newest versions")
+	fs.IntVar(&config.keepKernels, "keep-kernels", defaultKeepKernels, "Number of the newest kernels kept with the running kernel by the cleanup after the updates, disabled if 0")
+	fs.StringVar(&updateInverval, "interval", defaultUpdateInterval, "Interval between updates")
+	fs.StringVar(&splay, "splay", defaultSplay, "Maximum random delay before the first update and metrics checks")
+	fs.StringVar(&intervalSplay, "interval-splay", defaultIntervalSplay, "Maximum random delay added to every update and metrics interval")
+	fs.BoolVar(&splayFromNodeName, "splay-from-node-name", defaultSplayFromNodeName, "Derive the splay delays from a hash of the node name so they are stable across restarts")
+	fs.BoolVar(&metrics, "metrics", defaultMetrics, "Enable metrics exporter")
+	fs.StringVar(&metricsAddr, "metrics-addr", defaultMetricsAddr, "IP Address to expose the http metrics")
+	fs.StringVar(&metricsPort, "metrics-port", defaultMetricsPort, "Port to expose the http metrics")
+	fs.StringVar(&metricsInterval, "metrics-interval", defaultMetricsInterval, "Interval between metrics checks")
+	fs.StringVar(&metadataMaxAge, "metadata-max-age", defaultMetadataMaxAge, "Maximum age of the cached metadata of the repositories, refreshed with yum makecache before the metrics checks which then only use the cache, disabled if 0s")
+	fs.BoolVar(&kubeEvents, "kube-events", defaultKubeEvents, "Emit Kubernetes events and maintain annotations on the Node object")
+	fs.BoolVar(&kubeNodeLabels, "kube-node-labels", defaultKubeNodeLabels, "Also maintain labels on the Node object, requires -kube-events")
+	fs.StringVar(&webhooksConfig, "webhooks-config", defaultWebhooksConfig, "Path to a JSON file with the webhooks to notify")
+	fs.StringVar(&smtpHost, "smtp-host", defaultSMTPHost, "SMTP server used to send a summary of every run, disabled if empty")
+	fs.StringVar(&smtpPort, "smtp-port", defaultSMTPPort, "SMTP server port")
+	fs.StringVar(&smtpUsername, "smtp-username", defaultSMTPUsername, "SMTP username, the password is read from "+smtpPasswordEnv)
+	fs.StringVar(&smtpFrom, "smtp-from", defaultSMTPFrom, "Sender of the run summary")
+	fs.StringVar(&smtpTo, "smtp-to", defaultSMTPTo, "Recipients of the run summary separated with a comma")
+	fs.BoolVar(&smtpStartTLS, "smtp-starttls", defaultSMTPStartTLS, "Use STARTTLS to connect to the SMTP server")
+	fs.BoolVar(&smtpSkipNoop, "smtp-skip-up-to-date", defaultSMTPSkipNoop, "Do not send the run summary when nothing was updated")
+	fs.StringVar(&sbomDir, "sbom-dir", defaultSBOMDir, "Directory of the container where the CycloneDX and SPDX SBOMs are written after each update, disabled if empty")
+	fs.StringVar(&historyFile, "history-file", defaultHistoryFile, "File where the history of the runs is persisted, kept in memory only if empty")
+	fs.IntVar(&historySize, "history-size", defaultHistorySize, "Number of runs kept in the history")
+	fs.StringVar(&reportDir, "report-dir", defaultReportDir, "Directory where a JSON report of every run is written, disabled if empty")
+	fs.IntVar(&reportRetention, "report-retention", defaultReportRetention, "Number of reports of each advisory category kept in -report-dir, the older ones are removed, all kept if 0")
+	fs.BoolVar(&once, "once", defaultOnce, "Run the updates a single time and exit with the result of the run, for a CronJob or a systemd timer")
+	fs.StringVar(&metricsTextfile, "metrics-textfile", defaultMetricsTextfile, "Path of a node_exporter textfile collector file where the metrics are written after every check, disabled if empty")
+	fs.StringVar(&pushgatewayURL, "pushgateway-url", defaultPushgatewayURL, "URL of a Pushgateway where the metrics are pushed in -once mode")
+	fs.StringVar(&otelEndpoint, "otel-endpoint", defaultOTelEndpoint, "Endpoint host:port of an OpenTelemetry collector where the traces of the runs and the metrics are exported, disabled if empty")
+	fs.StringVar(&otelProtocol, "otel-protocol", defaultOTelProtocol, "OTLP protocol used to export to the OpenTelemetry collector, allowed values: grpc,http")
+	fs.BoolVar(&otelInsecure, "otel-insecure", defaultOTelInsecure, "Disable TLS to export to the OpenTelemetry collector")
+	fs.StringVar(&otelInterval, "otel-interval", defaultOTelInterval, "Interval between exports of the metrics to the OpenTelemetry collector")
+	fs.IntVar(&healthStuckIntervals, "health-stuck-intervals", defaultHealthStuckIntervals, "Number of update intervals without activity of a run loop after which /healthz fails")
+	fs.StringVar(&servicesToRestart, "restart-services", defaultRestartServices, "Systemd services restarted when they need it and no reboot is required, separated with a comma")
+	fs.StringVar(&rebootSignals, "reboot-signals", defaultRebootSignals, "Targets signaled when a reboot is required separated with a comma, allowed values: file,command,node,coordinator")
+	fs.StringVar(&sentinelFile, "sentinel-file", defaultSentinelFile, "Sentinel file created on the host when a reboot is required")
+	fs.StringVar(&sentinelCommand, "sentinel-command", defaultSentinelCommand, "Command run on the host when a reboot is required, the reasons are in "+rebootReasonsEnv)
+	fs.StringVar(&rebootCoordinatorURL, "reboot-coordinator-url", defaultRebootCoordinator, "URL of a reboot-coordinator where the reboot is requested with a POST and withdrawn with a DELETE")
+	fs.StringVar(&advisoryDir, "advisory-dir", defaultAdvisoryDir, "Directory with Red Hat OVAL (.xml, .xml.bz2) or CSAF/VEX (.json) files matched against the installed packages after every check, disabled if empty")
+	fs.StringVar(&categoriesConfig, "categories-config", defaultCategoriesConfig, "Path to a JSON file with the policies of the other advisory categories, each updated on its own schedule")
+	fs.Parse(args)
+
+	if err := parseYumFlags(&config); err != nil {
+		log.Fatal(err)
+	}
+	if err := parsePreflightFlags(&config); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateKeepKernels(config.keepKernels); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateReportRetention(reportRetention); err != nil {
+		log.Fatal(err)
 	}
+	config.restartServices = parseCommaSeparatedFlagValues(servicesToRestart)
 
-	updateIntervalDuration, err := parseDurationString(updateInverval)
+	var err error
+	updateIntervalDuration, err = parseDurationString(updateInverval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metricsIntervalDuration, err = parseDurationString(metricsInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	metadataMaxAgeDuration, err = parseDurationString(metadataMaxAge)
+	if err != nil {
+		log.Fatal(err)
+	}
+	splayDurationMax, err = parseDurationString(splay)
 	if err != nil {
 		log.Fatal(err)
 	}
-	metricsIntervalDuration, err := parseDurationString(metricsInterval)
+	intervalSplayMax, err = parseDurationString(intervalSplay)
 	if err != nil {
 		log.Fatal(err)
 	}
+	otelIntervalDuration, err := parseDurationString(otelInterval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := validateOTelProtocol(otelProtocol); err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		categoryPolicies  []CategoryPolicy
+		categoryConfigs   []Config
+		categoryIntervals []time.Duration
+	)
+	if categoriesConfig != "" {
+		categoryPolicies, err = loadCategoriesConfig(categoriesConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		categoryConfigs, categoryIntervals, err = newCategoryConfigs(categoryPolicies, config, updateIntervalDuration)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	daemonStatus.setConfig(StatusConfig{
+		DryRun:            config.dryRun,
+		UpdateMode:        updateMode(config),
+		Category:          updateCategory(config),
+		CategoryPolicies:  categoryPolicies,
+		ExcludePackages:   config.excludePackages,
+		UpdatePackages:    config.updatePackages,
+		Severities:        config.severities,
+		Pins:              pinStrings(config.pins),
+		PinMode:           config.pinMode,
+		CVEs:              config.includeCVEs,
+		ExcludeCVEs:       config.excludeCVEs,
+		Advisories:        config.includeAdvisories,
+		ExcludeAdvisories: config.excludeAdvisories,
+		RestartServices:   config.restartServices,
+		PreflightChecks:   config.preflightChecks,
+		KeepKernels:       config.keepKernels,
+		Interval:          updateIntervalDuration.String(),
+		IntervalSplay:     intervalSplayMax.String(),
+		Splay:             splayDurationMax.String(),
+		MetricsInterval:   metricsIntervalDuration.String(),
+		MetadataMaxAge:    metadataMaxAgeDuration.String(),
+	})
+	// a wait of a run loop lasts at most its interval and the splays.
+	daemonStatus.setStuckAfter(updateCategory(config), time.Duration(healthStuckIntervals)*(updateIntervalDuration+intervalSplayMax+splayDurationMax))
+	for i, c := range categoryConfigs {
+		daemonStatus.setStuckAfter(c.category, time.Duration(healthStuckIntervals)*(categoryIntervals[i]+intervalSplayMax+splayDurationMax))
+	}
 
 	hostname := os.Getenv(nodeIDEnv)
 	if hostname == "" {
 		log.Fatal("Environment variable YUMSECUPDATER_NODE_ID not found.")
 	}
 
+	runHistory = newHistory(historySize, historyFile)
+	if err := runHistory.load(); err != nil {
+		log.Fatal(err)
+	}
+	eventSinks = append(eventSinks, runHistory)
+
+	if reportDir != "" {
+		eventSinks = append(eventSinks, newReportWriter(reportDir, hostname, reportRetention))
+	}
+
+	if kubeEvents {
+		client, err := newInClusterClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventSinks = append(eventSinks, newNodeReporter(client, hostname, kubeNodeLabels))
+	}
+
+	if webhooksConfig != "" {
+		configs, err := loadWebhooksConfig(webhooksConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, c := range configs {
+			webhook, err := newWebhook(c, hostname)
+			if err != nil {
+				log.Fatal(err)
+			}
+			eventSinks = append(eventSinks, webhook)
+		}
+	}
+
+	if smtpHost != "" {
+		notifier, err := newSMTPNotifier(SMTPConfig{
+			host:     smtpHost,
+			port:     smtpPort,
+			username: smtpUsername,
+			password: os.Getenv(smtpPasswordEnv),
+			from:     smtpFrom,
+			to:       parseCommaSeparatedFlagValues(smtpTo),
+			startTLS: smtpStartTLS,
+			skipNoop: smtpSkipNoop,
+		}, hostname)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventSinks = append(eventSinks, notifier)
+	}
+
+	sbomWriter = newSBOMWriter(sbomDir, hostname)
+	if sbomDir != "" || metrics {
+		eventSinks = append(eventSinks, sbomWriter)
+	}
+
+	rebootSignalers = nil
+	for _, signal := range parseCommaSeparatedFlagValues(rebootSignals) {
+		signaler, err := newRebootSignaler(signal, hostname)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rebootSignalers = append(rebootSignalers, signaler)
+	}
+
+	var otelExporter *OTelExporter
+	if otelEndpoint != "" {
+		otelExporter, err = newOTelExporter(context.Background(), OTelConfig{
+			endpoint: otelEndpoint,
+			protocol: otelProtocol,
+			insecure: otelInsecure,
+			interval: otelIntervalDuration,
+		}, hostname)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if once {
+		if len(categoryConfigs) > 0 {
+			log.Warn("the categories config is ignored in once mode, use -category instead")
+		}
+		os.Exit(onceMode(config, hostname, otelExporter))
+	}
+
+	// spread the first runs of all the nodes to avoid hitting
+	// the repositories at the same time.
+	startSplay := splayDuration(splayDurationMax, hostname+"/start", splayFromNodeName)
+
 	sigs := make(chan os.Signal, 1)
 	exitRun := make(chan struct{}, 1)
 	exitMetrics := make(chan struct{}, 1)
+	// closed to stop the run loops of all the category policies.
+	exitCategoryRuns := make(chan struct{})
 
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	// the metrics are collected to be served over http,
+	// written to the textfile and/or exported with otel.
+	collectMetrics := metrics || metricsTextfile != "" || otelExporter != nil
+
 	// handle shutdown gracefully
 	wg.Add(1)
 	go func() {
@@ -122,7 +478,8 @@ func main() {
 			Infof("graceful shutdown")
 
 		exitRun <- struct{}{}
-		if metrics {
+		close(exitCategoryRuns)
+		if collectMetrics {
 			exitMetrics <- struct{}{}
 		}
 
@@ -133,62 +490,205 @@ func main() {
 	}()
 
 	var metricsServer *MetricsServer
-	if metrics {
-		var err error
+	if collectMetrics {
 		metricsServer, err = newMetricsServer(hostname, metricsAddr, metricsPort)
 		if err != nil {
 			log.Fatalf("can not create a metrics server: %v", err)
 		}
-		wg.Add(1)
-		go func() {
-			if err := metricsServer.startServer(); err != nil {
+		metricsServer.textfile = metricsTextfile
+		metricsServer.advisoryDir = advisoryDir
+		metricsServer.metadataMaxAge = metadataMaxAgeDuration
+		eventSinks = append(eventSinks, metricsServer)
+		if otelExporter != nil {
+			if err := otelExporter.exportMetrics(context.Background(), metricsServer.registry); err != nil {
 				log.Fatal(err)
 			}
-		}()
+		}
+		if metrics {
+			wg.Add(1)
+			go func() {
+				if err := metricsServer.startServer(); err != nil {
+					log.Fatal(err)
+				}
+			}()
+			// the SBOM served is generated once on start, then after each update.
+			go func() {
+				if err := sbomWriter.write(); err != nil {
+					log.WithField("component", "sbom").Error(err)
+				}
+			}()
+		}
 
-		// run it once before the next timer
-		metricsServer.fetchMetrics(config)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			next := startSplay
 			for {
+				daemonStatus.setNextMetricsRun(time.Now().Add(next))
 				select {
 				case <-exitMetrics:
-					metricsServer.stopServer()
-					wg.Done()
+					if metrics {
+						metricsServer.stopServer()
+						wg.Done()
+					}
 					return
-				case <-time.After(metricsIntervalDuration):
-					metricsServer.fetchMetrics(config)
+				case <-time.After(next):
+					metricsServer.fetchMetrics(append([]Config{config}, categoryConfigs...)...)
+					daemonStatus.setReady()
+					next = metricsIntervalDuration + intervalSplayDuration(hostname+"/metrics")
 				}
 			}
 		}()
 	}
 
-	// run it once before the next timer
-	runWithRetry(config)
-	if metrics {
-		metricsServer.fetchMetrics(config)
-	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		next := startSplay
 		for {
+			daemonStatus.beat(updateCategory(config))
+			nextRun := time.Now().Add(next)
+			daemonStatus.setNextRun(nextRun)
+			log.Infof("next update check on %s", nextRun.Format("2006-01-02 15:04:05"))
 			select {
 			case <-exitRun:
 				return
-			case <-time.After(updateIntervalDuration):
+			case <-time.After(next):
 				runWithRetry(config)
-				if metrics {
-					metricsServer.fetchMetrics(config)
+				if collectMetrics {
+					metricsServer.fetchUpdateMetrics(config)
 				}
+				daemonStatus.setReady()
+				next = updateIntervalDuration + intervalSplayDuration(hostname+"/update")
 			}
 		}
 	}()
 
+	// the other categories are updated on their own schedule.
+	for i := range categoryConfigs {
+		wg.Add(1)
+		go func(c Config, interval time.Duration) {
+			defer wg.Done()
+			logger := log.WithField("category", c.category)
+			seed := hostname + "/update/" + c.category
+			next := startSplay
+			for {
+				daemonStatus.beat(c.category)
+				logger.Infof("next update check on %s", time.Now().Add(next).Format("2006-01-02 15:04:05"))
+				select {
+				case <-exitCategoryRuns:
+					return
+				case <-time.After(next):
+					runWithRetry(c)
+					if collectMetrics {
+						metricsServer.fetchUpdateMetrics(c)
+					}
+					next = interval + intervalSplayDuration(seed)
+				}
+			}
+		}(categoryConfigs[i], categoryIntervals[i])
+	}
+
 	wg.Wait()
+	flushEvents()
+	if otelExporter != nil {
+		otelExporter.shutdown(context.Background())
+	}
 	log.Info("exit")
 }
 
+// newRebootSignaler returns the RebootSignaler of a reboot signal target.
+func newRebootSignaler(signal, hostname string) (RebootSignaler, error) {
+	if err := validateRebootSignal(signal); err != nil {
+		return nil, err
+	}
+
+	switch signal {
+	case rebootSignalCommand:
+		return newCommandSignaler(sentinelCommand)
+	case rebootSignalNode:
+		client, err := newInClusterClient()
+		if err != nil {
+			return nil, err
+		}
+		return newNodeSignaler(newNodeReporter(client, hostname, kubeNodeLabels)), nil
+	case rebootSignalCoordinator:
+		if rebootCoordinatorURL == "" {
+			return nil, fmt.Errorf("reboot coordinator url is missing")
+		}
+		return newCoordinatorSignaler(rebootCoordinatorURL, hostname), nil
+	default:
+		return newSentinelFileSignaler(sentinelFile), nil
+	}
+}
+
+// addYumFlags adds the flags that select the updates to a flag set.
+func addYumFlags(fs *flag.FlagSet, config *Config) {
+	fs.StringVar(&excludePackages, "exclude-packages", defaultExcludePackages, "Names of packages to exclude separated with a comma")
+	fs.StringVar(&updatePackages, "update-packages", defaultUpdatePackages, "Names of packages to specifically update separated with a comma, default to all")
+	fs.StringVar(&severities, "severities", defaultSeverities, "Security severities to include separated with a comma, allowed values: Low,Moderate,Medium,Important,Critical")
+	fs.StringVar(&category, "category", defaultCategory, "Category of the advisories to update, allowed values: security,bugfix,enhancement,all")
+	fs.StringVar(&includeCVEs, "cves", defaultIncludeCVEs, "CVEs to update separated with a comma, only the updates of these CVEs and -advisories are applied when set")
+	fs.StringVar(&excludeCVEs, "exclude-cves", defaultExcludeCVEs, "CVEs never updated separated with a comma, the packages they fix are excluded")
+	fs.StringVar(&includeAdvisories, "advisories", defaultIncludeAdvisories, "Advisories to update separated with a comma, only the updates of these advisories and -cves are applied when set")
+	fs.StringVar(&excludeAdvisories, "exclude-advisories", defaultExcludeAdvisories, "Advisories never updated separated with a comma, the packages they fix are excluded")
+	fs.StringVar(&pins, "pins", defaultPins, "Version constraints of packages separated with a comma, like docker-ce<=20.10.7 or containerd.io=1.4.6, the updates beyond them are held back")
+	fs.StringVar(&pinMode, "pin-mode", defaultPinMode, "How the pins are enforced, allowed values: plan,versionlock")
+}
+
+// parseYumFlags parses the values of the flags added by addYumFlags into the config.
+func parseYumFlags(config *Config) error {
+	config.excludePackages = parseCommaSeparatedFlagValues(excludePackages)
+	config.updatePackages = parseCommaSeparatedFlagValues(updatePackages)
+
+	if err := validateCategory(category); err != nil {
+		return err
+	}
+	config.category = category
+
+	config.severities = parseCommaSeparatedFlagValues(severities)
+	for _, s := range config.severities {
+		if err := validateSeverity(s); err != nil {
+			return err
+		}
+	}
+
+	config.includeCVEs = parseCommaSeparatedFlagValues(includeCVEs)
+	config.excludeCVEs = parseCommaSeparatedFlagValues(excludeCVEs)
+	for _, cves := range [][]string{config.includeCVEs, config.excludeCVEs} {
+		for _, cve := range cves {
+			if err := validateCVE(cve); err != nil {
+				return err
+			}
+		}
+	}
+
+	config.includeAdvisories = parseCommaSeparatedFlagValues(includeAdvisories)
+	config.excludeAdvisories = parseCommaSeparatedFlagValues(excludeAdvisories)
+	for _, advisories := range [][]string{config.includeAdvisories, config.excludeAdvisories} {
+		for _, a := range advisories {
+			if err := validateAdvisory(a); err != nil {
+				return err
+			}
+		}
+	}
+
+	config.pins = []versionPin{}
+	for _, s := range parseCommaSeparatedFlagValues(pins) {
+		pin, err := parsePin(s)
+		if err != nil {
+			return err
+		}
+		config.pins = append(config.pins, pin)
+	}
+	if err := validatePinMode(pinMode); err != nil {
+		return err
+	}
+	config.pinMode = pinMode
+
+	return nil
+}
+
 // ensureYumIsNotRunning is a wrapper to retry the yum check.
 func ensureYumIsNotRunning() error {
 	return retry.Do(
@@ -199,16 +699,45 @@ func ensureYumIsNotRunning() error {
 			log.Info("yum is currently running, waiting 10s...")
 			return fmt.Errorf("yum is running")
 		},
-		retry.Delay(10*time.Second),
+		retry.Delay(yumRunningDelay),
 		retry.Attempts(30),
 	)
 }
 
+// waitForYum waits for the yum of the host and for the commands of the
+// other run loops to end. The run loop of the category is waiting for yum
+// meanwhile, then back to its phase.
+func waitForYum(loop, phase string) error {
+	if !isYumRunning() && mutex.TryLock() {
+		mutex.Unlock()
+		return nil
+	}
+
+	daemonStatus.setPhase(loop, phaseWaitingForYum)
+	defer daemonStatus.setPhase(loop, phase)
+
+	if err := ensureYumIsNotRunning(); err != nil {
+		return err
+	}
+	mutex.Lock()
+	mutex.Unlock()
+	return nil
+}
+
 // runWithRetry is a wrapper to retry the standard run.
-func runWithRetry(config Config) {
+func runWithRetry(config Config) *RunResult {
+	result := newRunResult(config)
+	errs := []string{}
+
 	err := retry.Do(
 		func() error {
-			return run(config)
+			daemonStatus.beat(updateCategory(config))
+			result = newRunResult(config)
+			err := run(config, result)
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			return err
 		},
 		retry.Delay(30*time.Minute),
 		retry.Attempts(10),
@@ -217,48 +746,250 @@ func runWithRetry(config Config) {
 		log.Error(err)
 	}
 
-	log.Infof("done, next update check on %s",
-		time.Now().
-			Add(updateIntervalDuration).
-			Format("2006-01-02 15:04:05"))
+	result.End = time.Now()
+	result.Errors = errs
+	result.Failed = err != nil
+	sendEvent(Event{
+		Reason:  eventRunCompleted,
+		Message: result.String(),
+		Result:  result,
+	})
+
+	log.Infof("done")
+
+	return result
+}
+
+// runOnce runs the updates a single time without retry.
+func runOnce(config Config) *RunResult {
+	result := newRunResult(config)
+	err := run(config, result)
+	result.End = time.Now()
+	if err != nil {
+		log.Error(err)
+		result.Failed = true
+		result.Errors = []string{err.Error()}
+	}
+	sendEvent(Event{
+		Reason:  eventRunCompleted,
+		Message: result.String(),
+		Result:  result,
+	})
+
+	log.Infof("done")
+
+	return result
+}
+
+// intervalSplayDuration returns the delay to add to the next interval.
+func intervalSplayDuration(seed string) time.Duration {
+	return splayDuration(intervalSplayMax, seed, splayFromNodeName)
 }
 
 // run is a wrapper that holds the logic of a standard run.
-func run(config Config) error {
-	updatesAvailable, err := updatesAvailable(config)
+func run(config Config, result *RunResult) error {
+	ctx, span := tracer.Start(context.Background(), "run", trace.WithAttributes(
+		attribute.Bool("dry_run", config.dryRun),
+		attribute.String("category", updateCategory(config)),
+	))
+	loop := updateCategory(config)
+	daemonStatus.setPhase(loop, phaseChecking)
+	defer func() {
+		daemonStatus.setPhase(loop, phaseIdle)
+		span.SetAttributes(
+			attribute.Int("packages.count", len(result.Packages)),
+			attribute.Bool("updated", result.Updated),
+			attribute.Bool("reboot_required", result.RebootRequired),
+		)
+		span.End()
+	}()
+
+	if err := waitForYum(loop, phaseChecking); err != nil {
+		return err
+	}
+
+	config, err := excludeAdvisoryPackages(config)
+	if err != nil {
+		return err
+	}
+
+	_, checkSpan := tracer.Start(ctx, "check-update")
+	available, packagesWithUpdates, err := updatesAvailable(config)
+	checkSpan.SetAttributes(attribute.Int("packages.count", len(packagesWithUpdates)))
 	if err != nil {
+		endSpan(checkSpan, commandExitCode(err), err)
 		return err
 	}
+	if len(config.pins) > 0 {
+		var pinned []pinnedPackage
+		packagesWithUpdates, pinned = applyPins(config.pins, packagesWithUpdates)
+		result.Pinned = pinnedPackages(pinned)
+		var targets []packageWithUpdate
+		config, targets, err = enforcePins(config, pinned)
+		if err != nil {
+			endSpan(checkSpan, commandExitCode(err), err)
+			return err
+		}
+		packagesWithUpdates = append(packagesWithUpdates, targets...)
+	}
+	result.Packages = packagesWithUpdates
+	if len(config.pins) > 0 && len(packagesWithUpdates) == 0 {
+		// all the updates are held back by the pins.
+		available = false
+	}
+	if available {
+		endSpan(checkSpan, yumNeedUpdateExitCode, nil)
+	} else {
+		endSpan(checkSpan, 0, nil)
+	}
+
+	if available {
+		advisories, err := listAdvisories(config)
+		if err != nil {
+			log.Error(err)
+		}
+		result.Advisories = advisories
+
+		notify(ctx, Event{
+			Reason:   eventUpdatesAvailable,
+			Message:  fmt.Sprintf("%s are available", categoryUpdates(updateCategory(config))),
+			Category: updateCategory(config),
+			Packages: packagesWithUpdates,
+		})
+
+		if hasSeverity(advisories, "Critical") {
+			notify(ctx, Event{
+				Reason:   eventCriticalUpdatesPending,
+				Message:  "Critical security updates are pending",
+				Packages: packagesWithUpdates,
+			})
+		}
+	}
 
 	if config.dryRun {
 		log.Info("dry-run mode enabled, do not update")
 		return nil
 	}
 
-	if updatesAvailable {
-		if err := runUpdates(config); err != nil {
+	if available && len(config.preflightChecks) > 0 {
+		_, preflightSpan := tracer.Start(ctx, "preflight")
+		result.Preflight = runPreflightChecks(config)
+		failed := failedPreflightChecks(result.Preflight)
+		preflightSpan.SetAttributes(attribute.StringSlice("failed", failed))
+		endSpan(preflightSpan, 0, nil)
+		if len(failed) > 0 {
+			result.Skipped = true
+			notify(ctx, Event{
+				Reason:   eventUpdateSkipped,
+				Message:  fmt.Sprintf("%s skipped, preflight checks failed: %s", categoryUpdates(updateCategory(config)), strings.Join(failed, ",")),
+				Packages: packagesWithUpdates,
+			})
+		}
+	}
+
+	if available && !result.Skipped {
+		notify(ctx, Event{
+			Reason:  eventUpdateStarted,
+			Message: fmt.Sprintf("%s started", categoryUpdates(updateCategory(config))),
+		})
+		if err := waitForYum(loop, phaseUpdating); err != nil {
+			return err
+		}
+		daemonStatus.setPhase(loop, phaseUpdating)
+		_, updateSpan := tracer.Start(ctx, "update", trace.WithAttributes(
+			attribute.Int("packages.count", len(packagesWithUpdates)),
+			attribute.String("mode", updateMode(config)),
+		))
+		diff, err := runUpdates(config)
+		endSpan(updateSpan, commandExitCode(err), err)
+		if err != nil {
+			notify(ctx, Event{
+				Reason:  eventUpdateFailed,
+				Message: fmt.Sprintf("%s failed: %v", categoryUpdates(updateCategory(config)), err),
+			})
 			return err
 		}
+		result.Updated = true
+		result.Diff = diff
+		notify(ctx, Event{
+			Reason:   eventUpdateSucceeded,
+			Message:  fmt.Sprintf("%s succeeded", categoryUpdates(updateCategory(config))),
+			Packages: packagesWithUpdates,
+		})
+	}
+
+	// the kernels only change with the updates.
+	if config.keepKernels > 0 && result.Updated {
+		_, cleanupSpan := tracer.Start(ctx, "kernel-cleanup")
+		removed, err := cleanupKernels(config.keepKernels)
+		cleanupSpan.SetAttributes(attribute.Int("kernels.removed", len(removed)))
+		endSpan(cleanupSpan, commandExitCode(err), err)
+		// the updates are applied, a failed cleanup is retried on the next run.
+		if err != nil {
+			log.Error(err)
+		}
+		result.RemovedKernels = removed
 	}
 
 	// Even if no updates are availabe, server may still
 	// need to be rebooted.
-	rebootRequired, err := requireReboot()
+	daemonStatus.setPhase(loop, phaseChecking)
+	_, rebootSpan := tracer.Start(ctx, "needs-restarting")
+	rebootRequired, rebootPackages, err := requireReboot()
+	rebootSpan.SetAttributes(attribute.Bool("reboot_required", rebootRequired))
 	if err != nil {
+		endSpan(rebootSpan, commandExitCode(err), err)
 		return err
 	}
+	if rebootRequired {
+		endSpan(rebootSpan, requireRebootExitCode, nil)
+	} else {
+		endSpan(rebootSpan, 0, nil)
+	}
+
 	if !rebootRequired {
+		checkServices(ctx, config, result, false)
+		clearStaleRebootSignals()
+		return nil
+	}
+	reasons, kernel := classifyReboot(rebootPackages)
+	if covered, modules := livepatchCoversReboot(reasons, kernel); covered {
+		log.WithField("modules", modules).Infof("kernel CVEs fixed by the live patches, do not reboot")
+		result.Livepatches = modules
+		// no reboot restarts the services, they are restarted or reported
+		// as without a reboot required.
+		checkServices(ctx, config, result, false)
 		return nil
 	}
+	checkServices(ctx, config, result, true)
+	result.RebootReasons = reasons
 
-	// create sentinel file for kured
-	if err := createSentinelFile(); err != nil {
+	// create sentinel file for kured and the other targets
+	_, sentinelSpan := tracer.Start(ctx, "sentinel")
+	err = signalReboot(result.RebootReasons)
+	endSpan(sentinelSpan, commandExitCode(err), err)
+	if err != nil {
 		return err
 	}
+	result.RebootRequired = true
+
+	notify(ctx, Event{
+		Reason:  eventRebootRequired,
+		Message: fmt.Sprintf("A reboot is required: %s", strings.Join(result.RebootReasons, ",")),
+	})
 
 	return nil
 }
 
+// updateMode returns the yum command applying the updates, update-minimal
+// installs the lowest versions fixing the advisories.
+func updateMode(config Config) string {
+	if config.updateMinimal {
+		return updateModeMinimal
+	}
+	return updateModeLatest
+}
+
 // defaultYumCommand returns the default yum command.
 func defaultYumCommand() []string {
 	return []string{"yum", "-y", "-q"}
@@ -268,54 +999,131 @@ func defaultYumCommand() []string {
 // to check and update packages with yum.
 func buildYumUpdatesCommand(action string, config Config) *exec.Cmd {
 	cmd := defaultYumCommand()
-	cmd = append(cmd, action, "--security")
-
-	for _, pkg := range config.excludePackages {
-		cmd = append(cmd, "--exclude="+pkg)
+	cmd = append(cmd, action)
+	cmd = append(cmd, yumCacheArgs(config)...)
+	if action == "check-update" && config.pinMode == pinModeVersionlock && len(config.pins) > 0 {
+		// the updates hidden by the locks of the pins are held back again
+		cmd = append(cmd, "--disableplugin=versionlock")
 	}
-	for _, severity := range config.severities {
-		cmd = append(cmd, "--sec-severity="+severity)
-	}
-
+	cmd = append(cmd, yumFilterArgs(config)...)
 	cmd = append(cmd, config.updatePackages...)
 	cmd = buildHostCommand(cmd)
 
 	return newCommand(cmd)
 }
 
-// updatesAvailable checks if some updates are available.
-func updatesAvailable(config Config) (bool, error) {
+// buildPinTargetsCommand returns the exec command to update the pinned
+// packages to the newest versions allowed by their pins, the filters of
+// the category do not apply to these versions.
+func buildPinTargetsCommand(config Config) *exec.Cmd {
+	cmd := defaultYumCommand()
+	cmd = append(cmd, "update")
+	cmd = append(cmd, yumCacheArgs(config)...)
+	cmd = append(cmd, config.pinTargets...)
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// yumFilterArgs returns the yum arguments that select the updates.
+func yumFilterArgs(config Config) []string {
+	args := []string{}
+
+	// yum applies the updates matching any of the filters, the CVEs
+	// and advisories replace the security updates of the severities.
+	targeted := len(config.includeCVEs) > 0 || len(config.includeAdvisories) > 0
+	if !targeted {
+		args = append(args, categoryArg(updateCategory(config))...)
+	}
+	for _, pkg := range config.excludePackages {
+		args = append(args, "--exclude="+pkg)
+	}
+	// yum ORs --sec-severity with the other filters, it would add the
+	// security updates to the other categories.
+	if !targeted && updateCategory(config) == categorySecurity {
+		for _, severity := range config.severities {
+			args = append(args, "--sec-severity="+severity)
+		}
+	}
+	for _, cve := range config.includeCVEs {
+		args = append(args, "--cve="+cve)
+	}
+	for _, a := range config.includeAdvisories {
+		args = append(args, "--advisory="+a)
+	}
+
+	return args
+}
+
+// updatesAvailable checks if some updates are available with the exit code
+// of yum check-update and returns the packages parsed from its output.
+func updatesAvailable(config Config) (bool, []packageWithUpdate, error) {
 	log.Infof("check if updates are available")
 
+	result := bytes.Buffer{}
 	cmd := buildYumUpdatesCommand("check-update", config)
+	cmd.Stderr = &result
+	cmd.Stdout = &result
+
+	pkgs := make([]packageWithUpdate, 0)
+
 	if err := runCommand(cmd); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode := exitErr.ExitCode()
 			if exitCode == yumNeedUpdateExitCode {
 				log.Infof("updates available")
-				return true, nil
+				pkgs, err := parseUpdatesAvailable(result.Bytes())
+				if err == nil && len(pkgs) == 0 {
+					log.Warnf("yum check-update reported updates but no package could be parsed from its output")
+				}
+				return true, pkgs, err
 			}
 		}
-		return false, fmt.Errorf("yum-check-update did not run successfully: %v", err)
+		return false, pkgs, explainCheckUpdateError(config, fmt.Errorf("yum-check-update did not run successfully: %w", err))
 	}
 
 	log.Infof("no updates available")
 
-	return false, nil
+	return false, pkgs, nil
 }
 
 // runUpdates starts the update of packages.
-func runUpdates(config Config) error {
-	log.Infof("update security packages")
+// The installed packages are snapshotted before and after the update
+// to return what changed, the diff is nil if a snapshot failed.
+func runUpdates(config Config) (*PackageDiff, error) {
+	log.Infof("update %s packages", updateCategory(config))
 
-	cmd := buildYumUpdatesCommand("update", config)
+	before, err := listInstalledPackages()
+	if err != nil {
+		log.Errorf("can not snapshot packages before update: %v", err)
+	}
+
+	cmd := buildYumUpdatesCommand(updateMode(config), config)
 	if err := runCommand(cmd); err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Infof("yum-update ran successfully")
+	log.Infof("yum-%s ran successfully", updateMode(config))
 
-	return nil
+	if len(config.pinTargets) > 0 {
+		cmd := buildPinTargetsCommand(config)
+		if err := runCommand(cmd); err != nil {
+			return nil, fmt.Errorf("yum update of the pinned packages did not run successfully: %v", err)
+		}
+	}
+
+	if before == nil {
+		return nil, nil
+	}
+	after, err := listInstalledPackages()
+	if err != nil {
+		log.Errorf("can not snapshot packages after update: %v", err)
+		return nil, nil
+	}
+
+	diff := diffPackages(before, after)
+	logPackageDiff(diff)
+
+	return &diff, nil
 }
 
 // buildRequireRebootCommand returns the exec command to
@@ -326,47 +1134,29 @@ func buildRequireRebootCommand() *exec.Cmd {
 	return newCommand(cmd)
 }
 
-// requireReboot checks if a reboot is required.
-func requireReboot() (bool, error) {
+// requireReboot checks if a reboot is required and returns
+// the core packages updated since boot-up.
+func requireReboot() (bool, []string, error) {
 	log.Infof("check if reboot is required")
 
+	result := bytes.Buffer{}
 	cmd := buildRequireRebootCommand()
+	cmd.Stdout = &result
 	if err := runCommand(cmd); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			exitCode := exitErr.ExitCode()
 			if exitCode == requireRebootExitCode {
-				log.Infof("reboot required")
-				return true, nil
+				packages := parseRebootRequiredPackages(result.Bytes())
+				log.WithField("packages", packages).Infof("reboot required")
+				return true, packages, nil
 			}
 		}
-		return false, fmt.Errorf("needs-restarting did not run successfully: %v", err)
+		return false, nil, fmt.Errorf("needs-restarting did not run successfully: %w", err)
 	}
 
 	log.Infof("no reboot required")
 
-	return false, nil
-}
-
-// buildCreateSentinelFileCommand returns the exec command to
-// create the kured sentinel file.
-func buildCreateSentinelFileCommand() *exec.Cmd {
-	cmd := []string{"touch", sentinelFile}
-	cmd = buildHostCommand(cmd)
-	return newCommand(cmd)
-}
-
-// createSentinelFile creates the kured sentinel file.
-func createSentinelFile() error {
-	log.Infof("create sentinel file")
-
-	cmd := buildCreateSentinelFileCommand()
-	if err := runCommand(cmd); err != nil {
-		return fmt.Errorf("create sentinel failed: %v", err)
-	}
-
-	log.Infof("sentinel file created successfully")
-
-	return nil
+	return false, nil, nil
 }
 
 var varYumPID = yumPID
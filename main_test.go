@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,7 +19,7 @@ var (
 )
 
 func helperCommand(command string, args ...string) *exec.Cmd {
-	cs := []string{testName, "-test.run=TestHelperProcess", "--", command}
+	cs := []string{"-test.run=TestHelperProcess", "--", testName, command}
 	cs = append(cs, args...)
 	cmd := exec.Command(os.Args[0], cs...)
 	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1")
@@ -28,8 +31,9 @@ const (
 	testDefaultSuccess = "default-success"
 	testDefaultFailure = "default-failure"
 
-	testUpdateAvailable   = "update-available"
-	testNoUpdateAvailable = "no-update-available"
+	testUpdateAvailable         = "update-available"
+	testUnparsedUpdateAvailable = "unparsed-update-available"
+	testNoUpdateAvailable       = "no-update-available"
 
 	testRebootRequired   = "reboot-required"
 	testNoRebootRequired = "no-reboot-required"
@@ -40,6 +44,14 @@ const (
 	testRunUpdateAvailable = "run-update-available"
 
 	testMetricsUpdateAvailable = "metrics-update-available"
+
+	testRPMQuery = "rpm-query"
+
+	testServicesRestart = "services-restart"
+
+	testLivepatch = "livepatch"
+
+	testPreflightFailure = "preflight-failure"
 )
 
 var exitCodes = map[string]int{
@@ -63,11 +75,6 @@ func TestHelperProcess(t *testing.T) {
 
 	args := os.Args
 
-	// get testName from the first arg so we can use that
-	// in the switch below to define the ouputs/exit-codes.
-	testName := args[1]
-	args = append(args[:1], args[1+1:]...)
-
 	for len(args) > 0 {
 		if args[0] == "--" {
 			args = args[1:]
@@ -75,10 +82,15 @@ func TestHelperProcess(t *testing.T) {
 		}
 		args = args[1:]
 	}
-	if len(args) == 0 {
+
+	// get testName from the first arg after "--" so we can use that
+	// in the switch below to define the ouputs/exit-codes.
+	if len(args) < 2 {
 		fmt.Fprintf(os.Stderr, "No command\n")
 		os.Exit(2)
 	}
+	testName := args[0]
+	args = args[1:]
 
 	switch testName {
 	case testNoUpdateAvailable, testNoRebootRequired:
@@ -89,13 +101,97 @@ func TestHelperProcess(t *testing.T) {
 		os.Exit(exitCodes[testUpdateAvailable])
 	case testFailRebootRequired:
 		os.Exit(exitCodes[testFailRebootRequired])
-	case testRunUpdateAvailable, testMetricsUpdateAvailable:
+	case testRunUpdateAvailable, testMetricsUpdateAvailable, testLivepatch:
 		lenDefaultCommand := len(strings.Split(hostCommand, " ")) - 1
 		command := args[lenDefaultCommand]
+		if testName == testLivepatch {
+			// a kernel update fixing CVEs of a loaded live patch
+			output := ""
+			switch {
+			case command == "needs-restarting" && args[lenDefaultCommand+1] == "-r":
+				fmt.Fprint(os.Stdout, strings.Join(validKernelRebootRequired, "\n"))
+				os.Exit(exitCodes[testRebootRequired])
+			case command == "kpatch":
+				output = strings.Join(validKpatchList, "\n")
+			case command == "rpm" && args[len(args)-1] == kpatchPackageName(validRunningKernel):
+				output = strings.Join(validKpatchChangelog, "\n")
+			case command == "rpm" && args[len(args)-2] == "--changelog":
+				output = strings.Join(validKernelChangelog, "\n")
+			case command == "yum" && strings.Contains(strings.Join(args, " "), "updateinfo list cves"):
+				output = strings.Join(validAdvisoryCVEs, "\n")
+			case command == "yum" && strings.Contains(strings.Join(args, " "), "updateinfo list"):
+				output = strings.Join(append(validAdvisories, validKernelAdvisory), "\n")
+			}
+			if output != "" {
+				fmt.Fprint(os.Stdout, output)
+				os.Exit(exitCodes[testDefaultSuccess])
+			}
+		}
 		if command == "needs-restarting" {
+			if args[lenDefaultCommand+1] == "-s" {
+				fmt.Fprint(os.Stdout, strings.Join(validServicesNeedingRestart, "\n"))
+				os.Exit(exitCodes[testDefaultSuccess])
+			}
+			fmt.Fprint(os.Stdout, strings.Join(validRebootRequired, "\n"))
 			os.Exit(exitCodes[testRebootRequired])
 		}
-		if command == "touch" {
+		if command == "tee" {
+			io.Copy(os.Stdout, os.Stdin)
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "uname" {
+			fmt.Fprintln(os.Stdout, validRunningKernel)
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "test" {
+			// a yum host without dnf
+			os.Exit(exitCodes[testDefaultFailure])
+		}
+		if command == "package-cleanup" {
+			// the cleanup keeping one kernel removes the oldest
+			// kernel which is not running
+			if f := os.Getenv(helperKernelsFileEnv); f != "" {
+				ioutil.WriteFile(f, []byte(strings.Join(validInstalledKernels[:2], "\n")), 0644)
+			}
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "rpm" && args[len(args)-1] == kernelPackage {
+			if f := os.Getenv(helperKernelsFileEnv); f != "" {
+				if data, err := ioutil.ReadFile(f); err == nil {
+					fmt.Fprint(os.Stdout, string(data))
+					os.Exit(exitCodes[testDefaultSuccess])
+				}
+			}
+			fmt.Fprint(os.Stdout, strings.Join(validInstalledKernels, "\n"))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "rpm" {
+			fmt.Fprint(os.Stdout, strings.Join(validInstalledPackages, "\n"))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "df" {
+			fmt.Fprint(os.Stdout, dfOutput(args[lenDefaultCommand+3:], 50<<30))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "yum" && args[lenDefaultCommand+1] == "--assumeno" {
+			fmt.Fprint(os.Stdout, strings.Join(validTransactionSummary, "\n"))
+			os.Exit(exitCodes[testFailUpdateAvailable])
+		}
+		if command == "yum" && strings.Contains(strings.Join(args, " "), "makecache") {
+			fmt.Fprint(os.Stderr, strings.Join(validRepoFailures, "\n"))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "yum" && strings.Contains(strings.Join(args, " "), "repolist") {
+			fmt.Fprint(os.Stdout, strings.Join(validRepolist, "\n"))
+			fmt.Fprint(os.Stderr, strings.Join(validRepoFailures, "\n"))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "cat" && args[len(args)-1] == yumConfFile {
+			fmt.Fprint(os.Stdout, strings.Join(validYumConf, "\n"))
+			os.Exit(exitCodes[testDefaultSuccess])
+		}
+		if command == "cat" {
+			fmt.Fprint(os.Stdout, strings.Join(validRepoFile, "\n"))
 			os.Exit(exitCodes[testDefaultSuccess])
 		}
 		if command == "yum" {
@@ -109,7 +205,56 @@ func TestHelperProcess(t *testing.T) {
 			if action == "update" {
 				os.Exit(exitCodes[testDefaultSuccess])
 			}
+			if action == "list" {
+				fmt.Fprint(os.Stdout, strings.Join(validAvailableVersions, "\n"))
+				os.Exit(exitCodes[testDefaultSuccess])
+			}
+			if action == "updateinfo" {
+				fmt.Fprint(os.Stdout, strings.Join(validAdvisories, "\n"))
+				os.Exit(exitCodes[testDefaultSuccess])
+			}
 		}
+	case testPreflightFailure:
+		lenDefaultCommand := len(strings.Split(hostCommand, " ")) - 1
+		command := args[lenDefaultCommand]
+		switch {
+		case command == "df":
+			fmt.Fprint(os.Stdout, dfOutput(args[lenDefaultCommand+3:], 200<<20))
+		case command == "rpm" && args[lenDefaultCommand+1] == "--verifydb":
+			fmt.Fprintln(os.Stderr, "error: rpmdb: BDB0113 Thread/process 2165/140207 failed: BDB1507 Thread died in Berkeley DB library")
+			os.Exit(exitCodes[testDefaultFailure])
+		case command == "find":
+			fmt.Fprintln(os.Stdout, "/var/lib/yum/transaction-all.2021-10-01.12:00.42.41")
+		case command == "yum" && args[lenDefaultCommand+1] == "--assumeno":
+			fmt.Fprint(os.Stdout, strings.Join(validTransactionSummary, "\n"))
+			os.Exit(exitCodes[testFailUpdateAvailable])
+		case command == "yum" && args[lenDefaultCommand+len(defaultYumCommand())] == "check-update":
+			fmt.Fprint(os.Stdout, strings.Join(validUpdatesAvailable, "\n"))
+			os.Exit(exitCodes[testUpdateAvailable])
+		case command == "yum" && args[lenDefaultCommand+len(defaultYumCommand())] == "update":
+			// the update must be skipped
+			os.Exit(exitCodes[testDefaultFailure])
+		}
+		os.Exit(exitCodes[testDefaultSuccess])
+	case testUnparsedUpdateAvailable:
+		lenDefaultCommand := len(strings.Split(hostCommand, " ")) - 1
+		command := args[lenDefaultCommand]
+		if command == "yum" && args[lenDefaultCommand+len(defaultYumCommand())] == "check-update" {
+			fmt.Fprint(os.Stdout, "an-unparsable-line-of-check-update")
+			os.Exit(exitCodes[testUpdateAvailable])
+		}
+		os.Exit(exitCodes[testDefaultSuccess])
+	case testServicesRestart:
+		lenDefaultCommand := len(strings.Split(hostCommand, " ")) - 1
+		command := args[lenDefaultCommand]
+		if command == "needs-restarting" && args[lenDefaultCommand+1] == "-s" {
+			fmt.Fprint(os.Stdout, strings.Join(validServicesNeedingRestart, "\n"))
+		}
+		// no updates, no reboot and the restarts succeed
+		os.Exit(exitCodes[testDefaultSuccess])
+	case testRPMQuery:
+		fmt.Fprint(os.Stdout, strings.Join(validInstalledPackages, "\n"))
+		os.Exit(exitCodes[testDefaultSuccess])
 	// failed
 	default:
 		os.Exit(exitCodes[testDefaultFailure])
@@ -138,6 +283,47 @@ func TestBuildYumCommand(t *testing.T) {
 			"update",
 			"yum -y -q update --security --sec-severity=Important sudo openssl",
 		},
+		{
+			Config{
+				updateMinimal: true,
+				severities:    []string{"Critical"},
+			},
+			updateMode(Config{updateMinimal: true}),
+			"yum -y -q update-minimal --security --sec-severity=Critical",
+		},
+		{
+			Config{
+				category:        categoryBugfix,
+				excludePackages: []string{"kernel*"},
+			},
+			"update",
+			"yum -y -q update --bugfix --exclude=kernel*",
+		},
+		{
+			Config{
+				category: categoryAll,
+			},
+			"check-update",
+			"yum -y -q check-update",
+		},
+		{
+			Config{
+				pins:    []versionPin{{pattern: "docker-ce", version: "20.10.7"}},
+				pinMode: pinModeVersionlock,
+			},
+			"check-update",
+			"yum -y -q check-update --disableplugin=versionlock --security",
+		},
+		{
+			Config{
+				excludePackages:   []string{"etcd"},
+				severities:        []string{"Important"},
+				includeCVEs:       []string{"CVE-2021-3156"},
+				includeAdvisories: []string{"RHSA-2021:3798"},
+			},
+			"update",
+			"yum -y -q update --exclude=etcd --cve=CVE-2021-3156 --advisory=RHSA-2021:3798",
+		},
 	}
 
 	for _, tt := range tests {
@@ -154,13 +340,97 @@ func TestBuildCommands(t *testing.T) {
 		expectedCmd string
 	}{
 		{
-			buildCreateSentinelFileCommand,
-			"touch /var/run/reboot-required",
+			func() *exec.Cmd {
+				return buildCreateSentinelFileCommand(defaultSentinelFile, []string{rebootReasonKernel})
+			},
+			"tee /var/run/reboot-required",
 		},
 		{
 			buildRequireRebootCommand,
 			"needs-restarting -r",
 		},
+		{
+			buildKpatchListCommand,
+			"kpatch list",
+		},
+		{
+			func() *exec.Cmd {
+				return buildVersionlockCommand("add", "docker-ce-3:20.10.7-3.el7")
+			},
+			"yum -y -q versionlock add docker-ce-3:20.10.7-3.el7",
+		},
+		{
+			func() *exec.Cmd {
+				return buildRepolistCommand(Config{})
+			},
+			"yum -y -v repolist enabled --setopt=*.skip_if_unavailable=1",
+		},
+		{
+			func() *exec.Cmd {
+				return buildRepolistCommand(Config{cacheOnly: true})
+			},
+			"yum -y -v repolist enabled -C --setopt=*.skip_if_unavailable=1",
+		},
+		{
+			func() *exec.Cmd {
+				return buildYumUpdatesCommand("check-update", Config{cacheOnly: true, category: categorySecurity})
+			},
+			"yum -y -q check-update -C --security",
+		},
+		{
+			func() *exec.Cmd {
+				return buildMakecacheCommand(6*time.Hour, false)
+			},
+			"yum -y makecache fast --setopt=*.metadata_expire=21600 --setopt=*.skip_if_unavailable=1",
+		},
+		{
+			func() *exec.Cmd {
+				return buildMakecacheCommand(6*time.Hour, true)
+			},
+			"yum -y makecache --setopt=*.metadata_expire=21600 --setopt=*.skip_if_unavailable=1",
+		},
+		{
+			func() *exec.Cmd {
+				return buildReadRepoFileCommand("/etc/yum.repos.d/redhat.repo")
+			},
+			"cat /etc/yum.repos.d/redhat.repo",
+		},
+		{
+			func() *exec.Cmd {
+				return buildDfCommand("/", "/var")
+			},
+			"df -P -B1 / /var",
+		},
+		{
+			func() *exec.Cmd {
+				return buildTransactionSizeCommand(Config{updateMinimal: true, category: categoryBugfix})
+			},
+			"yum --assumeno update-minimal --bugfix",
+		},
+		{
+			buildVerifyRPMDBCommand,
+			"rpm --verifydb",
+		},
+		{
+			buildListTransactionsCommand,
+			"find /var/lib/yum -maxdepth 1 -name transaction-all.*",
+		},
+		{
+			func() *exec.Cmd {
+				return buildKernelCleanupCommand(2, []string{"kernel-3.10.0-1127.el7.x86_64"}, false)
+			},
+			"package-cleanup -y -q --oldkernels --count=2",
+		},
+		{
+			func() *exec.Cmd {
+				return buildKernelCleanupCommand(2, []string{"kernel-3.10.0-1127.el7.x86_64", "kernel-3.10.0-1160.el7.x86_64"}, true)
+			},
+			"dnf -y -q remove kernel-3.10.0-1127.el7.x86_64 kernel-3.10.0-1160.el7.x86_64",
+		},
+		{
+			buildDnfCheckCommand,
+			"test -x /usr/bin/dnf",
+		},
 	}
 	for _, tt := range tests {
 		cmd := tt.function()
@@ -186,7 +456,7 @@ func TestUpdatesAvailable(t *testing.T) {
 		execCommand = helperCommand
 		defer func() { execCommand = exec.Command }()
 
-		available, err := updatesAvailable(Config{})
+		available, _, err := updatesAvailable(Config{})
 		if !tt.wantErr && err != nil {
 			t.Fatal(err)
 		}
@@ -213,7 +483,7 @@ func TestRequireReboot(t *testing.T) {
 		execCommand = helperCommand
 		defer func() { execCommand = exec.Command }()
 
-		required, err := requireReboot()
+		required, _, err := requireReboot()
 		if !tt.wantErr && err != nil {
 			t.Fatal(err)
 		}
@@ -244,11 +514,27 @@ func TestRun(t *testing.T) {
 	defer func() { execCommand = exec.Command }()
 
 	runWithRetry(Config{dryRun: true})
-	if err := run(Config{}); err != nil {
+	if err := run(Config{}, &RunResult{}); err != nil {
 		t.Fatal(err)
 	}
 
-	if err := run(Config{dryRun: true}); err != nil {
+	if err := run(Config{dryRun: true}, &RunResult{}); err != nil {
 		t.Fatal(err)
 	}
+
+	// the update is gated by the exit code of check-update even if no
+	// package could be parsed from its output
+	testName = testUnparsedUpdateAvailable
+	var updates []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		if strings.Contains(strings.Join(args, " "), " update --security") {
+			updates = append(updates, strings.Join(args, " "))
+		}
+		return helperCommand(command, args...)
+	}
+	result := &RunResult{}
+	assert.NoError(t, run(Config{}, result))
+	assert.Empty(t, result.Packages)
+	assert.True(t, result.Updated)
+	assert.Len(t, updates, 1)
 }
@@ -4,15 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -22,24 +25,104 @@ const metricsPath = "/metrics"
 type MetricsServer struct {
 	*http.Server
 	hostname string
+	registry *prometheus.Registry
+	// textfile is the node_exporter textfile collector file
+	// refreshed by fetchMetrics, disabled if empty.
+	textfile string
+	// advisoryDir is the directory of the offline OVAL and CSAF files
+	// checked by fetchMetrics, disabled if empty.
+	advisoryDir string
+	// metadataMaxAge is the maximum age of the cached metadata refreshed
+	// by fetchMetrics, the checks use the network if 0.
+	metadataMaxAge time.Duration
 
 	pkgsWithUpdateTotal *prometheus.GaugeVec
 	pkgWithUpdate       *prometheus.CounterVec
+	pinnedPkgWithUpdate *prometheus.GaugeVec
+	pkgsExcludedTotal   *prometheus.GaugeVec
+	pkgExcluded         *prometheus.GaugeVec
+	// the series of the packages of each category, deleted on the
+	// next check of the category only.
+	pkgWithUpdateSeries categorySeries
+	pinnedPkgSeries     categorySeries
+	pkgExcludedSeries   categorySeries
+	rebootSeries        categorySeries
+	serviceSeries       categorySeries
+	categorySeriesMutex sync.Mutex
+
+	lastRunTimestamp       *prometheus.GaugeVec
+	lastRunSuccess         *prometheus.GaugeVec
+	lastRunUpdatedPackages *prometheus.GaugeVec
+	lastRunUpdateMode      *prometheus.GaugeVec
+	lastRunSkipped         *prometheus.GaugeVec
+	preflightCheckSuccess  *prometheus.GaugeVec
+	serviceNeedsRestart    *prometheus.GaugeVec
+	rebootRequired         *prometheus.GaugeVec
+	kernelInfo             *prometheus.GaugeVec
+	installedKernels       *prometheus.GaugeVec
+	livepatchInfo          *prometheus.GaugeVec
+	advisoryMitigated      *prometheus.GaugeVec
+
+	repoUp          *prometheus.GaugeVec
+	repoMetadataAge *prometheus.GaugeVec
+	repoCacheAge    *prometheus.GaugeVec
+	repoInsecure    *prometheus.GaugeVec
+
+	offlineVulnerablePkgsTotal *prometheus.GaugeVec
+	offlinePkgVulnerable       *prometheus.GaugeVec
+	advisoryMismatch           *prometheus.GaugeVec
+}
+
+// categorySeries are the labels of the series of a vector set for each category.
+type categorySeries map[string][]prometheus.Labels
+
+// reset deletes the series of a category from the vector.
+func (s categorySeries) reset(category string, vec interface{ Delete(prometheus.Labels) bool }) {
+	for _, labels := range s[category] {
+		vec.Delete(labels)
+	}
+	s[category] = nil
+}
+
+// add records the series of a category.
+func (s categorySeries) add(category string, labels prometheus.Labels) {
+	s[category] = append(s[category], labels)
 }
 
 type packageWithUpdate struct {
 	name, arch, version, repo string
 }
 
+// packageWithUpdateJSON is the JSON representation of a packageWithUpdate.
+type packageWithUpdateJSON struct {
+	Name    string `json:"name"`
+	Arch    string `json:"arch"`
+	Version string `json:"version"`
+	Repo    string `json:"repo"`
+}
+
+func (p packageWithUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(packageWithUpdateJSON{p.name, p.arch, p.version, p.repo})
+}
+
+func (p *packageWithUpdate) UnmarshalJSON(data []byte) error {
+	v := packageWithUpdateJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = packageWithUpdate{name: v.Name, arch: v.Arch, version: v.Version, repo: v.Repo}
+	return nil
+}
+
 // Prometheus metrics.
 var ()
 
 func newPkgsWithUpdateTotalGauge() *prometheus.GaugeVec {
 	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "yumsecupdater_packages_with_update_total",
-		Help: "Total packages with security updates.",
+		Help: "Total packages with updates of the advisory category.",
 	},
-		[]string{"node"},
+		[]string{"node", "category"},
 	)
 }
 
@@ -47,31 +130,219 @@ func newPkgWithUpdateCounter() *prometheus.CounterVec {
 	return prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "yumsecupdater_package_with_update",
-			Help: "Package with security update.",
+			Help: "Package with update of the advisory category.",
 		},
-		[]string{"node", "name", "arch", "version", "repo"},
+		[]string{"node", "category", "name", "arch", "version", "repo"},
+	)
+}
+
+func newRunGauge(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	},
+		[]string{"node"},
+	)
+}
+
+func newCategoryRunGauge(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	},
+		[]string{"node", "category"},
 	)
 }
 
 // newMetricsServer returns a metricsServer to manage metrics.
+// The metrics of yumsecupdater are kept in their own registry so they can be
+// exported without the go and process metrics of the default registry.
 func newMetricsServer(hostname, addr, port string) (*MetricsServer, error) {
 	pkgsWithUpdateTotal := newPkgsWithUpdateTotalGauge()
 	pkgWithUpdate := newPkgWithUpdateCounter()
+	pinnedPkgWithUpdate := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_pinned_package_with_update",
+		Help: "Package with update of the advisory category held back by a version pin.",
+	},
+		[]string{"node", "category", "name", "arch", "version", "repo", "pin"},
+	)
+	pkgsExcludedTotal := newCategoryRunGauge("yumsecupdater_packages_excluded_total",
+		"Total packages with updates of the advisory category suppressed by an exclude pattern.")
+	pkgExcluded := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_package_excluded",
+		Help: "Package with update of the advisory category suppressed by an exclude pattern.",
+	},
+		[]string{"node", "category", "name", "arch", "version", "repo", "pattern"},
+	)
+	lastRunTimestamp := newCategoryRunGauge("yumsecupdater_last_run_timestamp_seconds", "Time of the end of the last run of the advisory category in seconds since epoch.")
+	lastRunSuccess := newCategoryRunGauge("yumsecupdater_last_run_success", "Whether the last run of the advisory category succeeded.")
+	lastRunUpdatedPackages := newCategoryRunGauge("yumsecupdater_last_run_updated_packages", "Packages updated during the last run of the advisory category.")
+	lastRunUpdateMode := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_last_run_update_mode",
+		Help: "Mode of the updates of the last run of the advisory category, update or update-minimal.",
+	},
+		[]string{"node", "category", "mode"},
+	)
+	lastRunSkipped := newCategoryRunGauge("yumsecupdater_last_run_skipped", "Whether the update of the last run of the advisory category was skipped by the preflight checks.")
+	preflightCheckSuccess := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_preflight_check_success",
+		Help: "Whether the preflight check of the last run of the advisory category passed.",
+	},
+		[]string{"node", "category", "check"},
+	)
+
+	serviceNeedsRestart := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_service_needs_restart",
+		Help: "Service running outdated binaries or libraries after the last run of the advisory category.",
+	},
+		[]string{"node", "category", "service"},
+	)
+
+	rebootRequired := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_reboot_required",
+		Help: "Reboot required by the last run of the advisory category with its reason.",
+	},
+		[]string{"node", "category", "reason"},
+	)
+	kernelInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_kernel_info",
+		Help: "Running kernel and newest installed kernel.",
+	},
+		[]string{"node", "running", "installed"},
+	)
+	installedKernels := newRunGauge("yumsecupdater_installed_kernels", "Number of kernels installed on the node.")
+
+	livepatchInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_livepatch_info",
+		Help: "Kernel live patch loaded on the node.",
+	},
+		[]string{"node", "module", "kernel"},
+	)
+	advisoryMitigated := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_advisory_mitigated",
+		Help: "Kernel advisory with all its CVEs fixed by the loaded live patches.",
+	},
+		[]string{"node", "advisory", "package"},
+	)
 
-	prometheus.MustRegister(pkgsWithUpdateTotal)
-	prometheus.MustRegister(pkgWithUpdate)
+	repoUp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_repo_up",
+		Help: "Whether the metadata of the enabled repository can be downloaded.",
+	},
+		[]string{"node", "repo"},
+	)
+	repoMetadataAge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_repo_metadata_age_seconds",
+		Help: "Age of the metadata of the enabled repository in seconds.",
+	},
+		[]string{"node", "repo"},
+	)
+	repoCacheAge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_repo_cache_age_seconds",
+		Help: "Time since the metadata of the enabled repository was downloaded into the cache in seconds.",
+	},
+		[]string{"node", "repo"},
+	)
+	repoInsecure := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_repo_insecure",
+		Help: "Enabled repository with a check disabled in its .repo file, gpgcheck or sslverify.",
+	},
+		[]string{"node", "repo", "setting"},
+	)
+
+	offlineVulnerablePkgsTotal := newRunGauge("yumsecupdater_offline_vulnerable_packages_total",
+		"Total installed packages vulnerable according to the offline advisories.")
+	offlinePkgVulnerable := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_offline_package_vulnerable",
+		Help: "Installed package vulnerable according to an offline advisory with its CVEs.",
+	},
+		[]string{"node", "name", "arch", "advisory", "fixed", "cves"},
+	)
+	advisoryMismatch := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "yumsecupdater_advisory_mismatch",
+		Help: "Package with security updates according to only one source, the offline advisories or yum.",
+	},
+		[]string{"node", "name", "arch", "source"},
+	)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(pkgsWithUpdateTotal)
+	registry.MustRegister(pkgWithUpdate)
+	registry.MustRegister(pinnedPkgWithUpdate)
+	registry.MustRegister(pkgsExcludedTotal)
+	registry.MustRegister(pkgExcluded)
+	registry.MustRegister(lastRunTimestamp)
+	registry.MustRegister(lastRunSuccess)
+	registry.MustRegister(lastRunUpdatedPackages)
+	registry.MustRegister(lastRunUpdateMode)
+	registry.MustRegister(lastRunSkipped)
+	registry.MustRegister(preflightCheckSuccess)
+	registry.MustRegister(serviceNeedsRestart)
+	registry.MustRegister(rebootRequired)
+	registry.MustRegister(kernelInfo)
+	registry.MustRegister(installedKernels)
+	registry.MustRegister(livepatchInfo)
+	registry.MustRegister(advisoryMitigated)
+	registry.MustRegister(repoUp)
+	registry.MustRegister(repoMetadataAge)
+	registry.MustRegister(repoCacheAge)
+	registry.MustRegister(repoInsecure)
+	registry.MustRegister(offlineVulnerablePkgsTotal)
+	registry.MustRegister(offlinePkgVulnerable)
+	registry.MustRegister(advisoryMismatch)
+
+	handler := promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{}),
+	)
 
 	r := mux.NewRouter()
-	r.Handle(metricsPath, promhttp.Handler())
+	r.Handle(metricsPath, handler)
+	r.Handle(statusPath, daemonStatus)
+	r.HandleFunc(healthzPath, daemonStatus.healthzHandler)
+	r.HandleFunc(readyzPath, daemonStatus.readyzHandler)
+	r.Handle(sbomPath, sbomWriter)
+	r.Handle(historyPath, runHistory)
 
 	return &MetricsServer{
 		Server: &http.Server{
 			Addr:    fmt.Sprintf("%s:%s", addr, port),
 			Handler: r,
 		},
-		pkgsWithUpdateTotal: pkgsWithUpdateTotal,
-		pkgWithUpdate:       pkgWithUpdate,
-		hostname:            hostname,
+		pkgsWithUpdateTotal:    pkgsWithUpdateTotal,
+		pkgWithUpdate:          pkgWithUpdate,
+		pinnedPkgWithUpdate:    pinnedPkgWithUpdate,
+		pkgsExcludedTotal:      pkgsExcludedTotal,
+		pkgExcluded:            pkgExcluded,
+		pkgWithUpdateSeries:    categorySeries{},
+		pinnedPkgSeries:        categorySeries{},
+		pkgExcludedSeries:      categorySeries{},
+		rebootSeries:           categorySeries{},
+		serviceSeries:          categorySeries{},
+		lastRunTimestamp:       lastRunTimestamp,
+		lastRunSuccess:         lastRunSuccess,
+		lastRunUpdatedPackages: lastRunUpdatedPackages,
+		lastRunUpdateMode:      lastRunUpdateMode,
+		lastRunSkipped:         lastRunSkipped,
+		preflightCheckSuccess:  preflightCheckSuccess,
+		serviceNeedsRestart:    serviceNeedsRestart,
+		rebootRequired:         rebootRequired,
+		kernelInfo:             kernelInfo,
+		installedKernels:       installedKernels,
+		livepatchInfo:          livepatchInfo,
+		advisoryMitigated:      advisoryMitigated,
+
+		repoUp:          repoUp,
+		repoMetadataAge: repoMetadataAge,
+		repoCacheAge:    repoCacheAge,
+		repoInsecure:    repoInsecure,
+
+		offlineVulnerablePkgsTotal: offlineVulnerablePkgsTotal,
+		offlinePkgVulnerable:       offlinePkgVulnerable,
+		advisoryMismatch:           advisoryMismatch,
+
+		hostname: hostname,
+		registry: registry,
 	}, nil
 }
 
@@ -90,40 +361,411 @@ func (m *MetricsServer) stopServer() {
 	m.Shutdown(context.TODO())
 }
 
-func (m *MetricsServer) fetchMetrics(config Config) {
-	packagesWithUpdates, err := metricsUpdatesAvailable(config)
+// fetchMetrics checks the updates of the categories to set the metrics, it
+// runs next to the run loops and leaves their phases alone. The metadata is
+// refreshed and the repositories, kernels and offline advisories are audited
+// once for all the categories, from the cached metadata.
+func (m *MetricsServer) fetchMetrics(configs ...Config) {
+	// the metadata is refreshed once older than the max age,
+	// the checks do not hit the repositories otherwise. The checks
+	// download the metadata again when the refresh failed, the
+	// cache may be empty.
+	var cacheFailures []string
+	cacheOnly := false
+	if m.metadataMaxAge > 0 {
+		var err error
+		cacheFailures, err = refreshMetadataCache(m.metadataMaxAge)
+		if err != nil {
+			log.Error(err)
+		} else {
+			cacheOnly = true
+		}
+	}
+
+	var security *Config
+	var securityPackages []packageWithUpdate
+	for i := range configs {
+		configs[i].cacheOnly = cacheOnly
+		packagesWithUpdates, err := m.checkUpdates(configs[i])
+		if err == nil && updateCategory(configs[i]) == categorySecurity {
+			security = &configs[i]
+			securityPackages = packagesWithUpdates
+		}
+	}
+
+	// the audits run after the checks which download the metadata
+	// missing from the cache.
+	audit := Config{cacheOnly: true}
+	if security != nil {
+		audit = *security
+		audit.cacheOnly = true
+	}
+
+	// the offline advisories and the live patches only fix security issues.
+	if m.advisoryDir != "" && security != nil {
+		m.setOfflineMetrics(audit, securityPackages)
+	}
+
+	if kernel, err := getKernelInfo(); err != nil {
+		log.Error(err)
+	} else {
+		m.setKernelInfo(kernel)
+		if security != nil {
+			m.setLivepatchMetrics(audit, kernel)
+		}
+	}
+
+	if repos, err := listRepositories(audit); err != nil {
+		log.Error(err)
+	} else {
+		m.setRepoMetrics(markUnreachable(repos, cacheFailures), time.Now())
+	}
+
+	m.refreshTextfile()
+}
+
+// fetchUpdateMetrics checks the updates of a category after its run, the
+// audits are left to the next fetchMetrics.
+func (m *MetricsServer) fetchUpdateMetrics(config Config) {
+	m.checkUpdates(config)
+	m.refreshTextfile()
+}
+
+// checkUpdates checks the updates of a category to set its metrics and
+// returns the packages with updates.
+func (m *MetricsServer) checkUpdates(config Config) ([]packageWithUpdate, error) {
+	config, err := excludeAdvisoryPackages(config)
+	if err != nil {
+		log.Error(err)
+	}
+
+	// the updates are listed once without the exclude patterns, which are
+	// resolved from them like in the update plan.
+	unfiltered := config
+	unfiltered.excludePackages = []string{}
+	updates, err := metricsUpdatesAvailable(unfiltered)
+	if err != nil {
+		log.Error(err)
+	}
+	plan := newUpdatePlan(config.excludePackages, config.pins, updates)
+	packagesWithUpdates := plan.pending()
+	category := updateCategory(config)
+	m.setMetrics(category, packagesWithUpdates)
+	if err != nil {
+		return packagesWithUpdates, err
+	}
+
+	m.setPinnedMetrics(category, plan.pinned)
+	m.setExcludedMetrics(category, plan.excluded)
+
+	sendEvent(Event{
+		Reason:   eventUpdatesChecked,
+		Category: category,
+		Packages: packagesWithUpdates,
+	})
+	return packagesWithUpdates, nil
+}
+
+// refreshTextfile writes the metrics to the textfile, if enabled.
+func (m *MetricsServer) refreshTextfile() {
+	if m.textfile == "" {
+		return
+	}
+	if err := writeTextfile(m.textfile, m.registry); err != nil {
+		log.Error(err)
+	}
+}
+
+// writeTextfile writes the metrics in the text format read by the
+// textfile collector of node_exporter.
+func writeTextfile(path string, g prometheus.Gatherer) error {
+	log.WithFields(log.Fields{"component": "metrics", "path": path}).
+		Infof("write metrics textfile")
+
+	mfs, err := g.Gather()
+	if err != nil {
+		return fmt.Errorf("can not gather the metrics: %v", err)
+	}
+
+	buf := bytes.Buffer{}
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return fmt.Errorf("can not encode the metrics: %v", err)
+		}
+	}
+
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("can not write the metrics textfile: %v", err)
+	}
+	return nil
+}
+
+// Send implements EventSink to set the metrics of the last run.
+func (m *MetricsServer) Send(e Event) {
+	if e.Reason != eventRunCompleted || e.Result == nil {
+		return
+	}
+	m.setRunMetrics(e.Result)
+}
+
+func (m *MetricsServer) setRunMetrics(result *RunResult) {
+	category := result.Category
+	if category == "" {
+		category = categorySecurity
+	}
+	labels := prometheus.Labels{"node": m.hostname, "category": category}
+
+	m.lastRunTimestamp.With(labels).Set(float64(result.End.UnixNano()) / float64(time.Second))
+
+	success := 1.0
+	if result.Failed {
+		success = 0
+	}
+	m.lastRunSuccess.With(labels).Set(success)
+
+	updated := 0
+	if result.Updated {
+		updated = len(result.Packages)
+	}
+	m.lastRunUpdatedPackages.With(labels).Set(float64(updated))
+
+	for _, mode := range []string{updateModeLatest, updateModeMinimal} {
+		m.lastRunUpdateMode.Delete(prometheus.Labels{"node": m.hostname, "category": category, "mode": mode})
+	}
+	if result.UpdateMode != "" {
+		m.lastRunUpdateMode.With(prometheus.Labels{"node": m.hostname, "category": category, "mode": result.UpdateMode}).Set(1)
+	}
+
+	skipped := 0.0
+	if result.Skipped {
+		skipped = 1
+	}
+	m.lastRunSkipped.With(labels).Set(skipped)
+
+	for _, check := range []string{preflightCheckDisk, preflightCheckRPMDB, preflightCheckTransactions} {
+		m.preflightCheckSuccess.Delete(prometheus.Labels{"node": m.hostname, "category": category, "check": check})
+	}
+	for _, c := range result.Preflight {
+		passed := 0.0
+		if c.Passed {
+			passed = 1
+		}
+		m.preflightCheckSuccess.With(prometheus.Labels{"node": m.hostname, "category": category, "check": c.Check}).Set(passed)
+	}
+
+	m.categorySeriesMutex.Lock()
+	defer m.categorySeriesMutex.Unlock()
+
+	m.rebootSeries.reset(category, m.rebootRequired)
+	for _, reason := range result.RebootReasons {
+		labels := prometheus.Labels{"node": m.hostname, "category": category, "reason": reason}
+		m.rebootRequired.With(labels).Set(1)
+		m.rebootSeries.add(category, labels)
+	}
+
+	m.serviceSeries.reset(category, m.serviceNeedsRestart)
+	for _, service := range result.ServicesNeedingRestart {
+		labels := prometheus.Labels{"node": m.hostname, "category": category, "service": service}
+		m.serviceNeedsRestart.With(labels).Set(1)
+		m.serviceSeries.add(category, labels)
+	}
+}
+
+func (m *MetricsServer) setKernelInfo(kernel kernelInfo) {
+	m.kernelInfo.Reset()
+	m.kernelInfo.With(prometheus.Labels{
+		"node":      m.hostname,
+		"running":   kernel.running,
+		"installed": kernel.installed,
+	}).Set(1)
+	m.installedKernels.With(prometheus.Labels{"node": m.hostname}).Set(float64(kernel.count))
+}
+
+// setLivepatchMetrics sets the loaded live patches and the kernel
+// advisories they mitigate.
+func (m *MetricsServer) setLivepatchMetrics(config Config, kernel kernelInfo) {
+	m.livepatchInfo.Reset()
+	m.advisoryMitigated.Reset()
+
+	state, err := getLivepatchState(kernel.running)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, p := range state.patches {
+		m.livepatchInfo.With(prometheus.Labels{
+			"node":   m.hostname,
+			"module": p.module,
+			"kernel": p.kernel,
+		}).Set(1)
+	}
+	if len(state.cves) == 0 {
+		return
+	}
+
+	advisories, err := listAdvisories(config)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	cves, err := listAdvisoryCVEs(config)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, a := range mitigatedAdvisories(advisories, cves, state) {
+		m.advisoryMitigated.With(prometheus.Labels{
+			"node":     m.hostname,
+			"advisory": a.id,
+			"package":  a.pkg,
+		}).Set(1)
+	}
+}
+
+// setRepoMetrics sets the status, the metadata age and the disabled
+// checks of the enabled repositories.
+func (m *MetricsServer) setRepoMetrics(repos []repository, now time.Time) {
+	m.repoUp.Reset()
+	m.repoMetadataAge.Reset()
+	m.repoCacheAge.Reset()
+	m.repoInsecure.Reset()
+
+	for _, r := range repos {
+		labels := prometheus.Labels{"node": m.hostname, "repo": r.id}
+		up := 0.0
+		if r.reachable {
+			up = 1
+		}
+		m.repoUp.With(labels).Set(up)
+		if !r.updated.IsZero() {
+			m.repoMetadataAge.With(labels).Set(r.metadataAge(now).Seconds())
+		}
+		if !r.refreshed.IsZero() {
+			m.repoCacheAge.With(labels).Set(r.cacheAge(now).Seconds())
+		}
+		for _, setting := range r.insecure {
+			m.repoInsecure.With(prometheus.Labels{"node": m.hostname, "repo": r.id, "setting": setting}).Set(1)
+		}
+	}
+}
+
+// setOfflineMetrics sets the packages vulnerable according to the offline
+// advisories and the mismatches with the updates found by yum.
+func (m *MetricsServer) setOfflineMetrics(config Config, updates []packageWithUpdate) {
+	vulnerabilities, mismatches, err := checkOfflineAdvisories(m.advisoryDir, config, updates)
 	if err != nil {
 		log.Error(err)
+		return
+	}
+
+	m.offlinePkgVulnerable.Reset()
+	packages := map[string]bool{}
+	for _, v := range vulnerabilities {
+		packages[v.name+"."+v.arch] = true
+		m.offlinePkgVulnerable.With(prometheus.Labels{
+			"node":     m.hostname,
+			"name":     v.name,
+			"arch":     v.arch,
+			"advisory": v.advisory,
+			"fixed":    v.fixed,
+			"cves":     strings.Join(v.cves, ","),
+		}).Set(1)
+	}
+	m.offlineVulnerablePkgsTotal.With(prometheus.Labels{"node": m.hostname}).Set(float64(len(packages)))
+
+	m.advisoryMismatch.Reset()
+	for _, mismatch := range mismatches {
+		m.advisoryMismatch.With(prometheus.Labels{
+			"node":   m.hostname,
+			"name":   mismatch.name,
+			"arch":   mismatch.arch,
+			"source": mismatch.source,
+		}).Set(1)
+	}
+}
+
+func (m *MetricsServer) setMetrics(category string, pkgs []packageWithUpdate) {
+	m.setPkgsWithUpdateTotal(category, pkgs)
+	m.setPkgWithUpdate(category, pkgs)
+}
+
+// setPinnedMetrics sets the packages with updates held back by a pin.
+func (m *MetricsServer) setPinnedMetrics(category string, pinned []pinnedPackage) {
+	m.categorySeriesMutex.Lock()
+	defer m.categorySeriesMutex.Unlock()
+
+	m.pinnedPkgSeries.reset(category, m.pinnedPkgWithUpdate)
+	for _, p := range pinned {
+		labels := promLabelsFromPackageWithUpdate(m.hostname, category, p.pkg)
+		labels["pin"] = p.pin.String()
+		m.pinnedPkgWithUpdate.With(labels).Set(1)
+		m.pinnedPkgSeries.add(category, labels)
 	}
-	m.setMetrics(packagesWithUpdates)
 }
-func (m *MetricsServer) setMetrics(pkgs []packageWithUpdate) {
-	m.setPkgsWithUpdateTotal(pkgs)
-	m.setPkgWithUpdate(pkgs)
+
+// setExcludedMetrics sets the packages with updates suppressed by the
+// exclude patterns.
+func (m *MetricsServer) setExcludedMetrics(category string, excluded []excludedPackage) {
+	m.categorySeriesMutex.Lock()
+	defer m.categorySeriesMutex.Unlock()
+
+	m.pkgExcludedSeries.reset(category, m.pkgExcluded)
+	for _, e := range excluded {
+		labels := promLabelsFromPackageWithUpdate(m.hostname, category, e.pkg)
+		labels["pattern"] = e.pattern
+		m.pkgExcluded.With(labels).Set(1)
+		m.pkgExcludedSeries.add(category, labels)
+	}
+	m.pkgsExcludedTotal.With(prometheus.Labels{"node": m.hostname, "category": category}).
+		Set(float64(len(excluded)))
 }
 
-func (m *MetricsServer) setPkgWithUpdate(packagesWithUpdates []packageWithUpdate) {
-	// clean up the current label first to remove metrics from updated packages.
-	m.pkgWithUpdate.Reset()
+func (m *MetricsServer) setPkgWithUpdate(category string, packagesWithUpdates []packageWithUpdate) {
+	m.categorySeriesMutex.Lock()
+	defer m.categorySeriesMutex.Unlock()
+
+	// clean up the current labels of the category first to remove
+	// metrics from updated packages.
+	m.pkgWithUpdateSeries.reset(category, m.pkgWithUpdate)
 	for _, pkg := range packagesWithUpdates {
-		labels := promLabelsFromPackageWithUpdate(m.hostname, pkg)
+		labels := promLabelsFromPackageWithUpdate(m.hostname, category, pkg)
 		m.pkgWithUpdate.With(labels).Add(1)
+		m.pkgWithUpdateSeries.add(category, labels)
 	}
 }
 
-func (m *MetricsServer) setPkgsWithUpdateTotal(pkgs []packageWithUpdate) {
-	m.pkgsWithUpdateTotal.With(prometheus.Labels{"node": m.hostname}).
+func (m *MetricsServer) setPkgsWithUpdateTotal(category string, pkgs []packageWithUpdate) {
+	m.pkgsWithUpdateTotal.With(prometheus.Labels{"node": m.hostname, "category": category}).
 		Set(float64(len(pkgs)))
 }
 
-var packageWithUpdateRegex = regexp.MustCompile(`^([\w\-\_]*)\.([\w\-\_]+)\s+(\d+[\w\.\-\_\:]+)\s+([\w\.\-\_]+)\s*$`)
+var packageWithUpdateRegex = regexp.MustCompile(`^([\w\-\_\+]*)\.([\w\-\_]+)\s+(\d+[\w\.\-\_\:]+)\s+([\w\.\-\_]+)\s*$`)
 
-func parseUpdatesAvailable(output []byte) ([]packageWithUpdate, error) {
+// unwrapUpdatesAvailable joins the lines of the packages yum wraps when
+// the name or the version is too long for a column.
+func unwrapUpdatesAvailable(output []byte) [][]byte {
 	sc := bufio.NewScanner(bytes.NewReader(output))
-	packages := make([]packageWithUpdate, 0)
+	lines := make([][]byte, 0)
 
 	for sc.Scan() {
-		line := sc.Bytes()
+		line := append([]byte{}, sc.Bytes()...)
+		last := len(lines) - 1
+		wrapped := len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(bytes.TrimSpace(line)) > 0
+		if wrapped && last >= 0 && len(bytes.Fields(lines[last])) < 3 && !packageWithUpdateRegex.Match(lines[last]) {
+			lines[last] = append(append(lines[last], ' '), bytes.TrimSpace(line)...)
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func parseUpdatesAvailable(output []byte) ([]packageWithUpdate, error) {
+	packages := make([]packageWithUpdate, 0)
+
+	for _, line := range unwrapUpdatesAvailable(output) {
 
 		if packageWithUpdateRegex.Match(line) {
 			// safeguard in case the regex matches wrong
@@ -154,35 +796,22 @@ func metricsUpdatesAvailable(config Config) ([]packageWithUpdate, error) {
 	log.WithField("component", "metrics").
 		Infof("check if updates are available")
 
-	result := bytes.Buffer{}
-	cmd := buildYumUpdatesCommand("check-update", config)
-	cmd.Stderr = &result
-	cmd.Stdout = &result
-
-	pkgs := make([]packageWithUpdate, 0)
-
-	if err := runCommand(cmd); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode := exitErr.ExitCode()
-			if exitCode == yumNeedUpdateExitCode {
-				log.WithField("component", "metrics").
-					Infof("updates available")
-				return parseUpdatesAvailable(result.Bytes())
-			}
-		} else {
-			return pkgs, fmt.Errorf("yum-check-update did not run successfully: %v", err)
-		}
-	}
+	return listUpdatesAvailable(config)
+}
 
-	return pkgs, nil
+// listUpdatesAvailable returns the packages with updates available.
+func listUpdatesAvailable(config Config) ([]packageWithUpdate, error) {
+	_, pkgs, err := updatesAvailable(config)
+	return pkgs, err
 }
 
-func promLabelsFromPackageWithUpdate(hostname string, pkg packageWithUpdate) prometheus.Labels {
+func promLabelsFromPackageWithUpdate(hostname, category string, pkg packageWithUpdate) prometheus.Labels {
 	return prometheus.Labels{
-		"node":    hostname,
-		"name":    pkg.name,
-		"arch":    pkg.arch,
-		"version": pkg.version,
-		"repo":    pkg.repo,
+		"node":     hostname,
+		"category": category,
+		"name":     pkg.name,
+		"arch":     pkg.arch,
+		"version":  pkg.version,
+		"repo":     pkg.repo,
 	}
 }
@@ -6,7 +6,9 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -53,10 +55,26 @@ func TestParseUpdatesAvailable(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
+	// names with a plus sign and lines wrapped by yum
+	result, err := parseUpdatesAvailable([]byte(strings.Join([]string{
+		"libstdc++.x86_64             4.8.5-44.el7                   rhel-7-server-rpms",
+		"python-backports-ssl_match_hostname.noarch",
+		"                             3.5.0.1-1.el7.1                rhel-7-server-rpms",
+		"gcc-c++.x86_64               4.8.5-44.el7.4.8.5-44.el7.4.8.5-44.el7",
+		"                                                            rhel-7-server-rpms",
+		"",
+	}, "\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, []packageWithUpdate{
+		{name: "libstdc++", arch: "x86_64", version: "4.8.5-44.el7", repo: "rhel-7-server-rpms"},
+		{name: "python-backports-ssl_match_hostname", arch: "noarch", version: "3.5.0.1-1.el7.1", repo: "rhel-7-server-rpms"},
+		{name: "gcc-c++", arch: "x86_64", version: "4.8.5-44.el7.4.8.5-44.el7.4.8.5-44.el7", repo: "rhel-7-server-rpms"},
+	}, result)
+
 	data, err := ioutil.ReadFile("./testdata/package-with-updates_full_90_pkgs")
 	assert.NoError(t, err)
 
-	result, err := parseUpdatesAvailable(data)
+	result, err = parseUpdatesAvailable(data)
 	if len(result) != 90 {
 		t.Fatalf("result=%d, expected%d", len(result), 90)
 	}
@@ -70,7 +88,7 @@ func testMetrics(t *testing.T, pkgs []packageWithUpdate, assertFunc func(*testin
 	defer prometheus.Unregister(m.pkgsWithUpdateTotal)
 	defer prometheus.Unregister(m.pkgWithUpdate)
 
-	m.setMetrics(pkgs)
+	m.setMetrics(categorySecurity, pkgs)
 
 	req, err := http.NewRequest("GET", "/metrics", nil)
 	assert.NoError(t, err)
@@ -97,9 +115,9 @@ func TestMetricsFromFullList(t *testing.T) {
 }
 
 func TestMetricsNoPkgs(t *testing.T) {
-	expectedOutput := `# HELP yumsecupdater_packages_with_update_total Total packages with security updates.
+	expectedOutput := `# HELP yumsecupdater_packages_with_update_total Total packages with updates of the advisory category.
 # TYPE yumsecupdater_packages_with_update_total gauge
-yumsecupdater_packages_with_update_total{node="localhost"} 0`
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 0`
 
 	notExpectedOutput := "yumsecupdater_package_with_update"
 	data := strings.Join(invalidUpdatesAvailable, "\n")
@@ -111,16 +129,16 @@ yumsecupdater_packages_with_update_total{node="localhost"} 0`
 }
 
 func TestFetchMetricsE2E(t *testing.T) {
-	expectedOutput := `# HELP yumsecupdater_package_with_update Package with security update.
+	expectedOutput := `# HELP yumsecupdater_package_with_update Package with update of the advisory category.
 # TYPE yumsecupdater_package_with_update counter
-yumsecupdater_package_with_update{arch="noarch",name="pkg-noarch",node="localhost",repo="rhel-7-server_rpms",version="32:9.11.4-26.P2.el7_9.5"} 1
-yumsecupdater_package_with_update{arch="x86_64",name="117",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1
-yumsecupdater_package_with_update{arch="x86_64",name="118",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1
-yumsecupdater_package_with_update{arch="x86_64",name="pkg-with_spec-chars",node="localhost",repo="rhel-7-server-rpms",version="1.8.23-10.el7_9.1"} 1
-yumsecupdater_package_with_update{arch="x86_64",name="pkg-x86_64",node="localhost",repo="rhel-7-server.extras-rpms",version="2:1.13.1-206.git7d71120.el7_9"} 1
-# HELP yumsecupdater_packages_with_update_total Total packages with security updates.
+yumsecupdater_package_with_update{arch="noarch",category="security",name="pkg-noarch",node="localhost",repo="rhel-7-server_rpms",version="32:9.11.4-26.P2.el7_9.5"} 1
+yumsecupdater_package_with_update{arch="x86_64",category="security",name="117",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1
+yumsecupdater_package_with_update{arch="x86_64",category="security",name="118",node="localhost",repo="rhel-7-server-rpms",version="1:1.0.2k-21.el7_9"} 1
+yumsecupdater_package_with_update{arch="x86_64",category="security",name="pkg-with_spec-chars",node="localhost",repo="rhel-7-server-rpms",version="1.8.23-10.el7_9.1"} 1
+yumsecupdater_package_with_update{arch="x86_64",category="security",name="pkg-x86_64",node="localhost",repo="rhel-7-server.extras-rpms",version="2:1.13.1-206.git7d71120.el7_9"} 1
+# HELP yumsecupdater_packages_with_update_total Total packages with updates of the advisory category.
 # TYPE yumsecupdater_packages_with_update_total gauge
-yumsecupdater_packages_with_update_total{node="localhost"} 5`
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -151,6 +169,38 @@ yumsecupdater_packages_with_update_total{node="localhost"} 5`
 	m.stopServer()
 }
 
+func TestFetchMetricsTextfile(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5
+yumsecupdater_kernel_info{installed="3.10.0-1160.45.1.el7.x86_64",node="localhost",running="3.10.0-1160.el7.x86_64"} 1`)
+	assertMetricsNotInOutput(t, string(data), "go_goroutines")
+
+	testName = testNoUpdateAvailable
+	m.fetchMetrics(Config{})
+	data, err = ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_packages_with_update_total{category="security",node="localhost"} 0`)
+	assertMetricsNotInOutput(t, string(data), "yumsecupdater_package_with_update{")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
 func assertMetricsOutput(t *testing.T, body, expectedOutput string) {
 	for _, line := range strings.Split(expectedOutput, "\n") {
 		if line == "" {
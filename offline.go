@@ -0,0 +1,401 @@
+package main
+
+import (
+	"compress/bzip2"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sources of the packages with security updates.
+const (
+	advisorySourceOffline = "offline"
+	advisorySourceYum     = "yum"
+)
+
+const defaultAdvisoryDir string = ""
+
+var (
+	// ovalEarlierThanRegex matches the comment of the criterion of a package
+	// fixed in an OVAL definition, like "sudo is earlier than 0:1.8.23-10.el7_9.1".
+	ovalEarlierThanRegex = regexp.MustCompile(`^(\S+) is earlier than (\S+)$`)
+)
+
+// offlineFix is a package version fixing the CVEs of an advisory
+// according to an OVAL or CSAF file.
+type offlineFix struct {
+	advisory, severity string
+	cves               []string
+	// arch is empty when the fix applies to all the archs.
+	name, arch, evr string
+}
+
+// offlineVulnerability is an installed package older than an offlineFix.
+type offlineVulnerability struct {
+	advisory, severity string
+	cves               []string
+	name, arch         string
+	installed, fixed   string
+}
+
+// advisoryMismatch is a package with security updates according to
+// only one of the sources.
+type advisoryMismatch struct {
+	name, arch, source string
+}
+
+// ovalDefinitions is the part of a Red Hat OVAL file used to find the fixed packages.
+type ovalDefinitions struct {
+	Definitions []ovalDefinition `xml:"definitions>definition"`
+}
+
+type ovalDefinition struct {
+	Class      string          `xml:"class,attr"`
+	References []ovalReference `xml:"metadata>reference"`
+	Severity   string          `xml:"metadata>advisory>severity"`
+	CVEs       []string        `xml:"metadata>advisory>cve"`
+	Criteria   ovalCriteria    `xml:"criteria"`
+}
+
+type ovalReference struct {
+	Source string `xml:"source,attr"`
+	RefID  string `xml:"ref_id,attr"`
+}
+
+type ovalCriteria struct {
+	Criteria   []ovalCriteria  `xml:"criteria"`
+	Criterions []ovalCriterion `xml:"criterion"`
+}
+
+type ovalCriterion struct {
+	Comment string `xml:"comment,attr"`
+}
+
+// csafDocument is the part of a Red Hat CSAF/VEX file used to find the fixed packages.
+type csafDocument struct {
+	Document struct {
+		AggregateSeverity struct {
+			Text string `json:"text"`
+		} `json:"aggregate_severity"`
+		Tracking struct {
+			ID string `json:"id"`
+		} `json:"tracking"`
+	} `json:"document"`
+	Vulnerabilities []struct {
+		CVE           string `json:"cve"`
+		ProductStatus struct {
+			Fixed []string `json:"fixed"`
+		} `json:"product_status"`
+	} `json:"vulnerabilities"`
+}
+
+// packages returns the packages fixed by the criteria and its children.
+func (c ovalCriteria) packages() map[string]string {
+	packages := map[string]string{}
+	for _, criterion := range c.Criterions {
+		if m := ovalEarlierThanRegex.FindStringSubmatch(criterion.Comment); m != nil {
+			packages[m[1]] = m[2]
+		}
+	}
+	for _, child := range c.Criteria {
+		for name, evr := range child.packages() {
+			packages[name] = evr
+		}
+	}
+	return packages
+}
+
+// parseOVAL returns the packages fixed by the patch definitions of an OVAL file.
+func parseOVAL(r io.Reader) ([]offlineFix, error) {
+	doc := ovalDefinitions{}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	fixes := make([]offlineFix, 0)
+	for _, d := range doc.Definitions {
+		if d.Class != "patch" {
+			continue
+		}
+
+		id := ""
+		cves := d.CVEs
+		for _, ref := range d.References {
+			switch {
+			case ref.Source == "CVE":
+				if !containsString(cves, ref.RefID) {
+					cves = append(cves, ref.RefID)
+				}
+			case id == "":
+				id = ref.RefID
+			}
+		}
+
+		packages := d.Criteria.packages()
+		names := make([]string, 0, len(packages))
+		for name := range packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fixes = append(fixes, offlineFix{
+				advisory: id,
+				severity: d.Severity,
+				cves:     cves,
+				name:     name,
+				evr:      packages[name],
+			})
+		}
+	}
+
+	return fixes, nil
+}
+
+// parseCSAF returns the packages fixed by a CSAF/VEX file.
+func parseCSAF(r io.Reader) ([]offlineFix, error) {
+	doc := csafDocument{}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	fixes := make([]offlineFix, 0)
+	index := map[string]int{}
+	for _, v := range doc.Vulnerabilities {
+		for _, product := range v.ProductStatus.Fixed {
+			m := nevraRegex.FindStringSubmatch(product)
+			if m == nil || m[5] == "src" {
+				continue
+			}
+			evr := fmt.Sprintf("%s-%s", m[3], m[4])
+			if m[2] != "" {
+				evr = fmt.Sprintf("%s:%s", m[2], evr)
+			}
+
+			// the same package fixes all the CVEs of the document
+			key := fmt.Sprintf("%s.%s-%s", m[1], m[5], evr)
+			if i, ok := index[key]; ok {
+				if v.CVE != "" && !containsString(fixes[i].cves, v.CVE) {
+					fixes[i].cves = append(fixes[i].cves, v.CVE)
+				}
+				continue
+			}
+			fix := offlineFix{
+				advisory: doc.Document.Tracking.ID,
+				severity: doc.Document.AggregateSeverity.Text,
+				cves:     []string{},
+				name:     m[1],
+				arch:     m[5],
+				evr:      evr,
+			}
+			if v.CVE != "" {
+				fix.cves = append(fix.cves, v.CVE)
+			}
+			index[key] = len(fixes)
+			fixes = append(fixes, fix)
+		}
+	}
+
+	return fixes, nil
+}
+
+// loadOfflineAdvisoryFile returns the packages fixed by an OVAL
+// (.xml, .xml.bz2) or CSAF (.json) file, nil for the other files.
+func loadOfflineAdvisoryFile(file string) ([]offlineFix, error) {
+	var parse func(io.Reader) ([]offlineFix, error)
+	name := strings.TrimSuffix(file, ".bz2")
+	switch {
+	case strings.HasSuffix(name, ".xml"):
+		parse = parseOVAL
+	case strings.HasSuffix(name, ".json"):
+		parse = parseCSAF
+	default:
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".bz2") {
+		r = bzip2.NewReader(f)
+	}
+
+	fixes, err := parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("can not parse advisory file %s: %v", file, err)
+	}
+	return fixes, nil
+}
+
+// loadOfflineAdvisories returns the packages fixed by the OVAL and CSAF files
+// of a directory. The hidden files are skipped, like the ..data link of a
+// mounted ConfigMap.
+func loadOfflineAdvisories(dir string) ([]offlineFix, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can not read advisory dir: %v", err)
+	}
+
+	fixes := make([]offlineFix, 0)
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), ".") || f.IsDir() {
+			continue
+		}
+		fileFixes, err := loadOfflineAdvisoryFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fixes = append(fixes, fileFixes...)
+	}
+
+	return fixes, nil
+}
+
+// selected returns true if the fix is selected by the same filters as yum.
+func (f offlineFix) selected(config Config) bool {
+	if containsString(config.excludeAdvisories, f.advisory) || f.hasCVE(config.excludeCVEs) {
+		return false
+	}
+	if len(config.includeCVEs) > 0 || len(config.includeAdvisories) > 0 {
+		if !containsString(config.includeAdvisories, f.advisory) && !f.hasCVE(config.includeCVEs) {
+			return false
+		}
+	} else if len(config.severities) > 0 && !containsString(config.severities, f.severity) {
+		return false
+	}
+	if len(config.updatePackages) > 0 && !containsString(config.updatePackages, f.name) {
+		return false
+	}
+	for _, pattern := range config.excludePackages {
+		if ok, _ := path.Match(pattern, f.name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCVE returns true if the fix is for one of the cves.
+func (f offlineFix) hasCVE(cves []string) bool {
+	for _, cve := range f.cves {
+		if containsString(cves, cve) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOfflineFixes returns the installed packages older than the fixes.
+func matchOfflineFixes(fixes []offlineFix, installed []installedPackage) []offlineVulnerability {
+	// only the newest of the packages installed several times, like the kernel
+	newest := map[string]int{}
+	byName := map[string][]installedPackage{}
+	for _, p := range installed {
+		key := p.name + "." + p.arch
+		if i, ok := newest[key]; ok {
+			if compareEVR(p.evr(), byName[p.name][i].evr()) > 0 {
+				byName[p.name][i] = p
+			}
+			continue
+		}
+		newest[key] = len(byName[p.name])
+		byName[p.name] = append(byName[p.name], p)
+	}
+
+	vulnerabilities := make([]offlineVulnerability, 0)
+	for _, f := range fixes {
+		for _, p := range byName[f.name] {
+			if f.arch != "" && f.arch != p.arch {
+				continue
+			}
+			if compareEVR(p.evr(), f.evr) >= 0 {
+				continue
+			}
+			vulnerabilities = append(vulnerabilities, offlineVulnerability{
+				advisory:  f.advisory,
+				severity:  f.severity,
+				cves:      f.cves,
+				name:      p.name,
+				arch:      p.arch,
+				installed: p.evr(),
+				fixed:     f.evr,
+			})
+		}
+	}
+
+	return vulnerabilities
+}
+
+// compareOfflineAdvisories returns the packages vulnerable according to the
+// offline advisories without security updates according to yum, and the other
+// way around.
+func compareOfflineAdvisories(vulnerabilities []offlineVulnerability, updates []packageWithUpdate) []advisoryMismatch {
+	offline := map[string]bool{}
+	for _, v := range vulnerabilities {
+		offline[v.name+"."+v.arch] = true
+	}
+	yum := map[string]bool{}
+	for _, u := range updates {
+		yum[u.name+"."+u.arch] = true
+	}
+
+	mismatches := make([]advisoryMismatch, 0)
+	for _, v := range vulnerabilities {
+		key := v.name + "." + v.arch
+		if !yum[key] {
+			mismatches = append(mismatches, advisoryMismatch{name: v.name, arch: v.arch, source: advisorySourceOffline})
+			// report each package once
+			yum[key] = true
+		}
+	}
+	for _, u := range updates {
+		if !offline[u.name+"."+u.arch] {
+			mismatches = append(mismatches, advisoryMismatch{name: u.name, arch: u.arch, source: advisorySourceYum})
+		}
+	}
+	return mismatches
+}
+
+// checkOfflineAdvisories matches the offline advisories of a directory with
+// the installed packages and compares them with the updates found by yum.
+func checkOfflineAdvisories(dir string, config Config, updates []packageWithUpdate) ([]offlineVulnerability, []advisoryMismatch, error) {
+	log.WithFields(log.Fields{"component": "metrics", "dir": dir}).
+		Infof("check offline advisories")
+
+	fixes, err := loadOfflineAdvisories(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected := make([]offlineFix, 0, len(fixes))
+	for _, f := range fixes {
+		if f.selected(config) {
+			selected = append(selected, f)
+		}
+	}
+
+	installed, err := listInstalledPackages()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vulnerabilities := matchOfflineFixes(selected, installed)
+	mismatches := compareOfflineAdvisories(vulnerabilities, updates)
+	for _, m := range mismatches {
+		log.WithFields(log.Fields{"component": "metrics", "package": m.name + "." + m.arch, "source": m.source}).
+			Warnf("security update reported by a single source")
+	}
+
+	return vulnerabilities, mismatches, nil
+}
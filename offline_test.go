@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdvisoryDir = "testdata/advisories"
+
+func TestParseOVAL(t *testing.T) {
+	f, err := os.Open(filepath.Join(testAdvisoryDir, "rhel-7.oval.xml"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	fixes, err := parseOVAL(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []offlineFix{
+		{advisory: "RHSA-2021:0343", severity: "Important", cves: []string{"CVE-2021-3156"}, name: "sudo", evr: "0:1.8.23-10.el7_9.1"},
+		{advisory: "RHSA-2021:3798", severity: "Important", cves: []string{"CVE-2021-23840", "CVE-2021-23841"}, name: "openssl", evr: "1:1.0.2k-22.el7_9"},
+		{advisory: "RHSA-2021:3798", severity: "Important", cves: []string{"CVE-2021-23840", "CVE-2021-23841"}, name: "openssl-libs", evr: "1:1.0.2k-22.el7_9"},
+	}, fixes)
+
+	_, err = parseOVAL(strings.NewReader("<oval_definitions>"))
+	assert.Error(t, err)
+}
+
+func TestParseCSAF(t *testing.T) {
+	f, err := os.Open(filepath.Join(testAdvisoryDir, "rhsa-2021_3325.json"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	fixes, err := parseCSAF(f)
+	assert.NoError(t, err)
+	assert.Equal(t, []offlineFix{
+		{advisory: "RHSA-2021:3325", severity: "Moderate", cves: []string{"CVE-2021-0001", "CVE-2021-0002"}, name: "tzdata", arch: "noarch", evr: "0:2021b-1.el7"},
+		{advisory: "RHSA-2021:3325", severity: "Moderate", cves: []string{"CVE-2021-0001"}, name: "tzdata-java", arch: "noarch", evr: "0:2021b-1.el7"},
+	}, fixes)
+}
+
+func TestLoadOfflineAdvisories(t *testing.T) {
+	fixes, err := loadOfflineAdvisories(testAdvisoryDir)
+	assert.NoError(t, err)
+	assert.Len(t, fixes, 5)
+
+	// the files of a ConfigMap and the unknown files
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("advisories"), 0644))
+	fixes, err = loadOfflineAdvisories(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, fixes)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0644))
+	_, err = loadOfflineAdvisories(dir)
+	assert.Error(t, err)
+
+	_, err = loadOfflineAdvisories(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestOfflineFixSelected(t *testing.T) {
+	fix := offlineFix{severity: "Important", name: "openssl-libs"}
+
+	assert.True(t, fix.selected(Config{}))
+	assert.True(t, fix.selected(Config{severities: []string{"Important", "Critical"}}))
+	assert.False(t, fix.selected(Config{severities: []string{"Critical"}}))
+	assert.False(t, fix.selected(Config{excludePackages: []string{"openssl*"}}))
+	assert.False(t, fix.selected(Config{updatePackages: []string{"sudo"}}))
+
+	fix = offlineFix{advisory: "RHSA-2021:3798", severity: "Moderate", cves: []string{"CVE-2021-23840", "CVE-2021-23841"}}
+	assert.True(t, fix.selected(Config{severities: []string{"Critical"}, includeCVEs: []string{"CVE-2021-23841"}}))
+	assert.True(t, fix.selected(Config{includeAdvisories: []string{"RHSA-2021:3798"}}))
+	assert.False(t, fix.selected(Config{includeCVEs: []string{"CVE-2021-3156"}}))
+	assert.False(t, fix.selected(Config{excludeCVEs: []string{"CVE-2021-23840"}}))
+	assert.False(t, fix.selected(Config{includeCVEs: []string{"CVE-2021-23840"}, excludeAdvisories: []string{"RHSA-2021:3798"}}))
+}
+
+func TestMatchOfflineFixes(t *testing.T) {
+	installed := parseInstalledPackages([]byte(strings.Join(append(validInstalledPackages, validInstalledKernels...), "\n")))
+	fixes := []offlineFix{
+		{advisory: "RHSA-2021:0343", name: "sudo", evr: "0:1.8.23-10.el7_9.1"},
+		{advisory: "RHSA-2021:3798", name: "openssl-libs", evr: "1:1.0.2k-22.el7_9"},
+		{advisory: "RHSA-2021:3325", name: "tzdata", arch: "x86_64", evr: "0:2021b-1.el7"},
+		// only the newest kernel is compared
+		{advisory: "RHSA-2021:0336", name: "kernel", evr: "0:3.10.0-1160.15.2.el7"},
+	}
+
+	assert.Equal(t, []offlineVulnerability{
+		{advisory: "RHSA-2021:3798", name: "openssl-libs", arch: "x86_64", installed: "1:1.0.2k-21.el7_9", fixed: "1:1.0.2k-22.el7_9"},
+	}, matchOfflineFixes(fixes, installed))
+}
+
+func TestCompareOfflineAdvisories(t *testing.T) {
+	vulnerabilities := []offlineVulnerability{
+		{advisory: "RHSA-2021:3798", name: "openssl-libs", arch: "x86_64"},
+		{advisory: "RHSA-2021:4000", name: "openssl-libs", arch: "x86_64"},
+		{advisory: "RHSA-2021:0343", name: "sudo", arch: "x86_64"},
+	}
+	updates := []packageWithUpdate{
+		{name: "sudo", arch: "x86_64"},
+		{name: "bind-license", arch: "noarch"},
+	}
+
+	assert.Equal(t, []advisoryMismatch{
+		{name: "openssl-libs", arch: "x86_64", source: advisorySourceOffline},
+		{name: "bind-license", arch: "noarch", source: advisorySourceYum},
+	}, compareOfflineAdvisories(vulnerabilities, updates))
+}
+
+func TestFetchMetricsOfflineAdvisories(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+	m.advisoryDir = testAdvisoryDir
+
+	m.fetchMetrics(Config{severities: []string{"Important", "Critical"}})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_offline_vulnerable_packages_total{node="localhost"} 1
+yumsecupdater_offline_package_vulnerable{advisory="RHSA-2021:3798",arch="x86_64",cves="CVE-2021-23840,CVE-2021-23841",fixed="1:1.0.2k-22.el7_9",name="openssl-libs",node="localhost"} 1
+yumsecupdater_advisory_mismatch{arch="x86_64",name="openssl-libs",node="localhost",source="offline"} 1
+yumsecupdater_advisory_mismatch{arch="noarch",name="pkg-noarch",node="localhost",source="yum"} 1`)
+	// the Moderate tzdata advisory is not selected
+	assertMetricsNotInOutput(t, string(data), `name="tzdata"`)
+}
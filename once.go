@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+const pushgatewayJob = "yumsecupdater"
+
+// onceMode runs the updates a single time, exports the metrics and returns
+// the exit code of the run.
+func onceMode(config Config, hostname string, otelExporter *OTelExporter) int {
+	// the webhooks send the events of the run before exiting.
+	defer flushEvents()
+
+	var m *MetricsServer
+	if metricsTextfile != "" || pushgatewayURL != "" || otelExporter != nil {
+		var err error
+		m, err = newMetricsServer(hostname, metricsAddr, metricsPort)
+		if err != nil {
+			log.Fatalf("can not create a metrics server: %v", err)
+		}
+		m.textfile = metricsTextfile
+		m.advisoryDir = advisoryDir
+		m.metadataMaxAge = metadataMaxAgeDuration
+		eventSinks = append(eventSinks, m)
+	}
+	if otelExporter != nil {
+		if err := otelExporter.exportMetrics(context.Background(), m.registry); err != nil {
+			log.Error(err)
+		}
+		// flush the trace of the run and the metrics before exiting.
+		defer otelExporter.shutdown(context.Background())
+	}
+
+	result := runOnce(config)
+
+	if m != nil {
+		m.fetchMetrics(config)
+		if pushgatewayURL != "" {
+			if err := pushMetrics(pushgatewayURL, hostname, m.registry); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	return updateExitCode(result)
+}
+
+// pushMetrics replaces the metrics of the node on a Pushgateway.
+func pushMetrics(url, hostname string, g prometheus.Gatherer) error {
+	log.WithFields(log.Fields{"component": "metrics", "url": url}).
+		Infof("push metrics")
+
+	err := push.New(url, pushgatewayJob).
+		Grouping("instance", hostname).
+		Gatherer(g).
+		Push()
+	if err != nil {
+		return fmt.Errorf("can not push the metrics: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnceMode(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var pushed []byte
+	var pushPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushPath = r.URL.Path
+		pushed, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	metricsTextfile = filepath.Join(dir, "yumsecupdater.prom")
+	pushgatewayURL = ts.URL
+	defer func() {
+		metricsTextfile = defaultMetricsTextfile
+		pushgatewayURL = defaultPushgatewayURL
+	}()
+
+	assert.Equal(t, exitRebootRequired, onceMode(Config{updateMinimal: true}, "localhost", nil))
+
+	data, err := ioutil.ReadFile(metricsTextfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `# TYPE yumsecupdater_last_run_success gauge
+yumsecupdater_last_run_success{category="security",node="localhost"} 1
+yumsecupdater_last_run_updated_packages{category="security",node="localhost"} 5
+yumsecupdater_last_run_update_mode{category="security",mode="update-minimal",node="localhost"} 1
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5
+yumsecupdater_reboot_required{category="security",node="localhost",reason="kernel"} 1`)
+	assertMetricsNotInOutput(t, string(data), "go_goroutines")
+
+	assert.Equal(t, "/metrics/job/yumsecupdater/instance/localhost", pushPath)
+	assert.NotEmpty(t, pushed)
+
+	testName = testDefaultFailure
+	assert.Equal(t, exitFailed, onceMode(Config{}, "localhost", nil))
+	data, err = ioutil.ReadFile(metricsTextfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_last_run_success{category="security",node="localhost"} 0`)
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	otelProtocolGRPC = "grpc"
+	otelProtocolHTTP = "http"
+
+	otelServiceName = "yumsecupdater"
+)
+
+// otelMetrics are the metrics of the MetricsServer exported as OpenTelemetry gauges.
+var otelMetrics = []string{
+	"yumsecupdater_packages_with_update_total",
+	"yumsecupdater_package_with_update",
+	"yumsecupdater_pinned_package_with_update",
+	"yumsecupdater_packages_excluded_total",
+	"yumsecupdater_package_excluded",
+	"yumsecupdater_last_run_timestamp_seconds",
+	"yumsecupdater_last_run_success",
+	"yumsecupdater_last_run_updated_packages",
+	"yumsecupdater_last_run_update_mode",
+	"yumsecupdater_last_run_skipped",
+	"yumsecupdater_preflight_check_success",
+	"yumsecupdater_service_needs_restart",
+	"yumsecupdater_reboot_required",
+	"yumsecupdater_kernel_info",
+	"yumsecupdater_installed_kernels",
+	"yumsecupdater_livepatch_info",
+	"yumsecupdater_advisory_mitigated",
+	"yumsecupdater_repo_up",
+	"yumsecupdater_repo_metadata_age_seconds",
+	"yumsecupdater_repo_cache_age_seconds",
+	"yumsecupdater_repo_insecure",
+	"yumsecupdater_offline_vulnerable_packages_total",
+	"yumsecupdater_offline_package_vulnerable",
+	"yumsecupdater_advisory_mismatch",
+}
+
+// tracer traces the runs, it does nothing unless an OTelExporter is created.
+var tracer trace.Tracer = noop.NewTracerProvider().Tracer(otelServiceName)
+
+// OTelConfig holds the config of the OpenTelemetry exporter.
+type OTelConfig struct {
+	endpoint string
+	protocol string
+	insecure bool
+	interval time.Duration
+}
+
+// OTelExporter exports the traces of the runs and the metrics to an
+// OpenTelemetry collector over OTLP.
+type OTelExporter struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+}
+
+// validateOTelProtocol returns an error if the OTLP protocol is not supported.
+func validateOTelProtocol(protocol string) error {
+	if protocol != otelProtocolGRPC && protocol != otelProtocolHTTP {
+		return fmt.Errorf("invalid otel protocol %q, allowed values: %s,%s", protocol, otelProtocolGRPC, otelProtocolHTTP)
+	}
+	return nil
+}
+
+// newOTelExporter returns an OTelExporter and sets the tracer of the runs.
+func newOTelExporter(ctx context.Context, config OTelConfig, hostname string) (*OTelExporter, error) {
+	if err := validateOTelProtocol(config.protocol); err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(otelServiceName),
+		semconv.HostNameKey.String(hostname),
+	)
+
+	var (
+		traceClient    otlptrace.Client
+		metricExporter sdkmetric.Exporter
+		err            error
+	)
+	if config.protocol == otelProtocolHTTP {
+		traceOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.endpoint)}
+		metricOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(config.endpoint)}
+		if config.insecure {
+			traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+			metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+		}
+		traceClient = otlptracehttp.NewClient(traceOpts...)
+		metricExporter, err = otlpmetrichttp.New(ctx, metricOpts...)
+	} else {
+		traceOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.endpoint)}
+		metricOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(config.endpoint)}
+		if config.insecure {
+			traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+			metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+		}
+		traceClient = otlptracegrpc.NewClient(traceOpts...)
+		metricExporter, err = otlpmetricgrpc.New(ctx, metricOpts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not create the otel metric exporter: %v", err)
+	}
+
+	traceExporter, err := otlptrace.New(ctx, traceClient)
+	if err != nil {
+		return nil, fmt.Errorf("can not create the otel trace exporter: %v", err)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	tracer = tracerProvider.Tracer(otelServiceName)
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(config.interval))),
+		sdkmetric.WithResource(res),
+	)
+
+	log.WithFields(log.Fields{"component": "otel", "endpoint": config.endpoint, "protocol": config.protocol}).
+		Infof("export traces and metrics")
+
+	return &OTelExporter{
+		tracerProvider: tracerProvider,
+		meterProvider:  meterProvider,
+	}, nil
+}
+
+// exportMetrics starts to export the metrics gathered from g.
+func (o *OTelExporter) exportMetrics(ctx context.Context, g prometheus.Gatherer) error {
+	meter := o.meterProvider.Meter(otelServiceName)
+
+	instruments := map[string]metric.Float64ObservableGauge{}
+	observables := make([]metric.Observable, 0, len(otelMetrics))
+	for _, name := range otelMetrics {
+		instrument, err := meter.Float64ObservableGauge(name)
+		if err != nil {
+			return fmt.Errorf("can not create the otel instrument %s: %v", name, err)
+		}
+		instruments[name] = instrument
+		observables = append(observables, instrument)
+	}
+
+	_, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		mfs, err := g.Gather()
+		if err != nil {
+			return err
+		}
+		for _, mf := range mfs {
+			instrument, ok := instruments[mf.GetName()]
+			if !ok {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				labels := make([]attribute.KeyValue, 0, len(m.GetLabel()))
+				for _, l := range m.GetLabel() {
+					labels = append(labels, attribute.String(l.GetName(), l.GetValue()))
+				}
+				value := m.GetGauge().GetValue()
+				if m.Counter != nil {
+					value = m.GetCounter().GetValue()
+				}
+				o.ObserveFloat64(instrument, value, metric.WithAttributes(labels...))
+			}
+		}
+		return nil
+	}, observables...)
+	if err != nil {
+		return fmt.Errorf("can not register the otel metrics callback: %v", err)
+	}
+	return nil
+}
+
+// shutdown flushes the pending traces and metrics.
+func (o *OTelExporter) shutdown(ctx context.Context) {
+	if err := o.meterProvider.Shutdown(ctx); err != nil {
+		log.WithField("component", "otel").Error(err)
+	}
+	if err := o.tracerProvider.Shutdown(ctx); err != nil {
+		log.WithField("component", "otel").Error(err)
+	}
+}
+
+// endSpan ends a span of a step of the run with the exit code of its command.
+func endSpan(span trace.Span, exitCode int, err error) {
+	span.SetAttributes(attribute.Int("exit_code", exitCode))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// commandExitCode returns the exit code of a command from its error,
+// -1 if the command did not exit.
+func commandExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// notify sends an event to the sinks in a span of the run.
+func notify(ctx context.Context, e Event) {
+	_, span := tracer.Start(ctx, "hooks", trace.WithAttributes(
+		attribute.String("event.reason", e.Reason),
+		attribute.Int("event.sinks", len(eventSinks)),
+	))
+	sendEvent(e)
+	span.End()
+}
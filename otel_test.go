@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
+	metricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorStub is an OTLP/HTTP collector recording the names
+// of the spans and metrics it receives.
+type collectorStub struct {
+	mutex   sync.Mutex
+	spans   map[string]map[string]int64
+	metrics []string
+}
+
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	switch r.URL.Path {
+	case "/v1/traces":
+		req := &tracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					attributes := map[string]int64{}
+					for _, a := range span.Attributes {
+						attributes[a.Key] = a.Value.GetIntValue()
+					}
+					c.spans[span.Name] = attributes
+				}
+			}
+		}
+	case "/v1/metrics":
+		req := &metricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					c.metrics = append(c.metrics, m.Name)
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestOTelExporter(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+	defer func() { tracer = noop.NewTracerProvider().Tracer(otelServiceName) }()
+
+	collector := &collectorStub{spans: map[string]map[string]int64{}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	exporter, err := newOTelExporter(ctx, OTelConfig{
+		endpoint: u.Host,
+		protocol: otelProtocolHTTP,
+		insecure: true,
+		interval: time.Hour,
+	}, "localhost")
+	assert.NoError(t, err)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	assert.NoError(t, exporter.exportMetrics(ctx, m.registry))
+
+	_, restore := withRecordSink()
+	defer restore()
+	eventSinks = append(eventSinks, m)
+
+	runOnce(Config{})
+	m.fetchMetrics(Config{})
+	exporter.shutdown(ctx)
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	for _, name := range []string{"run", "check-update", "update", "needs-restarting", "sentinel", "hooks"} {
+		assert.Contains(t, collector.spans, name)
+	}
+	assert.Equal(t, int64(5), collector.spans["run"]["packages.count"])
+	assert.Equal(t, int64(yumNeedUpdateExitCode), collector.spans["check-update"]["exit_code"])
+	assert.Equal(t, int64(requireRebootExitCode), collector.spans["needs-restarting"]["exit_code"])
+
+	assert.Contains(t, collector.metrics, "yumsecupdater_packages_with_update_total")
+	assert.Contains(t, collector.metrics, "yumsecupdater_last_run_success")
+}
+
+func TestValidateOTelProtocol(t *testing.T) {
+	assert.NoError(t, validateOTelProtocol(otelProtocolGRPC))
+	assert.NoError(t, validateOTelProtocol(otelProtocolHTTP))
+	assert.Error(t, validateOTelProtocol("thrift"))
+}
+
+func TestCommandExitCode(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	testName = testDefaultFailure
+	err := runCommand(newCommand([]string{"true"}))
+	assert.Equal(t, 10, commandExitCode(err))
+	assert.Equal(t, 0, commandExitCode(nil))
+}
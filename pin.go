@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes enforcing the version pins.
+const (
+	// pinModePlan excludes the pinned packages from the updates of the run.
+	pinModePlan = "plan"
+	// pinModeVersionlock locks the pinned packages at the newest version
+	// allowed by their pins with the versionlock plugin of yum on the host.
+	pinModeVersionlock = "versionlock"
+)
+
+const (
+	defaultPins    string = ""
+	defaultPinMode string = pinModePlan
+)
+
+// versionlockEntryRegex matches an entry of yum versionlock list,
+// like "0:docker-ce-20.10.7-3.el7.*".
+var versionlockEntryRegex = regexp.MustCompile(`^(?:\d+:)?(\S+)-[^-\s]+-[^-\s]+\.\*$`)
+
+// versionPin allows the updates of the packages matching a glob up to
+// a version, or to exactly this version.
+type versionPin struct {
+	pattern, version string
+	exact            bool
+}
+
+// pinnedPackage is an update held back by a pin.
+type pinnedPackage struct {
+	pkg packageWithUpdate
+	pin versionPin
+}
+
+// String returns the pin in the format of the flag.
+func (p versionPin) String() string {
+	if p.exact {
+		return p.pattern + "=" + p.version
+	}
+	return p.pattern + "<=" + p.version
+}
+
+// matches returns true if the pin applies to the package.
+func (p versionPin) matches(name string) bool {
+	ok, _ := path.Match(p.pattern, name)
+	return ok
+}
+
+// allows returns true if the [epoch:]version-release is allowed by the pin.
+// The epoch is only compared when the pin has one, and a pin without a
+// release allows all the releases of its version.
+func (p versionPin) allows(evr string) bool {
+	if !strings.Contains(p.version, ":") {
+		_, version, release := parseEVR(evr)
+		evr = version
+		if release != "" {
+			evr += "-" + release
+		}
+	}
+	c := compareEVR(evr, p.version)
+	if p.exact {
+		return c == 0
+	}
+	return c <= 0
+}
+
+// parsePin parses a pin like docker-ce<=20.10.7 or containerd.io=1.4.6.
+func parsePin(s string) (versionPin, error) {
+	pin := versionPin{}
+	if i := strings.Index(s, "<="); i >= 0 {
+		pin.pattern, pin.version = s[:i], s[i+2:]
+	} else if i := strings.Index(s, "="); i >= 0 {
+		pin.pattern, pin.version, pin.exact = s[:i], s[i+1:], true
+	}
+	if pin.pattern == "" || pin.version == "" {
+		return pin, fmt.Errorf("invalid pin: %s", s)
+	}
+	if _, err := path.Match(pin.pattern, ""); err != nil {
+		return pin, fmt.Errorf("invalid pin: %s", s)
+	}
+	return pin, nil
+}
+
+// validatePinMode checks if a pin mode is valid.
+func validatePinMode(mode string) error {
+	switch mode {
+	case pinModePlan, pinModeVersionlock:
+		return nil
+	}
+	return fmt.Errorf("invalid pin mode: %s", mode)
+}
+
+// applyPins splits the updates into the updates allowed by the pins and
+// the updates held back, a package is held back by the first pin it matches.
+func applyPins(pins []versionPin, updates []packageWithUpdate) ([]packageWithUpdate, []pinnedPackage) {
+	allowed := make([]packageWithUpdate, 0, len(updates))
+	pinned := make([]pinnedPackage, 0)
+	for _, u := range updates {
+		held := false
+		for _, p := range pins {
+			if !p.matches(u.name) {
+				continue
+			}
+			if !p.allows(u.version) {
+				pinned = append(pinned, pinnedPackage{pkg: u, pin: p})
+				held = true
+			}
+			break
+		}
+		if !held {
+			allowed = append(allowed, u)
+		}
+	}
+	return allowed, pinned
+}
+
+// pinStrings returns the pins in the format of the flag.
+func pinStrings(pins []versionPin) []string {
+	s := make([]string, 0, len(pins))
+	for _, p := range pins {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+// pinnedPackages returns the packages of the pinned updates.
+func pinnedPackages(pinned []pinnedPackage) []packageWithUpdate {
+	packages := make([]packageWithUpdate, 0, len(pinned))
+	for _, p := range pinned {
+		packages = append(packages, p.pkg)
+	}
+	return packages
+}
+
+// excludePinnedPackages returns a copy of the config excluding the
+// names of the pinned packages.
+func excludePinnedPackages(config Config, pinned []pinnedPackage) Config {
+	excluded := make([]string, 0, len(config.excludePackages)+len(pinned))
+	excluded = append(excluded, config.excludePackages...)
+	for _, p := range pinned {
+		if !containsString(excluded, p.pkg.name) {
+			excluded = append(excluded, p.pkg.name)
+		}
+	}
+	config.excludePackages = excluded
+	return config
+}
+
+// buildVersionlockCommand returns the exec command to list, add or
+// delete the versionlock entries.
+func buildVersionlockCommand(args ...string) *exec.Cmd {
+	cmd := defaultYumCommand()
+	cmd = append(cmd, "versionlock")
+	cmd = append(cmd, args...)
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// parseVersionlockList returns the entries of yum versionlock list.
+func parseVersionlockList(output []byte) []string {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	entries := make([]string, 0)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if versionlockEntryRegex.MatchString(line) {
+			entries = append(entries, line)
+		}
+	}
+	return entries
+}
+
+// listVersionlocks returns the versionlock entries of the host.
+func listVersionlocks() ([]string, error) {
+	result := bytes.Buffer{}
+	cmd := buildVersionlockCommand("list")
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("yum versionlock list did not run successfully: %v", err)
+	}
+	return parseVersionlockList(result.Bytes()), nil
+}
+
+// versionlockEntry returns the versionlock entry locking an installed package.
+func versionlockEntry(p installedPackage) string {
+	epoch := p.epoch
+	if epoch == "" {
+		epoch = "0"
+	}
+	return fmt.Sprintf("%s:%s-%s-%s.*", epoch, p.name, p.version, p.release)
+}
+
+// buildAvailableVersionsCommand returns the exec command to list all the
+// available versions of packages, the locks of the pins do not hide them.
+func buildAvailableVersionsCommand(config Config, names []string) *exec.Cmd {
+	cmd := defaultYumCommand()
+	cmd = append(cmd, "list", "available", "--showduplicates")
+	cmd = append(cmd, yumCacheArgs(config)...)
+	if config.pinMode == pinModeVersionlock {
+		cmd = append(cmd, "--disableplugin=versionlock")
+	}
+	cmd = append(cmd, names...)
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// listAvailableVersions returns the available versions of packages.
+func listAvailableVersions(config Config, names []string) ([]packageWithUpdate, error) {
+	result := bytes.Buffer{}
+	cmd := buildAvailableVersionsCommand(config, names)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("yum list available did not run successfully: %v", err)
+	}
+	return parseUpdatesAvailable(result.Bytes())
+}
+
+// pinTargets returns the newest available versions of the pinned packages
+// allowed by their pins and newer than their installed versions.
+func pinTargets(pinned []pinnedPackage, installed []installedPackage, available []packageWithUpdate) []packageWithUpdate {
+	targets := make([]packageWithUpdate, 0)
+	for _, p := range pinned {
+		current := ""
+		for _, i := range installed {
+			if i.name == p.pkg.name && i.arch == p.pkg.arch {
+				current = i.evr()
+			}
+		}
+		var target *packageWithUpdate
+		for k, a := range available {
+			if a.name != p.pkg.name || a.arch != p.pkg.arch || !p.pin.allows(a.version) {
+				continue
+			}
+			if current != "" && compareEVR(a.version, current) <= 0 {
+				continue
+			}
+			if target == nil || compareEVR(a.version, target.version) > 0 {
+				target = &available[k]
+			}
+		}
+		if target != nil {
+			targets = append(targets, *target)
+		}
+	}
+	return targets
+}
+
+// pinTargetSpecs returns the name-[epoch:]version-release.arch of the targets.
+func pinTargetSpecs(targets []packageWithUpdate) []string {
+	specs := make([]string, 0, len(targets))
+	for _, t := range targets {
+		specs = append(specs, fmt.Sprintf("%s-%s.%s", t.name, t.version, t.arch))
+	}
+	return specs
+}
+
+// pinLocks returns the versions the pinned packages are locked at, their
+// target version or their installed version without a target.
+func pinLocks(pinned []pinnedPackage, installed []installedPackage, targets []packageWithUpdate) []installedPackage {
+	locks := make([]installedPackage, 0, len(pinned))
+	for _, p := range pinned {
+		found := false
+		for _, t := range targets {
+			if t.name == p.pkg.name && t.arch == p.pkg.arch {
+				epoch, version, release := parseEVR(t.version)
+				locks = append(locks, installedPackage{name: t.name, epoch: epoch, version: version, release: release, arch: t.arch})
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		for _, i := range installed {
+			if i.name == p.pkg.name && i.arch == p.pkg.arch {
+				locks = append(locks, i)
+			}
+		}
+	}
+	return locks
+}
+
+// versionlockChanges returns the packages to lock at the versions of locks
+// and the entries of the pins to delete. The entries of the packages matching
+// no pin are never deleted.
+func versionlockChanges(pins []versionPin, pinned []pinnedPackage, locks []installedPackage, entries []string) ([]string, []string) {
+	wanted := map[string]bool{}
+	add := make([]string, 0)
+	for _, p := range pinned {
+		for _, l := range locks {
+			if l.name != p.pkg.name || l.arch != p.pkg.arch {
+				continue
+			}
+			entry := versionlockEntry(l)
+			if wanted[entry] {
+				continue
+			}
+			wanted[entry] = true
+			if !containsString(entries, entry) {
+				add = append(add, fmt.Sprintf("%s-%s", l.name, l.evr()))
+			}
+		}
+	}
+
+	remove := make([]string, 0)
+	for _, e := range entries {
+		if wanted[e] {
+			continue
+		}
+		name := versionlockEntryRegex.FindStringSubmatch(e)[1]
+		for _, p := range pins {
+			if p.matches(name) {
+				remove = append(remove, e)
+				break
+			}
+		}
+	}
+
+	return add, remove
+}
+
+// syncVersionlocks locks the pinned packages at their target version and
+// deletes the locks of the pinned packages without updates held back anymore.
+func syncVersionlocks(pins []versionPin, pinned []pinnedPackage, locks []installedPackage) error {
+	entries, err := listVersionlocks()
+	if err != nil {
+		return err
+	}
+
+	add, remove := versionlockChanges(pins, pinned, locks, entries)
+	if len(remove) > 0 {
+		log.WithField("entries", remove).Infof("delete versionlock entries")
+		if err := runCommand(buildVersionlockCommand(append([]string{"delete"}, remove...)...)); err != nil {
+			return fmt.Errorf("yum versionlock delete did not run successfully: %v", err)
+		}
+	}
+	if len(add) > 0 {
+		log.WithField("packages", add).Infof("add versionlock entries")
+		if err := runCommand(buildVersionlockCommand(append([]string{"add"}, add...)...)); err != nil {
+			return fmt.Errorf("yum versionlock add did not run successfully: %v", err)
+		}
+	}
+	return nil
+}
+
+// resolvePinTargets returns the installed versions of the pinned packages
+// and the newest versions allowed by their pins.
+func resolvePinTargets(config Config, pinned []pinnedPackage) ([]installedPackage, []packageWithUpdate, error) {
+	if len(pinned) == 0 {
+		return nil, nil, nil
+	}
+	names := make([]string, 0, len(pinned))
+	for _, p := range pinned {
+		if !containsString(names, p.pkg.name) {
+			names = append(names, p.pkg.name)
+		}
+	}
+	installed, err := listInstalledPackages(names...)
+	if err != nil {
+		return nil, nil, err
+	}
+	available, err := listAvailableVersions(config, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	return installed, pinTargets(pinned, installed, available), nil
+}
+
+// enforcePins holds back the pinned updates of a run, with exclusions in the
+// plan mode or versionlock entries on the host, and returns the updates of
+// the pinned packages to the newest versions allowed by their pins.
+func enforcePins(config Config, pinned []pinnedPackage) (Config, []packageWithUpdate, error) {
+	for _, p := range pinned {
+		log.WithFields(log.Fields{"package": p.pkg.name + "." + p.pkg.arch, "version": p.pkg.version, "pin": p.pin.String()}).
+			Infof("update held back by a pin")
+	}
+
+	installed, targets, err := resolvePinTargets(config, pinned)
+	if err != nil {
+		return config, nil, err
+	}
+	for _, t := range targets {
+		log.WithFields(log.Fields{"package": t.name + "." + t.arch, "version": t.version}).
+			Infof("update up to the pin")
+	}
+	config.pinTargets = pinTargetSpecs(targets)
+
+	if config.pinMode != pinModeVersionlock {
+		return excludePinnedPackages(config, pinned), targets, nil
+	}
+	if config.dryRun {
+		return config, targets, nil
+	}
+	return config, targets, syncVersionlocks(config.pins, pinned, pinLocks(pinned, installed, targets))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validVersionlockList = []string{
+	"0:docker-ce-20.10.7-3.el7.*",
+	"0:containerd.io-1.4.6-3.1.el7.*",
+	"1:openssl-libs-1.0.2k-21.el7_9.*",
+	"versionlock list done",
+}
+
+var validAvailableVersions = []string{
+	"Available Packages",
+	"pkg-x86_64.x86_64            2:1.12.6-68.gitec8512b.el7     rhel-7-server.extras-rpms",
+	"pkg-x86_64.x86_64            2:1.13.0-1.el7                 rhel-7-server.extras-rpms",
+	"pkg-x86_64.x86_64            2:1.13.1-206.git7d71120.el7_9  rhel-7-server.extras-rpms",
+}
+
+func TestParsePin(t *testing.T) {
+	pin, err := parsePin("docker-ce<=20.10.7")
+	assert.NoError(t, err)
+	assert.Equal(t, versionPin{pattern: "docker-ce", version: "20.10.7"}, pin)
+	assert.Equal(t, "docker-ce<=20.10.7", pin.String())
+
+	pin, err = parsePin("containerd*=1.4.6")
+	assert.NoError(t, err)
+	assert.Equal(t, versionPin{pattern: "containerd*", version: "1.4.6", exact: true}, pin)
+	assert.Equal(t, "containerd*=1.4.6", pin.String())
+
+	for _, s := range []string{"docker-ce", "docker-ce<=", "<=20.10.7", "docker-ce>20.10.7", "[docker=1"} {
+		_, err = parsePin(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestVersionPinAllows(t *testing.T) {
+	pin := versionPin{pattern: "docker-ce", version: "20.10.7"}
+	// the epoch of the package is ignored when the pin has none
+	assert.True(t, pin.allows("3:20.10.7-3.el7"))
+	assert.True(t, pin.allows("3:19.03.15-3.el7"))
+	assert.False(t, pin.allows("3:20.10.8-3.el7"))
+
+	pin = versionPin{pattern: "docker-ce", version: "2:20.10.7"}
+	assert.False(t, pin.allows("3:19.03.15-3.el7"))
+
+	pin = versionPin{pattern: "containerd.io", version: "1.4.6-3.1.el7", exact: true}
+	assert.True(t, pin.allows("1.4.6-3.1.el7"))
+	assert.False(t, pin.allows("1.4.6-3.2.el7"))
+	assert.False(t, pin.allows("1.4.4-3.1.el7"))
+}
+
+func TestApplyPins(t *testing.T) {
+	updates, err := parseUpdatesAvailable([]byte(strings.Join(validUpdatesAvailable, "\n")))
+	assert.NoError(t, err)
+	pins := []versionPin{
+		{pattern: "pkg-x86_64", version: "1.13.0"},
+		// the first matching pin applies
+		{pattern: "pkg-*", version: "99"},
+		{pattern: "pkg-noarch", version: "1"},
+		{pattern: "11?", version: "1.0.2k", exact: true},
+	}
+
+	allowed, pinned := applyPins(pins, updates)
+	assert.Len(t, allowed, 4)
+	assert.Equal(t, []pinnedPackage{{pkg: updates[3], pin: pins[0]}}, pinned)
+
+	allowed, pinned = applyPins(nil, updates)
+	assert.Equal(t, updates, allowed)
+	assert.Empty(t, pinned)
+}
+
+func TestExcludePinnedPackages(t *testing.T) {
+	excludePackages := []string{"etcd"}
+	config := Config{excludePackages: excludePackages}
+	pinned := []pinnedPackage{
+		{pkg: packageWithUpdate{name: "docker-ce", arch: "x86_64"}},
+		{pkg: packageWithUpdate{name: "docker-ce", arch: "i686"}},
+	}
+
+	assert.Equal(t, []string{"etcd", "docker-ce"}, excludePinnedPackages(config, pinned).excludePackages)
+	assert.Equal(t, []string{"etcd"}, excludePackages)
+}
+
+func TestPinTargets(t *testing.T) {
+	pins := []versionPin{
+		{pattern: "docker-ce", version: "20.10.7"},
+		{pattern: "sudo", version: "1.8.23"},
+	}
+	pinned := []pinnedPackage{
+		{pkg: packageWithUpdate{name: "docker-ce", arch: "x86_64", version: "3:20.10.8-3.el7"}, pin: pins[0]},
+		{pkg: packageWithUpdate{name: "sudo", arch: "x86_64", version: "1.9.5-3.el7"}, pin: pins[1]},
+	}
+	// installed < pin < latest, the package moves up to the pin
+	installed := []installedPackage{
+		{name: "docker-ce", epoch: "3", version: "20.10.5", release: "3.el7", arch: "x86_64"},
+		{name: "sudo", version: "1.8.23", release: "10.el7_9.1", arch: "x86_64"},
+	}
+	available := []packageWithUpdate{
+		{name: "docker-ce", arch: "x86_64", version: "3:20.10.6-3.el7"},
+		{name: "docker-ce", arch: "x86_64", version: "3:20.10.7-3.el7"},
+		{name: "docker-ce", arch: "x86_64", version: "3:20.10.8-3.el7"},
+		{name: "docker-ce", arch: "i686", version: "3:20.10.7-3.el7"},
+		{name: "sudo", arch: "x86_64", version: "1.8.23-9.el7"},
+		{name: "sudo", arch: "x86_64", version: "1.9.5-3.el7"},
+	}
+
+	targets := pinTargets(pinned, installed, available)
+	assert.Equal(t, []packageWithUpdate{available[1]}, targets)
+	assert.Equal(t, []string{"docker-ce-3:20.10.7-3.el7.x86_64"}, pinTargetSpecs(targets))
+
+	// the target is locked, sudo without a newer allowed version stays locked at its installed version
+	assert.Equal(t, []installedPackage{
+		{name: "docker-ce", epoch: "3", version: "20.10.7", release: "3.el7", arch: "x86_64"},
+		installed[1],
+	}, pinLocks(pinned, installed, targets))
+
+	cmd := buildPinTargetsCommand(Config{pinTargets: pinTargetSpecs(targets)})
+	assert.Equal(t, "update docker-ce-3:20.10.7-3.el7.x86_64", strings.Join(cmd.Args[len(cmd.Args)-2:], " "))
+}
+
+func TestParseVersionlockList(t *testing.T) {
+	assert.Equal(t, validVersionlockList[:3], parseVersionlockList([]byte(strings.Join(validVersionlockList, "\n"))))
+}
+
+func TestVersionlockChanges(t *testing.T) {
+	pins := []versionPin{
+		{pattern: "docker-ce", version: "20.10.7"},
+		{pattern: "containerd.io", version: "1.4.6"},
+		{pattern: "sudo", version: "1.8.23"},
+	}
+	pinned := []pinnedPackage{
+		{pkg: packageWithUpdate{name: "docker-ce", arch: "x86_64", version: "3:20.10.8-3.el7"}, pin: pins[0]},
+		{pkg: packageWithUpdate{name: "sudo", arch: "x86_64", version: "1.9.5-3.el7"}, pin: pins[2]},
+	}
+	installed := []installedPackage{
+		{name: "docker-ce", epoch: "3", version: "20.10.7", release: "3.el7", arch: "x86_64"},
+		{name: "sudo", version: "1.8.23", release: "10.el7_9.1", arch: "x86_64"},
+	}
+	entries := parseVersionlockList([]byte(strings.Join(validVersionlockList, "\n")))
+
+	add, remove := versionlockChanges(pins, pinned, installed, entries)
+	assert.Equal(t, []string{"docker-ce-3:20.10.7-3.el7", "sudo-1.8.23-10.el7_9.1"}, add)
+	// the entry of openssl-libs matches no pin
+	assert.Equal(t, []string{"0:docker-ce-20.10.7-3.el7.*", "0:containerd.io-1.4.6-3.1.el7.*"}, remove)
+
+	entries = []string{"3:docker-ce-20.10.7-3.el7.*"}
+	add, remove = versionlockChanges(pins, pinned[:1], installed, entries)
+	assert.Empty(t, add)
+	assert.Empty(t, remove)
+}
+
+func TestRunPins(t *testing.T) {
+	s := &recordSignaler{}
+	defer withRecordSignalers(s)()
+
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	result := &RunResult{}
+	config := Config{pins: []versionPin{{pattern: "pkg-x86_64", version: "1.13.0"}}, pinMode: pinModePlan}
+	assert.NoError(t, run(config, result))
+	// the pinned package is updated up to its pin
+	assert.Len(t, result.Packages, 5)
+	assert.Contains(t, result.Packages, packageWithUpdate{name: "pkg-x86_64", arch: "x86_64", version: "2:1.13.0-1.el7", repo: "rhel-7-server.extras-rpms"})
+	assert.Equal(t, []packageWithUpdate{{name: "pkg-x86_64", arch: "x86_64", version: "2:1.13.1-206.git7d71120.el7_9", repo: "rhel-7-server.extras-rpms"}}, result.Pinned)
+
+	config.pinMode = pinModeVersionlock
+	result = &RunResult{}
+	assert.NoError(t, run(config, result))
+	assert.Len(t, result.Pinned, 1)
+
+	testName = testDefaultFailure
+	assert.Error(t, run(config, &RunResult{}))
+}
+
+func TestFetchMetricsPins(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{pins: []versionPin{{pattern: "pkg-x86_64", version: "1.13.0"}}})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_pinned_package_with_update{arch="x86_64",category="security",name="pkg-x86_64",node="localhost",pin="pkg-x86_64<=1.13.0",repo="rhel-7-server.extras-rpms",version="2:1.13.1-206.git7d71120.el7_9"} 1
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 5`)
+
+	m.fetchMetrics(Config{})
+	data, err = ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsNotInOutput(t, string(data), "yumsecupdater_pinned_package_with_update{")
+}
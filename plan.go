@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions of the packages of an update plan.
+const (
+	planActionUpdate  = "update"
+	planActionExclude = "exclude"
+	planActionPin     = "pin"
+)
+
+// excludedPackage is an update suppressed by an exclude pattern.
+type excludedPackage struct {
+	pkg     packageWithUpdate
+	pattern string
+}
+
+// updatePlan is the effective plan of a run, the pending updates split
+// into the updates applied, excluded and held back by a pin.
+type updatePlan struct {
+	updates  []packageWithUpdate
+	excluded []excludedPackage
+	pinned   []pinnedPackage
+	// unmatched are the exclude patterns matching no pending update.
+	unmatched []string
+}
+
+// planEntryJSON is the JSON representation of a package of an updatePlan.
+type planEntryJSON struct {
+	packageWithUpdateJSON
+	Pattern string `json:"pattern,omitempty"`
+	Pin     string `json:"pin,omitempty"`
+}
+
+// updatePlanJSON is the JSON representation of an updatePlan.
+type updatePlanJSON struct {
+	Updates           []planEntryJSON `json:"updates"`
+	Excluded          []planEntryJSON `json:"excluded"`
+	Pinned            []planEntryJSON `json:"pinned"`
+	UnmatchedExcludes []string        `json:"unmatchedExcludes"`
+}
+
+func newPlanEntryJSON(p packageWithUpdate) planEntryJSON {
+	return planEntryJSON{packageWithUpdateJSON: packageWithUpdateJSON{p.name, p.arch, p.version, p.repo}}
+}
+
+func (p updatePlan) MarshalJSON() ([]byte, error) {
+	v := updatePlanJSON{
+		Updates:           make([]planEntryJSON, 0, len(p.updates)),
+		Excluded:          make([]planEntryJSON, 0, len(p.excluded)),
+		Pinned:            make([]planEntryJSON, 0, len(p.pinned)),
+		UnmatchedExcludes: append([]string{}, p.unmatched...),
+	}
+	for _, u := range p.updates {
+		v.Updates = append(v.Updates, newPlanEntryJSON(u))
+	}
+	for _, e := range p.excluded {
+		entry := newPlanEntryJSON(e.pkg)
+		entry.Pattern = e.pattern
+		v.Excluded = append(v.Excluded, entry)
+	}
+	for _, pinned := range p.pinned {
+		entry := newPlanEntryJSON(pinned.pkg)
+		entry.Pin = pinned.pin.String()
+		v.Pinned = append(v.Pinned, entry)
+	}
+	return json.Marshal(v)
+}
+
+// matchExcludePattern returns true if an exclude pattern matches the
+// name or the name.arch of the package, like the --exclude of yum.
+func matchExcludePattern(pattern string, pkg packageWithUpdate) bool {
+	if ok, _ := path.Match(pattern, pkg.name); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, pkg.name+"."+pkg.arch)
+	return ok
+}
+
+// resolveExclusions splits the updates into the updates allowed and the updates
+// excluded by the first pattern they match, and returns the patterns matching
+// none of them.
+func resolveExclusions(patterns []string, updates []packageWithUpdate) ([]packageWithUpdate, []excludedPackage, []string) {
+	allowed := make([]packageWithUpdate, 0, len(updates))
+	excluded := make([]excludedPackage, 0)
+	for _, u := range updates {
+		held := false
+		for _, pattern := range patterns {
+			if matchExcludePattern(pattern, u) {
+				excluded = append(excluded, excludedPackage{pkg: u, pattern: pattern})
+				held = true
+				break
+			}
+		}
+		if !held {
+			allowed = append(allowed, u)
+		}
+	}
+
+	unmatched := make([]string, 0)
+	for _, pattern := range patterns {
+		found := false
+		for _, u := range updates {
+			if matchExcludePattern(pattern, u) {
+				found = true
+				break
+			}
+		}
+		if !found && !containsString(unmatched, pattern) {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+
+	return allowed, excluded, unmatched
+}
+
+// buildUpdatePlan lists the pending updates without the exclusions of the
+// config to resolve which updates each exclude pattern and pin suppresses.
+func buildUpdatePlan(config Config) (updatePlan, error) {
+	patterns := config.excludePackages
+	config.excludePackages = []string{}
+
+	updates, err := listUpdatesAvailable(config)
+	if err != nil {
+		return updatePlan{}, err
+	}
+
+	return newUpdatePlan(patterns, config.pins, updates), nil
+}
+
+// newUpdatePlan resolves which of the pending updates, listed without the
+// exclude patterns, each pattern and pin suppresses.
+func newUpdatePlan(patterns []string, pins []versionPin, updates []packageWithUpdate) updatePlan {
+	plan := updatePlan{}
+	updates, plan.excluded, plan.unmatched = resolveExclusions(patterns, updates)
+	plan.updates, plan.pinned = applyPins(pins, updates)
+
+	for _, pattern := range plan.unmatched {
+		log.WithField("pattern", pattern).Warnf("exclude pattern matches no pending update")
+	}
+
+	return plan
+}
+
+// pending returns the updates not excluded by the patterns, with the
+// updates held back by the pins.
+func (p updatePlan) pending() []packageWithUpdate {
+	pending := append([]packageWithUpdate{}, p.updates...)
+	for _, pinned := range p.pinned {
+		pending = append(pending, pinned.pkg)
+	}
+	return pending
+}
+
+// printPlan prints an update plan as a table or JSON.
+func printPlan(w io.Writer, plan updatePlan, output string) error {
+	if output == outputJSON {
+		return printJSON(w, plan)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tNAME\tARCH\tVERSION\tREPO\tREASON")
+	for _, p := range plan.updates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", planActionUpdate, p.name, p.arch, p.version, p.repo, "-")
+	}
+	for _, e := range plan.excluded {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", planActionExclude, e.pkg.name, e.pkg.arch, e.pkg.version, e.pkg.repo, e.pattern)
+	}
+	for _, p := range plan.pinned {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", planActionPin, p.pkg.name, p.pkg.arch, p.pkg.version, p.pkg.repo, p.pin)
+	}
+	return tw.Flush()
+}
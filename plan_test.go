@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchExcludePattern(t *testing.T) {
+	pkg := packageWithUpdate{name: "etcd", arch: "x86_64"}
+	assert.True(t, matchExcludePattern("etcd", pkg))
+	assert.True(t, matchExcludePattern("etc*", pkg))
+	assert.True(t, matchExcludePattern("etcd.x86_64", pkg))
+	assert.False(t, matchExcludePattern("etcd.i686", pkg))
+	assert.False(t, matchExcludePattern("cri*", pkg))
+}
+
+func TestResolveExclusions(t *testing.T) {
+	updates, err := parseUpdatesAvailable([]byte(strings.Join(validUpdatesAvailable, "\n")))
+	assert.NoError(t, err)
+
+	allowed, excluded, unmatched := resolveExclusions([]string{"11?", "pkg-*.noarch", "117", "atomic*", "etcd"}, updates)
+	assert.Equal(t, []packageWithUpdate{updates[3], updates[4]}, allowed)
+	// a package is excluded by the first pattern it matches
+	assert.Equal(t, []excludedPackage{
+		{pkg: updates[0], pattern: "11?"},
+		{pkg: updates[1], pattern: "11?"},
+		{pkg: updates[2], pattern: "pkg-*.noarch"},
+	}, excluded)
+	assert.Equal(t, []string{"atomic*", "etcd"}, unmatched)
+
+	allowed, excluded, unmatched = resolveExclusions(nil, updates)
+	assert.Equal(t, updates, allowed)
+	assert.Empty(t, excluded)
+	assert.Empty(t, unmatched)
+}
+
+func TestBuildUpdatePlan(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	plan, err := buildUpdatePlan(Config{
+		excludePackages: []string{"11*", "etcd"},
+		pins:            []versionPin{{pattern: "pkg-x86_64", version: "1.13.0"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, plan.updates, 2)
+	assert.Len(t, plan.excluded, 2)
+	assert.Len(t, plan.pinned, 1)
+	assert.Equal(t, []string{"etcd"}, plan.unmatched)
+
+	data, err := json.Marshal(plan)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"pattern":""`)
+	v := updatePlanJSON{}
+	assert.NoError(t, json.Unmarshal(data, &v))
+	assert.Equal(t, "117", v.Excluded[0].Name)
+	assert.Equal(t, "11*", v.Excluded[0].Pattern)
+	assert.Equal(t, "pkg-x86_64<=1.13.0", v.Pinned[0].Pin)
+	assert.Equal(t, []string{"etcd"}, v.UnmatchedExcludes)
+
+	testName = testDefaultFailure
+	_, err = buildUpdatePlan(Config{})
+	assert.Error(t, err)
+}
+
+func TestFetchMetricsExcluded(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	// a single check-update lists the updates and the excluded ones
+	var checks []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		if cmd := strings.Join(args, " "); strings.Contains(cmd, "check-update") {
+			checks = append(checks, cmd)
+		}
+		return helperCommand(command, args...)
+	}
+	m.fetchMetrics(Config{excludePackages: []string{"pkg-noarch", "etcd"}})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_package_excluded{arch="noarch",category="security",name="pkg-noarch",node="localhost",pattern="pkg-noarch",repo="rhel-7-server_rpms",version="32:9.11.4-26.P2.el7_9.5"} 1
+yumsecupdater_packages_excluded_total{category="security",node="localhost"} 1
+yumsecupdater_packages_with_update_total{category="security",node="localhost"} 4`)
+	assertMetricsNotInOutput(t, string(data), `yumsecupdater_package_with_update{arch="noarch",category="security",name="pkg-noarch"`)
+	assert.Len(t, checks, 1)
+	assert.NotContains(t, checks[0], "--exclude")
+
+	m.fetchMetrics(Config{})
+	data, err = ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_packages_excluded_total{category="security",node="localhost"} 0`)
+	assertMetricsNotInOutput(t, string(data), "yumsecupdater_package_excluded{")
+}
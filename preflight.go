@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Checks run before the updates.
+const (
+	// preflightCheckDisk checks the free space of the filesystems
+	// against the thresholds and the estimated size of the updates.
+	preflightCheckDisk = "disk"
+	// preflightCheckRPMDB checks the health of the rpm database.
+	preflightCheckRPMDB = "rpmdb"
+	// preflightCheckTransactions checks for the transactions of yum
+	// left incomplete.
+	preflightCheckTransactions = "transactions"
+)
+
+const (
+	defaultPreflightChecks  string = ""
+	defaultPreflightMinFree string = "/=500M,/var=1G,/boot=100M"
+)
+
+// yumTransactionDir is the directory where yum saves the transactions
+// until they are completed.
+const yumTransactionDir = "/var/lib/yum"
+
+var (
+	preflightChecks  string
+	preflightMinFree string
+)
+
+var (
+	// byteSizeRegex matches a size like 500M, 1.5 G or 830 k.
+	byteSizeRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kKmMgGtT]?)[bB]?$`)
+	// transactionSizeRegex matches the sizes of the transaction summary of yum.
+	transactionSizeRegex = regexp.MustCompile(`(?m)^(Total download size|Installed size)\s*:\s*(.+?)\s*$`)
+)
+
+// freeSpaceThreshold is the free space required on the filesystem of a path.
+type freeSpaceThreshold struct {
+	path  string
+	bytes uint64
+}
+
+// filesystem is the filesystem of a path reported by df.
+type filesystem struct {
+	mount     string
+	available uint64
+}
+
+// preflightCheck is the outcome of a check run before the updates.
+type preflightCheck struct {
+	Check   string `json:"check"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// addPreflightFlags adds the flags of the preflight checks to a flag set.
+func addPreflightFlags(fs *flag.FlagSet) {
+	fs.StringVar(&preflightChecks, "preflight-checks", defaultPreflightChecks, "Checks run before the updates separated with a comma, the updates are skipped when one fails, allowed values: disk,rpmdb,transactions")
+	fs.StringVar(&preflightMinFree, "preflight-min-free", defaultPreflightMinFree, "Free space required by the disk check on the filesystem of each path separated with a comma, the estimated size of the updates is added for / and /var")
+}
+
+// parsePreflightFlags parses the values of the flags added by addPreflightFlags into the config.
+func parsePreflightFlags(config *Config) error {
+	config.preflightChecks = parseCommaSeparatedFlagValues(preflightChecks)
+	for _, c := range config.preflightChecks {
+		if err := validatePreflightCheck(c); err != nil {
+			return err
+		}
+	}
+
+	config.minFreeSpace = []freeSpaceThreshold{}
+	for _, s := range parseCommaSeparatedFlagValues(preflightMinFree) {
+		t, err := parseFreeSpaceThreshold(s)
+		if err != nil {
+			return err
+		}
+		config.minFreeSpace = append(config.minFreeSpace, t)
+	}
+
+	return nil
+}
+
+// validatePreflightCheck checks if a preflight check is valid.
+func validatePreflightCheck(c string) error {
+	switch c {
+	case preflightCheckDisk, preflightCheckRPMDB, preflightCheckTransactions:
+		return nil
+	}
+	return fmt.Errorf("invalid preflight check: %s", c)
+}
+
+// parseByteSize parses a size in bytes with an optional k, M, G or T unit.
+func parseByteSize(s string) (uint64, error) {
+	m := byteSizeRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	switch strings.ToUpper(m[2]) {
+	case "K":
+		value *= 1 << 10
+	case "M":
+		value *= 1 << 20
+	case "G":
+		value *= 1 << 30
+	case "T":
+		value *= 1 << 40
+	}
+	return uint64(math.Round(value)), nil
+}
+
+// formatByteSize returns a size in bytes in the format of parseByteSize.
+func formatByteSize(b uint64) string {
+	units := []string{"", "K", "M", "G", "T"}
+	value := float64(b)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(b, 10)
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + units[i]
+}
+
+// parseFreeSpaceThreshold parses a threshold like /var=1G.
+func parseFreeSpaceThreshold(s string) (freeSpaceThreshold, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 || !strings.HasPrefix(s, "/") {
+		return freeSpaceThreshold{}, fmt.Errorf("invalid free space threshold: %s", s)
+	}
+	b, err := parseByteSize(s[i+1:])
+	if err != nil {
+		return freeSpaceThreshold{}, fmt.Errorf("invalid free space threshold: %s", s)
+	}
+	return freeSpaceThreshold{path: s[:i], bytes: b}, nil
+}
+
+// buildDfCommand returns the exec command to get the free space
+// of the filesystems of the paths.
+func buildDfCommand(paths ...string) *exec.Cmd {
+	cmd := []string{"df", "-P", "-B1"}
+	cmd = append(cmd, paths...)
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildTransactionSizeCommand returns the exec command to resolve the
+// transaction of the updates without running it, to estimate its size.
+// The transaction summary is not printed in the quiet mode.
+func buildTransactionSizeCommand(config Config) *exec.Cmd {
+	cmd := []string{"yum", "--assumeno", updateMode(config)}
+	cmd = append(cmd, yumFilterArgs(config)...)
+	cmd = append(cmd, config.updatePackages...)
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildVerifyRPMDBCommand returns the exec command to verify the rpm database.
+func buildVerifyRPMDBCommand() *exec.Cmd {
+	cmd := []string{"rpm", "--verifydb"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildListTransactionsCommand returns the exec command to list the
+// transactions of yum left incomplete.
+func buildListTransactionsCommand() *exec.Cmd {
+	cmd := []string{"find", yumTransactionDir, "-maxdepth", "1", "-name", "transaction-all.*"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// parseDf returns the filesystems of the output of df -P, in the
+// order of the paths given to df.
+func parseDf(output []byte) ([]filesystem, error) {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	filesystems := make([]filesystem, 0)
+
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[0] == "Filesystem" {
+			continue
+		}
+		available, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("can not parse df output: %v", err)
+		}
+		filesystems = append(filesystems, filesystem{
+			mount:     strings.Join(fields[5:], " "),
+			available: available,
+		})
+	}
+
+	return filesystems, nil
+}
+
+// listFilesystems returns the filesystem of each path.
+func listFilesystems(paths []string) (map[string]filesystem, error) {
+	result := bytes.Buffer{}
+	cmd := buildDfCommand(paths...)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("df did not run successfully: %v", err)
+	}
+	filesystems, err := parseDf(result.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(filesystems) != len(paths) {
+		return nil, fmt.Errorf("df returned %d filesystems for %d paths", len(filesystems), len(paths))
+	}
+
+	byPath := map[string]filesystem{}
+	for i, p := range paths {
+		byPath[p] = filesystems[i]
+	}
+	return byPath, nil
+}
+
+// parseTransactionSize returns the download and installed sizes of the
+// transaction summary of yum, and whether a size was found.
+func parseTransactionSize(output []byte) (uint64, uint64, bool) {
+	var download, installed uint64
+	found := false
+	for _, m := range transactionSizeRegex.FindAllSubmatch(output, -1) {
+		size, err := parseByteSize(string(m[2]))
+		if err != nil {
+			continue
+		}
+		found = true
+		if string(m[1]) == "Installed size" {
+			installed = size
+		} else {
+			download = size
+		}
+	}
+	return download, installed, found
+}
+
+// transactionSize estimates the download and installed sizes of the updates.
+func transactionSize(config Config) (uint64, uint64, error) {
+	result := bytes.Buffer{}
+	cmd := buildTransactionSizeCommand(config)
+	cmd.Stdout = &result
+
+	// yum exits with an error when the transaction is declined.
+	err := runCommand(cmd)
+	download, installed, found := parseTransactionSize(result.Bytes())
+	if err != nil && !found {
+		return 0, 0, fmt.Errorf("yum did not estimate the size of the updates: %v", err)
+	}
+	return download, installed, nil
+}
+
+// diskSpaceShortages returns the filesystems without the free space required
+// by the thresholds, the download size on the filesystem of /var and the
+// installed size on the filesystem of /. The thresholds of the paths of a
+// same filesystem are not added up, the highest applies.
+func diskSpaceShortages(thresholds []freeSpaceThreshold, filesystems map[string]filesystem, download, installed uint64) []string {
+	required := map[string]uint64{}
+	available := map[string]uint64{}
+	for _, t := range thresholds {
+		fs := filesystems[t.path]
+		available[fs.mount] = fs.available
+		if t.bytes > required[fs.mount] {
+			required[fs.mount] = t.bytes
+		}
+	}
+	for p, size := range map[string]uint64{"/var": download, "/": installed} {
+		fs, ok := filesystems[p]
+		if !ok {
+			continue
+		}
+		available[fs.mount] = fs.available
+		required[fs.mount] += size
+	}
+
+	mounts := make([]string, 0, len(required))
+	for mount := range required {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+
+	shortages := make([]string, 0)
+	for _, mount := range mounts {
+		if available[mount] < required[mount] {
+			shortages = append(shortages, fmt.Sprintf("%s has %s free, %s required",
+				mount, formatByteSize(available[mount]), formatByteSize(required[mount])))
+		}
+	}
+	return shortages
+}
+
+// checkDiskSpace checks the free space of the filesystems before the updates.
+func checkDiskSpace(config Config) preflightCheck {
+	check := preflightCheck{Check: preflightCheckDisk}
+
+	download, installed, err := transactionSize(config)
+	if err != nil {
+		// the thresholds are still checked without the estimate.
+		log.WithField("component", "preflight").Warn(err)
+	}
+
+	paths := []string{"/", "/var"}
+	for _, t := range config.minFreeSpace {
+		if !containsString(paths, t.path) {
+			paths = append(paths, t.path)
+		}
+	}
+	filesystems, err := listFilesystems(paths)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+
+	shortages := diskSpaceShortages(config.minFreeSpace, filesystems, download, installed)
+	if len(shortages) > 0 {
+		check.Message = strings.Join(shortages, ", ")
+		return check
+	}
+	check.Passed = true
+	return check
+}
+
+// checkRPMDB checks the health of the rpm database.
+func checkRPMDB() preflightCheck {
+	check := preflightCheck{Check: preflightCheckRPMDB}
+
+	stderr := bytes.Buffer{}
+	cmd := buildVerifyRPMDBCommand()
+	cmd.Stderr = &stderr
+
+	if err := runCommand(cmd); err != nil {
+		check.Message = fmt.Sprintf("rpm --verifydb did not run successfully: %v", err)
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			check.Message += ": " + strings.Split(s, "\n")[0]
+		}
+		return check
+	}
+	check.Passed = true
+	return check
+}
+
+// checkTransactions checks for the transactions of yum left incomplete.
+func checkTransactions() preflightCheck {
+	check := preflightCheck{Check: preflightCheckTransactions}
+
+	result := bytes.Buffer{}
+	cmd := buildListTransactionsCommand()
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		check.Message = fmt.Sprintf("can not list the incomplete transactions: %v", err)
+		return check
+	}
+	transactions := strings.Fields(result.String())
+	if len(transactions) > 0 {
+		check.Message = fmt.Sprintf("%d incomplete transactions, complete or clean them with yum-complete-transaction", len(transactions))
+		return check
+	}
+	check.Passed = true
+	return check
+}
+
+// runPreflightChecks runs the preflight checks of the config.
+func runPreflightChecks(config Config) []preflightCheck {
+	checks := make([]preflightCheck, 0, len(config.preflightChecks))
+	for _, c := range config.preflightChecks {
+		var check preflightCheck
+		switch c {
+		case preflightCheckDisk:
+			check = checkDiskSpace(config)
+		case preflightCheckRPMDB:
+			check = checkRPMDB()
+		case preflightCheckTransactions:
+			check = checkTransactions()
+		}
+
+		logger := log.WithFields(log.Fields{"component": "preflight", "check": c})
+		if check.Passed {
+			logger.Infof("preflight check passed")
+		} else {
+			logger.Warnf("preflight check failed: %s", check.Message)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// failedPreflightChecks returns the names of the failed checks.
+func failedPreflightChecks(checks []preflightCheck) []string {
+	failed := make([]string, 0)
+	for _, c := range checks {
+		if !c.Passed {
+			failed = append(failed, c.Check)
+		}
+	}
+	return failed
+}
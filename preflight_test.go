@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validTransactionSummary = []string{
+	"Transaction Summary",
+	"================================================================================",
+	"Upgrade  5 Packages",
+	"",
+	"Total download size: 54 M",
+	"Installed size: 1.2 G",
+	"Exiting on user command",
+	"Your transaction was saved, rerun it with:",
+}
+
+// dfOutput returns the output of df -P -B1 for paths on a single
+// filesystem with the available bytes.
+func dfOutput(paths []string, available uint64) string {
+	lines := []string{"Filesystem     1-blocks       Used   Available Capacity Mounted on"}
+	for range paths {
+		lines = append(lines, fmt.Sprintf("/dev/vda1  64424509440 1073741824 %d  2%% /", available))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseByteSize(t *testing.T) {
+	var tests = []struct {
+		size     string
+		expected uint64
+	}{
+		{"512", 512},
+		{"830 k", 830 << 10},
+		{"54 M", 54 << 20},
+		{"1.5G", 3 << 29},
+		{"2TB", 2 << 40},
+	}
+	for _, tt := range tests {
+		b, err := parseByteSize(tt.size)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, b, tt.size)
+	}
+
+	for _, s := range []string{"", "M", "12 X", "-1G"} {
+		_, err := parseByteSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	assert.Equal(t, "512", formatByteSize(512))
+	assert.Equal(t, "54.0M", formatByteSize(54<<20))
+	assert.Equal(t, "1.5G", formatByteSize(3<<29))
+}
+
+func TestParsePreflightFlags(t *testing.T) {
+	defer func() {
+		preflightChecks = defaultPreflightChecks
+		preflightMinFree = defaultPreflightMinFree
+	}()
+
+	preflightChecks = "disk,rpmdb"
+	preflightMinFree = "/=1G,/boot=100M"
+	config := Config{}
+	assert.NoError(t, parsePreflightFlags(&config))
+	assert.Equal(t, []string{preflightCheckDisk, preflightCheckRPMDB}, config.preflightChecks)
+	assert.Equal(t, []freeSpaceThreshold{{"/", 1 << 30}, {"/boot", 100 << 20}}, config.minFreeSpace)
+
+	preflightChecks = "disk,network"
+	assert.Error(t, parsePreflightFlags(&config))
+
+	preflightChecks = "disk"
+	for _, s := range []string{"var=1G", "/var", "/var=lots", "=1G"} {
+		preflightMinFree = s
+		assert.Error(t, parsePreflightFlags(&config), s)
+	}
+}
+
+func TestParseDf(t *testing.T) {
+	output := []byte(`Filesystem     1-blocks        Used   Available Capacity Mounted on
+/dev/vda1    42938118144  9876543210 33061574934      23% /
+/dev/vda2     1063256064   241172480   822083584      23% /boot
+`)
+	filesystems, err := parseDf(output)
+	assert.NoError(t, err)
+	assert.Equal(t, []filesystem{{"/", 33061574934}, {"/boot", 822083584}}, filesystems)
+
+	_, err = parseDf([]byte("/dev/vda1 1 1 x 1% /"))
+	assert.Error(t, err)
+}
+
+func TestParseTransactionSize(t *testing.T) {
+	download, installed, found := parseTransactionSize([]byte(strings.Join(validTransactionSummary, "\n")))
+	assert.True(t, found)
+	assert.Equal(t, uint64(54<<20), download)
+	assert.Equal(t, uint64(1288490189), installed)
+
+	_, _, found = parseTransactionSize([]byte("No packages marked for update"))
+	assert.False(t, found)
+}
+
+func TestDiskSpaceShortages(t *testing.T) {
+	thresholds := []freeSpaceThreshold{{"/", 500 << 20}, {"/var", 1 << 30}, {"/boot", 100 << 20}}
+
+	// /var on the root filesystem, the highest threshold applies
+	filesystems := map[string]filesystem{
+		"/":     {"/", 2 << 30},
+		"/var":  {"/", 2 << 30},
+		"/boot": {"/boot", 50 << 20},
+	}
+	assert.Equal(t, []string{
+		"/ has 2.0G free, 2.5G required",
+		"/boot has 50.0M free, 100.0M required",
+	}, diskSpaceShortages(thresholds, filesystems, 512<<20, 1<<30))
+
+	filesystems["/boot"] = filesystem{"/boot", 200 << 20}
+	assert.Empty(t, diskSpaceShortages(thresholds, filesystems, 512<<20, 0))
+}
+
+func TestRunPreflightChecks(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	config := Config{
+		preflightChecks: []string{preflightCheckDisk, preflightCheckRPMDB, preflightCheckTransactions},
+		minFreeSpace:    []freeSpaceThreshold{{"/boot", 100 << 20}},
+	}
+
+	testName = testRunUpdateAvailable
+	checks := runPreflightChecks(config)
+	assert.Equal(t, []preflightCheck{
+		{Check: preflightCheckDisk, Passed: true},
+		{Check: preflightCheckRPMDB, Passed: true},
+		{Check: preflightCheckTransactions, Passed: true},
+	}, checks)
+	assert.Empty(t, failedPreflightChecks(checks))
+
+	testName = testPreflightFailure
+	checks = runPreflightChecks(config)
+	assert.Equal(t, []string{preflightCheckDisk, preflightCheckRPMDB, preflightCheckTransactions}, failedPreflightChecks(checks))
+	assert.Equal(t, "/ has 200.0M free, 1.4G required", checks[0].Message)
+	assert.Contains(t, checks[1].Message, "Thread died in Berkeley DB library")
+	assert.Equal(t, "1 incomplete transactions, complete or clean them with yum-complete-transaction", checks[2].Message)
+
+	testName = testDefaultFailure
+	checks = runPreflightChecks(config)
+	assert.Contains(t, checks[0].Message, "df did not run successfully")
+}
+
+func TestRunPreflightFailure(t *testing.T) {
+	testName = testPreflightFailure
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	eventSinks = []EventSink{m}
+	defer func() { eventSinks = nil }()
+
+	config := Config{preflightChecks: []string{preflightCheckRPMDB}}
+	result := runOnce(config)
+	assert.False(t, result.Failed)
+	assert.False(t, result.Updated)
+	assert.True(t, result.Skipped)
+	assert.Len(t, result.Packages, 5)
+	assert.Equal(t, "5 packages with updates, update skipped by the preflight checks", result.String())
+	assert.Contains(t, result.summary("localhost"), "  rpmdb failed: rpm --verifydb did not run successfully")
+	assert.Equal(t, exitSkipped, updateExitCode(result))
+
+	textfile := filepath.Join(dir, "yumsecupdater.prom")
+	assert.NoError(t, writeTextfile(textfile, m.registry))
+	data, err := ioutil.ReadFile(textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_last_run_skipped{category="security",node="localhost"} 1
+yumsecupdater_preflight_check_success{category="security",check="rpmdb",node="localhost"} 0`)
+
+	// the checks are not run in dry-run mode
+	config.dryRun = true
+	result = runOnce(config)
+	assert.False(t, result.Skipped)
+	assert.Empty(t, result.Preflight)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons of a reboot.
+const (
+	rebootReasonKernel         = "kernel"
+	rebootReasonGlibc          = "glibc"
+	rebootReasonSystemd        = "systemd"
+	rebootReasonPackageManager = "package-manager"
+)
+
+// kernelPackage is the package of the kernels installed on the host.
+const kernelPackage = "kernel"
+
+// rebootRequiredPackageRegex matches the core packages listed by needs-restarting -r.
+var rebootRequiredPackageRegex = regexp.MustCompile(`^\s*\*\s+(\S+)\s*$`)
+
+// kernelInfo holds the running kernel, the newest installed kernel
+// and the number of installed kernels.
+type kernelInfo struct {
+	running, installed string
+	count              int
+}
+
+// outdated returns true if the running kernel is not the newest installed one.
+func (k kernelInfo) outdated() bool {
+	return k.running != "" && k.installed != "" && k.running != k.installed
+}
+
+// parseRebootRequiredPackages parses the core packages updated since
+// boot-up from the output of needs-restarting -r.
+func parseRebootRequiredPackages(output []byte) []string {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	packages := make([]string, 0)
+
+	for sc.Scan() {
+		if m := rebootRequiredPackageRegex.FindStringSubmatch(sc.Text()); m != nil {
+			packages = append(packages, m[1])
+		}
+	}
+
+	return packages
+}
+
+// buildRunningKernelCommand returns the exec command to get the running kernel.
+func buildRunningKernelCommand() *exec.Cmd {
+	cmd := []string{"uname", "-r"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// newestKernel returns the version-release.arch of the newest kernel,
+// the format of uname -r.
+func newestKernel(kernels []installedPackage) string {
+	newest := installedPackage{}
+	for _, k := range kernels {
+		if newest.name == "" || compareEVR(k.evr(), newest.evr()) > 0 {
+			newest = k
+		}
+	}
+	if newest.name == "" {
+		return ""
+	}
+	return kernelRelease(newest)
+}
+
+// runningKernel returns the version-release.arch of the running kernel.
+func runningKernel() (string, error) {
+	result := bytes.Buffer{}
+	cmd := buildRunningKernelCommand()
+	cmd.Stdout = &result
+	if err := runCommand(cmd); err != nil {
+		return "", fmt.Errorf("uname did not run successfully: %v", err)
+	}
+	return strings.TrimSpace(result.String()), nil
+}
+
+// getKernelInfo returns the running kernel, the newest installed kernel
+// and the number of installed kernels.
+func getKernelInfo() (kernelInfo, error) {
+	info := kernelInfo{}
+
+	running, err := runningKernel()
+	if err != nil {
+		return info, err
+	}
+	info.running = running
+
+	kernels, err := listInstalledPackages(kernelPackage)
+	if err != nil {
+		return info, err
+	}
+	info.installed = newestKernel(kernels)
+	info.count = len(kernels)
+
+	return info, nil
+}
+
+// rebootReasons returns why a reboot is required from the core packages
+// listed by needs-restarting and the kernels.
+func rebootReasons(packages []string, kernel kernelInfo) []string {
+	reasons := make([]string, 0)
+	add := func(reason string) {
+		if !containsString(reasons, reason) {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if kernel.outdated() {
+		add(rebootReasonKernel)
+	}
+	for _, p := range packages {
+		switch {
+		case strings.HasPrefix(p, kernelPackage):
+			add(rebootReasonKernel)
+		case p == rebootReasonGlibc:
+			add(rebootReasonGlibc)
+		case p == rebootReasonSystemd:
+			add(rebootReasonSystemd)
+		default:
+			add(rebootReasonPackageManager)
+		}
+	}
+	// needs-restarting asked for a reboot without saying why.
+	if len(reasons) == 0 {
+		add(rebootReasonPackageManager)
+	}
+
+	return reasons
+}
+
+// classifyReboot returns the reasons of a required reboot and the kernels.
+func classifyReboot(packages []string) ([]string, kernelInfo) {
+	kernel, err := getKernelInfo()
+	if err != nil {
+		log.Error(err)
+	}
+
+	reasons := rebootReasons(packages, kernel)
+	log.WithFields(log.Fields{
+		"reasons":          reasons,
+		"running_kernel":   kernel.running,
+		"installed_kernel": kernel.installed,
+	}).Infof("reboot required")
+
+	return reasons, kernel
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validRebootRequired = []string{
+	"Core libraries or services have been updated since boot-up:",
+	"  * glibc",
+	"  * kernel",
+	"  * systemd",
+	"",
+	"Reboot is required to fully utilize these updates.",
+	"More information: https://access.redhat.com/solutions/27943",
+}
+
+const validRunningKernel = "3.10.0-1160.el7.x86_64"
+
+var validInstalledKernels = []string{
+	"kernel\t(none)\t3.10.0\t1160.el7\tx86_64\tRed Hat, Inc.\tGPLv2",
+	"kernel\t(none)\t3.10.0\t1160.45.1.el7\tx86_64\tRed Hat, Inc.\tGPLv2",
+	"kernel\t(none)\t3.10.0\t1160.6.1.el7\tx86_64\tRed Hat, Inc.\tGPLv2",
+}
+
+func TestParseRebootRequiredPackages(t *testing.T) {
+	packages := parseRebootRequiredPackages([]byte(strings.Join(validRebootRequired, "\n")))
+	assert.Equal(t, []string{"glibc", "kernel", "systemd"}, packages)
+
+	assert.Empty(t, parseRebootRequiredPackages([]byte("Reboot should not be necessary.\n")))
+}
+
+func TestNewestKernel(t *testing.T) {
+	kernels := parseInstalledPackages([]byte(strings.Join(validInstalledKernels, "\n")))
+	assert.Equal(t, "3.10.0-1160.45.1.el7.x86_64", newestKernel(kernels))
+	assert.Equal(t, "", newestKernel(nil))
+}
+
+func TestRebootReasons(t *testing.T) {
+	upToDate := kernelInfo{running: "3.10.0-1160.el7.x86_64", installed: "3.10.0-1160.el7.x86_64"}
+	outdated := kernelInfo{running: "3.10.0-1160.el7.x86_64", installed: "3.10.0-1160.45.1.el7.x86_64"}
+
+	var tests = []struct {
+		packages []string
+		kernel   kernelInfo
+		expected []string
+	}{
+		{nil, outdated, []string{rebootReasonKernel}},
+		{[]string{"kernel-core"}, upToDate, []string{rebootReasonKernel}},
+		{[]string{"glibc", "systemd"}, upToDate, []string{rebootReasonGlibc, rebootReasonSystemd}},
+		{[]string{"linux-firmware", "dbus"}, upToDate, []string{rebootReasonPackageManager}},
+		{[]string{"glibc", "kernel"}, outdated, []string{rebootReasonKernel, rebootReasonGlibc}},
+		{nil, kernelInfo{}, []string{rebootReasonPackageManager}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rebootReasons(tt.packages, tt.kernel), "%v %v", tt.packages, tt.kernel)
+	}
+}
+
+func TestGetKernelInfo(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	info, err := getKernelInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, kernelInfo{running: validRunningKernel, installed: "3.10.0-1160.45.1.el7.x86_64", count: 3}, info)
+	assert.True(t, info.outdated())
+}
+
+func TestRunRebootReasons(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	result := &RunResult{}
+	assert.NoError(t, run(Config{}, result))
+	assert.True(t, result.RebootRequired)
+	assert.Equal(t, []string{rebootReasonKernel, rebootReasonGlibc, rebootReasonSystemd}, result.RebootReasons)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reportTimeFormat is the format of the start time in the report file names,
+// the names of the reports of a category sort by time.
+const reportTimeFormat = "20060102T150405Z"
+
+// ReportWriter writes a JSON report of every run to a directory.
+type ReportWriter struct {
+	dir  string
+	node string
+	// retention is the number of reports kept for each category, all if 0.
+	retention int
+}
+
+// newReportWriter returns a ReportWriter writing into dir.
+func newReportWriter(dir, node string, retention int) *ReportWriter {
+	return &ReportWriter{dir: dir, node: node, retention: retention}
+}
+
+// validateReportRetention checks if the number of reports kept is valid.
+func validateReportRetention(retention int) error {
+	if retention < 0 {
+		return fmt.Errorf("invalid number of reports to keep: %d", retention)
+	}
+	return nil
+}
+
+// runReport is the content of a report file.
+type runReport struct {
+	Node string `json:"node"`
+	*RunResult
+}
+
+// Send implements EventSink.
+func (w *ReportWriter) Send(e Event) {
+	if e.Reason != eventRunCompleted || e.Result == nil {
+		return
+	}
+	if err := w.write(e.Result); err != nil {
+		log.WithField("component", "report").Error(err)
+	}
+}
+
+// write writes the report of a run to a file named after the node, the
+// category and the start time, then removes the reports beyond the retention.
+func (w *ReportWriter) write(r *RunResult) error {
+	data, err := json.MarshalIndent(runReport{Node: w.node, RunResult: r}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	category := r.Category
+	if category == "" {
+		category = categorySecurity
+	}
+	file := fmt.Sprintf("%s-%s-%s.json", w.node, category, r.Start.UTC().Format(reportTimeFormat))
+	path := filepath.Join(w.dir, file)
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("can not write report: %v", err)
+	}
+
+	log.WithField("component", "report").Infof("report written to %s", path)
+
+	return w.prune(category)
+}
+
+// prune removes the oldest reports of a category beyond the retention.
+func (w *ReportWriter) prune(category string) error {
+	if w.retention == 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(w.dir, fmt.Sprintf("%s-%s-*.json", w.node, category)))
+	if err != nil {
+		return fmt.Errorf("can not list reports: %v", err)
+	}
+	if len(files) <= w.retention {
+		return nil
+	}
+
+	sort.Strings(files)
+	for _, path := range files[:len(files)-w.retention] {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("can not remove report: %v", err)
+		}
+		log.WithField("component", "report").Infof("report %s removed", path)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	result := testRunResult()
+	result.Diff = &PackageDiff{
+		Upgraded: []PackageChange{{Name: "sudo", Arch: "x86_64", OldNEVRA: "sudo-1.8.23-9.el7.x86_64", NewNEVRA: "sudo-1.8.23-10.el7_9.1.x86_64"}},
+	}
+
+	w := newReportWriter(dir, "node1", 0)
+	w.Send(Event{Reason: eventUpdateSucceeded})
+	w.Send(Event{Reason: eventRunCompleted, Result: result})
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "node1-security-20211001T120000Z.json"))
+	assert.NoError(t, err)
+
+	report := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "node1", report["node"])
+	assert.Equal(t, true, report["updated"])
+	assert.Contains(t, report, "diff")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestReportWriterRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := newReportWriter(dir, "node1", 2)
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		// runs of two categories started at the same time
+		for _, category := range []string{categorySecurity, categoryBugfix} {
+			w.Send(Event{Reason: eventRunCompleted, Result: &RunResult{Category: category, Start: start.Add(time.Duration(i) * time.Hour)}})
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.NoError(t, err)
+	for i := range files {
+		files[i] = filepath.Base(files[i])
+	}
+	assert.Equal(t, []string{
+		"node1-bugfix-20211001T130000Z.json",
+		"node1-bugfix-20211001T140000Z.json",
+		"node1-security-20211001T130000Z.json",
+		"node1-security-20211001T140000Z.json",
+	}, files)
+}
+
+func TestValidateReportRetention(t *testing.T) {
+	assert.NoError(t, validateReportRetention(0))
+	assert.NoError(t, validateReportRetention(30))
+	assert.Error(t, validateReportRetention(-1))
+}
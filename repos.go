@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Settings of a repository disabling its checks.
+const (
+	repoSettingGPGCheck  = "gpgcheck"
+	repoSettingSSLVerify = "sslverify"
+)
+
+const (
+	// yumConfFile is the main config of yum on the host, the settings of
+	// its [main] section are the defaults of the repositories.
+	yumConfFile     = "/etc/yum.conf"
+	repoMainSection = "main"
+)
+
+// repoUpdatedFormat is the format of the Repo-updated field of yum repolist -v.
+const repoUpdatedFormat = "Mon Jan _2 15:04:05 2006"
+
+var (
+	// repolistFieldRegex matches a field of a repository in yum repolist -v,
+	// like "Repo-id      : rhel-7-server-rpms/7Server/x86_64".
+	repolistFieldRegex = regexp.MustCompile(`^(Repo-[\w-]+)\s*:\s*(.*)$`)
+	// repoFailureRegexes match the repositories whose metadata can not be
+	// downloaded in the errors of yum and dnf.
+	repoFailureRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`failure: \S+ from ([^:\s]+):`),
+		regexp.MustCompile(`for repository: (\S+?)\.\s+Please verify`),
+		regexp.MustCompile(`Failed to download metadata for repo '([^']+)'`),
+	}
+	// repoSectionRegex matches the section of a repository in a .repo file.
+	repoSectionRegex = regexp.MustCompile(`^\[([^\]]+)\]\s*$`)
+	// repoExpireLastRegex matches the time of the last download of the
+	// metadata in the Repo-expire field of yum repolist -v.
+	repoExpireLastRegex = regexp.MustCompile(`\(last: (.+)\)$`)
+)
+
+// repository is an enabled yum repository of the host.
+type repository struct {
+	id, name, baseurl, filename string
+	// updated is the time of the metadata, zero if unknown.
+	updated time.Time
+	// refreshed is the time of the last download of the metadata
+	// into the cache, zero if unknown.
+	refreshed time.Time
+	pkgs      int
+	reachable bool
+	// insecure are the settings disabling the checks of the repository.
+	insecure []string
+}
+
+// metadataAge returns the age of the metadata of the repository.
+func (r repository) metadataAge(now time.Time) time.Duration {
+	return now.Sub(r.updated)
+}
+
+// cacheAge returns the time since the metadata of the repository was downloaded.
+func (r repository) cacheAge(now time.Time) time.Duration {
+	return now.Sub(r.refreshed)
+}
+
+// buildRepolistCommand returns the exec command to list the enabled
+// repositories with their metadata, the unavailable ones are skipped
+// so the others are still listed.
+func buildRepolistCommand(config Config) *exec.Cmd {
+	cmd := []string{"yum", "-y", "-v", "repolist", "enabled"}
+	cmd = append(cmd, yumCacheArgs(config)...)
+	cmd = append(cmd, "--setopt=*.skip_if_unavailable=1")
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildReadRepoFileCommand returns the exec command to read a .repo file of the host.
+func buildReadRepoFileCommand(file string) *exec.Cmd {
+	cmd := []string{"cat", file}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// repoID returns the id of a repository without the releasever and
+// basearch of yum repolist, like rhel-7-server-rpms for
+// rhel-7-server-rpms/7Server/x86_64.
+func repoID(id string) string {
+	id = strings.TrimLeft(id, "!*")
+	if i := strings.Index(id, "/"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// parseRepolist parses the repositories of the output of yum repolist -v.
+func parseRepolist(output []byte) []repository {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	repos := make([]repository, 0)
+
+	for sc.Scan() {
+		m := repolistFieldRegex.FindStringSubmatch(strings.TrimSpace(sc.Text()))
+		if m == nil {
+			continue
+		}
+		key, value := m[1], strings.TrimSpace(m[2])
+		if key == "Repo-id" {
+			repos = append(repos, repository{id: repoID(value), reachable: true})
+			continue
+		}
+		if len(repos) == 0 {
+			continue
+		}
+
+		r := &repos[len(repos)-1]
+		switch key {
+		case "Repo-name":
+			r.name = value
+		case "Repo-baseurl":
+			// the other mirrors are listed after a comma
+			r.baseurl = strings.TrimSpace(strings.Split(value, ",")[0])
+		case "Repo-filename":
+			r.filename = value
+		case "Repo-pkgs":
+			r.pkgs, _ = strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+		case "Repo-updated":
+			if t, err := time.ParseInLocation(repoUpdatedFormat, value, time.Local); err == nil {
+				r.updated = t
+			}
+		case "Repo-expire":
+			if m := repoExpireLastRegex.FindStringSubmatch(value); m != nil {
+				if t, err := time.ParseInLocation(repoUpdatedFormat, m[1], time.Local); err == nil {
+					r.refreshed = t
+				}
+			}
+		}
+	}
+
+	return repos
+}
+
+// parseRepoFailures returns the repositories whose metadata can not be
+// downloaded according to the errors of yum.
+func parseRepoFailures(output []byte) []string {
+	failures := make([]string, 0)
+	for _, re := range repoFailureRegexes {
+		for _, m := range re.FindAllSubmatch(output, -1) {
+			id := repoID(string(m[1]))
+			if !containsString(failures, id) {
+				failures = append(failures, id)
+			}
+		}
+	}
+	return failures
+}
+
+// isDisabled returns true if the value of a boolean setting of yum is false.
+func isDisabled(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "0", "no", "false", "off":
+		return true
+	}
+	return false
+}
+
+// parseRepoFile returns the settings of the checks set in each section
+// of a .repo file, true if the check is disabled.
+func parseRepoFile(output []byte) map[string]map[string]bool {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	settings := map[string]map[string]bool{}
+	section := ""
+
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if m := repoSectionRegex.FindStringSubmatch(line); m != nil {
+			section = strings.TrimSpace(m[1])
+			continue
+		}
+		i := strings.Index(line, "=")
+		if section == "" || i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), line[i+1:]
+		if key == repoSettingGPGCheck || key == repoSettingSSLVerify {
+			if settings[section] == nil {
+				settings[section] = map[string]bool{}
+			}
+			settings[section][key] = isDisabled(value)
+		}
+	}
+
+	return settings
+}
+
+// insecureSettings returns the settings disabling the checks of a repository,
+// the defaults apply to the checks the repository does not set.
+func insecureSettings(repo, defaults map[string]bool) []string {
+	var insecure []string
+	for _, key := range []string{repoSettingGPGCheck, repoSettingSSLVerify} {
+		disabled, ok := repo[key]
+		if !ok {
+			disabled = defaults[key]
+		}
+		if disabled {
+			insecure = append(insecure, key)
+		}
+	}
+	return insecure
+}
+
+// readRepoFile returns the settings of the checks set in each section
+// of a .repo file of the host.
+func readRepoFile(file string) (map[string]map[string]bool, error) {
+	result := bytes.Buffer{}
+	cmd := buildReadRepoFileCommand(file)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("can not read repo file %s: %v", file, err)
+	}
+	return parseRepoFile(result.Bytes()), nil
+}
+
+// markUnreachable marks the repositories whose metadata can not be
+// downloaded as unreachable, the repositories not listed are added.
+func markUnreachable(repos []repository, ids []string) []repository {
+	index := map[string]int{}
+	for i, r := range repos {
+		index[r.id] = i
+	}
+	for _, id := range ids {
+		if i, ok := index[id]; ok {
+			repos[i].reachable = false
+			continue
+		}
+		index[id] = len(repos)
+		repos = append(repos, repository{id: id})
+	}
+	return repos
+}
+
+// listRepositories returns the enabled repositories of the host with
+// their reachability and the checks disabled in their .repo file or
+// in the [main] section of yum.conf.
+// The reachability is not checked with the cached metadata only.
+func listRepositories(config Config) ([]repository, error) {
+	log.WithField("component", "repos").Infof("check repositories")
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := buildRepolistCommand(config)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := runCommand(cmd)
+	repos := parseRepolist(stdout.Bytes())
+	if err != nil && len(repos) == 0 {
+		return nil, fmt.Errorf("yum repolist did not run successfully: %v", err)
+	}
+
+	repos = markUnreachable(repos, parseRepoFailures(stderr.Bytes()))
+
+	files := make([]string, 0)
+	for _, r := range repos {
+		if r.filename != "" && !containsString(files, r.filename) {
+			files = append(files, r.filename)
+		}
+	}
+	sort.Strings(files)
+	var defaults map[string]bool
+	if len(files) > 0 {
+		settings, err := readRepoFile(yumConfFile)
+		if err != nil {
+			log.Error(err)
+		}
+		defaults = settings[repoMainSection]
+	}
+	for _, file := range files {
+		settings, err := readRepoFile(file)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		for i := range repos {
+			if repos[i].filename == file {
+				repos[i].insecure = insecureSettings(settings[repos[i].id], defaults)
+			}
+		}
+	}
+
+	for _, r := range repos {
+		fields := log.Fields{"component": "repos", "repo": r.id}
+		if !r.reachable {
+			log.WithFields(fields).Warnf("repository unreachable")
+		}
+		if len(r.insecure) > 0 {
+			log.WithFields(fields).WithField("settings", r.insecure).Warnf("repository checks disabled")
+		}
+	}
+
+	return repos, nil
+}
+
+// unreachableRepositories returns the ids of the unreachable repositories.
+func unreachableRepositories(repos []repository) []string {
+	ids := make([]string, 0)
+	for _, r := range repos {
+		if !r.reachable {
+			ids = append(ids, r.id)
+		}
+	}
+	return ids
+}
+
+// explainCheckUpdateError adds the unreachable repositories to a failure of
+// yum check-update run with the config, the error is returned as is when
+// none is found.
+func explainCheckUpdateError(config Config, err error) error {
+	repos, rerr := listRepositories(config)
+	if rerr != nil {
+		log.Error(rerr)
+		return err
+	}
+	ids := unreachableRepositories(repos)
+	if len(ids) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w, unreachable repositories: %s", err, strings.Join(ids, ","))
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validRepolist = []string{
+	"Loading \"product-id\" plugin",
+	"Config time: 0.012",
+	"Repo-id      : rhel-7-server-rpms/7Server/x86_64",
+	"Repo-name    : Red Hat Enterprise Linux 7 Server (RPMs)",
+	"Repo-status  : enabled",
+	"Repo-revision: 1633001234",
+	"Repo-updated : Thu Sep 30 12:00:00 2021",
+	"Repo-pkgs    : 32,521",
+	"Repo-size    : 58 G",
+	"Repo-baseurl : https://cdn.redhat.com/content/dist/rhel/server/7/7Server/x86_64/os",
+	"Repo-expire  : 86,400 second(s) (last: Fri Oct  1 08:00:00 2021)",
+	"  Filter     : read-only:present",
+	"Repo-filename: /etc/yum.repos.d/redhat.repo",
+	"",
+	"Repo-id      : docker-ce-stable/x86_64",
+	"Repo-name    : Docker CE Stable - x86_64",
+	"Repo-status  : enabled",
+	"Repo-updated : Mon Sep 27 09:30:00 2021",
+	"Repo-pkgs    : 128",
+	"Repo-baseurl : https://download.docker.com/linux/centos/7/x86_64/stable, https://mirror/stable",
+	"Repo-filename: /etc/yum.repos.d/docker-ce.repo",
+	"",
+	"repolist: 32,649",
+}
+
+var validRepoFailures = []string{
+	"https://internal.example.com/el7/repodata/repomd.xml: [Errno 14] curl#7 - \"Failed to connect to internal.example.com port 443: Connection refused\"",
+	"Trying other mirror.",
+	"failure: repodata/repomd.xml from internal-tools: [Errno 256] No more mirrors to try.",
+}
+
+var validRepoFile = []string{
+	"# managed by puppet",
+	"[docker-ce-stable]",
+	"name=Docker CE Stable - $basearch",
+	"baseurl=https://download.docker.com/linux/centos/7/$basearch/stable",
+	"enabled=1",
+	"gpgcheck = 0",
+	"",
+	"[rhel-7-server-rpms]",
+	"gpgcheck=1",
+	"sslverify=False",
+}
+
+var validYumConf = []string{
+	"[main]",
+	"cachedir=/var/cache/yum/$basearch/$releasever",
+	"gpgcheck=0",
+	"sslverify=0",
+}
+
+func TestRepoID(t *testing.T) {
+	assert.Equal(t, "rhel-7-server-rpms", repoID("rhel-7-server-rpms/7Server/x86_64"))
+	assert.Equal(t, "epel", repoID("!epel/x86_64"))
+	assert.Equal(t, "local", repoID("local"))
+}
+
+func TestParseRepolist(t *testing.T) {
+	repos := parseRepolist([]byte(strings.Join(validRepolist, "\n")))
+	assert.Equal(t, []repository{
+		{
+			id:        "rhel-7-server-rpms",
+			name:      "Red Hat Enterprise Linux 7 Server (RPMs)",
+			baseurl:   "https://cdn.redhat.com/content/dist/rhel/server/7/7Server/x86_64/os",
+			filename:  "/etc/yum.repos.d/redhat.repo",
+			updated:   time.Date(2021, time.September, 30, 12, 0, 0, 0, time.Local),
+			refreshed: time.Date(2021, time.October, 1, 8, 0, 0, 0, time.Local),
+			pkgs:      32521,
+			reachable: true,
+		},
+		{
+			id:        "docker-ce-stable",
+			name:      "Docker CE Stable - x86_64",
+			baseurl:   "https://download.docker.com/linux/centos/7/x86_64/stable",
+			filename:  "/etc/yum.repos.d/docker-ce.repo",
+			updated:   time.Date(2021, time.September, 27, 9, 30, 0, 0, time.Local),
+			pkgs:      128,
+			reachable: true,
+		},
+	}, repos)
+
+	assert.Empty(t, parseRepolist([]byte("repolist: 0")))
+}
+
+func TestParseRepoFailures(t *testing.T) {
+	assert.Equal(t, []string{"internal-tools"}, parseRepoFailures([]byte(strings.Join(validRepoFailures, "\n"))))
+	assert.Equal(t, []string{"epel"}, parseRepoFailures([]byte("Cannot retrieve repository metadata (repomd.xml) for repository: epel. Please verify its path and try again")))
+	assert.Equal(t, []string{"appstream"}, parseRepoFailures([]byte("Error: Failed to download metadata for repo 'appstream': Cannot download repomd.xml")))
+}
+
+func TestParseRepoFile(t *testing.T) {
+	assert.Equal(t, map[string]map[string]bool{
+		"docker-ce-stable":   {repoSettingGPGCheck: true},
+		"rhel-7-server-rpms": {repoSettingGPGCheck: false, repoSettingSSLVerify: true},
+	}, parseRepoFile([]byte(strings.Join(validRepoFile, "\n"))))
+}
+
+func TestInsecureSettings(t *testing.T) {
+	defaults := parseRepoFile([]byte(strings.Join(validYumConf, "\n")))[repoMainSection]
+	settings := parseRepoFile([]byte(strings.Join(validRepoFile, "\n")))
+
+	assert.Equal(t, []string{repoSettingGPGCheck}, insecureSettings(settings["docker-ce-stable"], nil))
+	assert.Equal(t, []string{repoSettingSSLVerify}, insecureSettings(settings["rhel-7-server-rpms"], nil))
+	// the settings of the repositories override the defaults of [main]
+	assert.Equal(t, []string{repoSettingGPGCheck, repoSettingSSLVerify}, insecureSettings(settings["docker-ce-stable"], defaults))
+	assert.Equal(t, []string{repoSettingSSLVerify}, insecureSettings(settings["rhel-7-server-rpms"], defaults))
+	assert.Equal(t, []string{repoSettingGPGCheck, repoSettingSSLVerify}, insecureSettings(nil, defaults))
+	assert.Empty(t, insecureSettings(nil, nil))
+}
+
+func TestListRepositories(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	repos, err := listRepositories(Config{})
+	assert.NoError(t, err)
+	assert.Len(t, repos, 3)
+	assert.Equal(t, []string{repoSettingSSLVerify}, repos[0].insecure)
+	// sslverify is disabled in the [main] section of yum.conf
+	assert.Equal(t, []string{repoSettingGPGCheck, repoSettingSSLVerify}, repos[1].insecure)
+	assert.Equal(t, repository{id: "internal-tools"}, repos[2])
+	assert.Equal(t, []string{"internal-tools"}, unreachableRepositories(repos))
+
+	testName = testDefaultFailure
+	_, err = listRepositories(Config{})
+	assert.Error(t, err)
+}
+
+func TestExplainCheckUpdateError(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	checkErr := &exec.ExitError{}
+	testName = testRunUpdateAvailable
+	err := explainCheckUpdateError(Config{}, checkErr)
+	assert.True(t, errors.Is(err, checkErr))
+	assert.Contains(t, err.Error(), "unreachable repositories: internal-tools")
+
+	// the repositories are listed with the config of the check
+	args := []string{}
+	execCommand = func(command string, a ...string) *exec.Cmd {
+		args = append(args, strings.Join(a, " "))
+		return helperCommand(command, a...)
+	}
+	assert.Error(t, explainCheckUpdateError(Config{cacheOnly: true}, checkErr))
+	assert.Contains(t, args[0], "repolist enabled -C")
+
+	execCommand = helperCommand
+	testName = testDefaultFailure
+	assert.Equal(t, checkErr, explainCheckUpdateError(Config{}, checkErr))
+}
+
+func TestFetchMetricsRepos(t *testing.T) {
+	testName = testMetricsUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.textfile = filepath.Join(dir, "yumsecupdater.prom")
+
+	m.fetchMetrics(Config{})
+	data, err := ioutil.ReadFile(m.textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_repo_up{node="localhost",repo="docker-ce-stable"} 1
+yumsecupdater_repo_up{node="localhost",repo="internal-tools"} 0
+yumsecupdater_repo_up{node="localhost",repo="rhel-7-server-rpms"} 1
+yumsecupdater_repo_insecure{node="localhost",repo="docker-ce-stable",setting="gpgcheck"} 1
+yumsecupdater_repo_insecure{node="localhost",repo="docker-ce-stable",setting="sslverify"} 1
+yumsecupdater_repo_insecure{node="localhost",repo="rhel-7-server-rpms",setting="sslverify"} 1`)
+	assertMetricsOutput(t, string(data), `yumsecupdater_repo_metadata_age_seconds{node="localhost",repo="docker-ce-stable"}`)
+	assertMetricsNotInOutput(t, string(data), `yumsecupdater_repo_metadata_age_seconds{node="localhost",repo="internal-tools"}`)
+
+	// the audits run once for all the categories, from the cache
+	var commands []string
+	execCommand = func(command string, args ...string) *exec.Cmd {
+		commands = append(commands, strings.Join(args, " "))
+		return helperCommand(command, args...)
+	}
+	count := func(sub string) int {
+		n := 0
+		for _, c := range commands {
+			if strings.Contains(c, sub) {
+				n++
+			}
+		}
+		return n
+	}
+	m.metadataMaxAge = 6 * time.Hour
+	m.fetchMetrics(Config{}, Config{category: categoryBugfix}, Config{category: categoryAll})
+	assert.Equal(t, 1, count("makecache"))
+	assert.Equal(t, 1, count("repolist enabled -C"))
+	assert.Equal(t, 1, count("uname"))
+	assert.Equal(t, 3, count("check-update -C"))
+
+	// the runs only check their category again
+	commands = nil
+	m.fetchUpdateMetrics(Config{category: categoryBugfix})
+	assert.Equal(t, 0, count("makecache"))
+	assert.Equal(t, 0, count("repolist"))
+	assert.Equal(t, 0, count("uname"))
+	assert.Equal(t, 1, count("check-update"))
+}
+
+func TestSetRepoMetrics(t *testing.T) {
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+
+	now := time.Date(2021, time.October, 1, 12, 0, 0, 0, time.UTC)
+	m.setRepoMetrics([]repository{{id: "epel", updated: now.Add(-36 * time.Hour), reachable: true}}, now)
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	textfile := filepath.Join(dir, "yumsecupdater.prom")
+	assert.NoError(t, writeTextfile(textfile, m.registry))
+
+	data, err := ioutil.ReadFile(textfile)
+	assert.NoError(t, err)
+	assertMetricsOutput(t, string(data), `yumsecupdater_repo_metadata_age_seconds{node="localhost",repo="epel"} 129600`)
+}
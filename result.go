@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RunResult holds the outcome of a run.
+type RunResult struct {
+	Start          time.Time           `json:"start"`
+	End            time.Time           `json:"end"`
+	DryRun         bool                `json:"dryRun"`
+	UpdateMode     string              `json:"updateMode,omitempty"`
+	Category       string              `json:"category,omitempty"`
+	Packages       []packageWithUpdate `json:"packages"`
+	Pinned         []packageWithUpdate `json:"pinned,omitempty"`
+	Advisories     []advisory          `json:"advisories"`
+	Updated        bool                `json:"updated"`
+	Skipped        bool                `json:"skipped,omitempty"`
+	Preflight      []preflightCheck    `json:"preflight,omitempty"`
+	Diff           *PackageDiff        `json:"diff,omitempty"`
+	RebootRequired bool                `json:"rebootRequired"`
+	RebootReasons  []string            `json:"rebootReasons,omitempty"`
+	Livepatches    []string            `json:"livepatches,omitempty"`
+	RemovedKernels []string            `json:"removedKernels,omitempty"`
+	Failed         bool                `json:"failed"`
+	Errors         []string            `json:"errors"`
+
+	ServicesNeedingRestart []string `json:"servicesNeedingRestart,omitempty"`
+	RestartedServices      []string `json:"restartedServices,omitempty"`
+}
+
+// newRunResult returns a RunResult for a run starting now.
+func newRunResult(config Config) *RunResult {
+	return &RunResult{
+		Start:      time.Now(),
+		DryRun:     config.dryRun,
+		UpdateMode: updateMode(config),
+		Category:   updateCategory(config),
+	}
+}
+
+// String returns a one line description of the result.
+func (r *RunResult) String() string {
+	switch {
+	case r.Failed:
+		return fmt.Sprintf("run failed after %d attempts", len(r.Errors))
+	case r.Skipped && r.RebootRequired:
+		return fmt.Sprintf("%d packages with updates, update skipped by the preflight checks, reboot scheduled", len(r.Packages))
+	case r.Skipped:
+		return fmt.Sprintf("%d packages with updates, update skipped by the preflight checks", len(r.Packages))
+	case r.Updated && r.RebootRequired:
+		return fmt.Sprintf("%d packages updated, reboot scheduled", len(r.Packages))
+	case r.Updated:
+		return fmt.Sprintf("%d packages updated", len(r.Packages))
+	case r.RebootRequired:
+		return "reboot scheduled"
+	case len(r.Packages) > 0:
+		return fmt.Sprintf("%d packages with updates, not updated", len(r.Packages))
+	default:
+		return "up-to-date"
+	}
+}
+
+// summary returns a human readable summary of the result.
+func (r *RunResult) summary(node string) string {
+	b := strings.Builder{}
+	timeFormat := "2006-01-02 15:04:05 MST"
+
+	fmt.Fprintf(&b, "Node: %s\n", node)
+	fmt.Fprintf(&b, "Start: %s\n", r.Start.Format(timeFormat))
+	fmt.Fprintf(&b, "End: %s\n", r.End.Format(timeFormat))
+	fmt.Fprintf(&b, "Dry-run: %t\n", r.DryRun)
+	if r.UpdateMode != "" {
+		fmt.Fprintf(&b, "Update mode: %s\n", r.UpdateMode)
+	}
+	if r.Category != "" {
+		fmt.Fprintf(&b, "Category: %s\n", r.Category)
+	}
+	fmt.Fprintf(&b, "Result: %s\n", r)
+
+	if r.Updated {
+		fmt.Fprintf(&b, "\nPackages updated (%d):\n", len(r.Packages))
+	} else {
+		fmt.Fprintf(&b, "\nPackages with updates (%d):\n", len(r.Packages))
+	}
+	for _, pkg := range r.Packages {
+		fmt.Fprintf(&b, "  %s.%s %s (%s)\n", pkg.name, pkg.arch, pkg.version, pkg.repo)
+	}
+	if len(r.Pinned) > 0 {
+		fmt.Fprintf(&b, "\nPackages held back by a pin (%d):\n", len(r.Pinned))
+		for _, pkg := range r.Pinned {
+			fmt.Fprintf(&b, "  %s.%s %s (%s)\n", pkg.name, pkg.arch, pkg.version, pkg.repo)
+		}
+	}
+
+	if len(r.Preflight) > 0 {
+		fmt.Fprintf(&b, "\nPreflight checks:\n")
+		for _, c := range r.Preflight {
+			if c.Passed {
+				fmt.Fprintf(&b, "  %s passed\n", c.Check)
+			} else {
+				fmt.Fprintf(&b, "  %s failed: %s\n", c.Check, c.Message)
+			}
+		}
+	}
+
+	if r.Diff != nil {
+		fmt.Fprintf(&b, "\nChanges: %d upgraded, %d installed, %d removed, %d downgraded\n",
+			len(r.Diff.Upgraded), len(r.Diff.Installed), len(r.Diff.Removed), len(r.Diff.Downgraded))
+		for _, c := range r.Diff.Upgraded {
+			fmt.Fprintf(&b, "  upgraded %s -> %s\n", c.OldNEVRA, c.NewNEVRA)
+		}
+		for _, c := range r.Diff.Downgraded {
+			fmt.Fprintf(&b, "  downgraded %s -> %s\n", c.OldNEVRA, c.NewNEVRA)
+		}
+		for _, c := range r.Diff.Installed {
+			fmt.Fprintf(&b, "  installed %s\n", c.NewNEVRA)
+		}
+		for _, c := range r.Diff.Removed {
+			fmt.Fprintf(&b, "  removed %s\n", c.OldNEVRA)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nAdvisories (%d):\n", len(r.Advisories))
+	for _, a := range r.Advisories {
+		severity := a.severity
+		if severity == "" {
+			severity = a.kind
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", a.id, severity, a.pkg)
+	}
+
+	if len(r.RemovedKernels) > 0 {
+		fmt.Fprintf(&b, "\nKernels removed: %s\n", strings.Join(r.RemovedKernels, ", "))
+	}
+
+	fmt.Fprintf(&b, "\nReboot scheduled: %t\n", r.RebootRequired)
+	if len(r.RebootReasons) > 0 {
+		fmt.Fprintf(&b, "Reboot reasons: %s\n", strings.Join(r.RebootReasons, ", "))
+	}
+	if len(r.Livepatches) > 0 {
+		fmt.Fprintf(&b, "Kernel live patched by: %s\n", strings.Join(r.Livepatches, ", "))
+	}
+
+	if len(r.RestartedServices) > 0 {
+		fmt.Fprintf(&b, "Services restarted: %s\n", strings.Join(r.RestartedServices, ", "))
+	}
+	if len(r.ServicesNeedingRestart) > 0 {
+		fmt.Fprintf(&b, "Services needing a restart: %s\n", strings.Join(r.ServicesNeedingRestart, ", "))
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "\nErrors:\n")
+		for _, e := range r.Errors {
+			fmt.Fprintf(&b, "  %s\n", e)
+		}
+	}
+
+	return b.String()
+}
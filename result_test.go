@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResultString(t *testing.T) {
+	var tests = []struct {
+		result   RunResult
+		expected string
+	}{
+		{RunResult{}, "up-to-date"},
+		{RunResult{Packages: make([]packageWithUpdate, 2)}, "2 packages with updates, not updated"},
+		{RunResult{Packages: make([]packageWithUpdate, 2), Updated: true}, "2 packages updated"},
+		{RunResult{Packages: make([]packageWithUpdate, 2), Updated: true, RebootRequired: true}, "2 packages updated, reboot scheduled"},
+		{RunResult{RebootRequired: true}, "reboot scheduled"},
+		{RunResult{Failed: true, Errors: []string{"err1", "err2"}}, "run failed after 2 attempts"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.result.String())
+	}
+}
+
+func TestRunResultSummary(t *testing.T) {
+	r := testRunResult()
+	r.UpdateMode = updateModeMinimal
+	r.Pinned = []packageWithUpdate{{name: "docker-ce", arch: "x86_64", version: "3:20.10.8-3.el7", repo: "docker-ce-stable"}}
+	r.Errors = []string{"yum-check-update did not run successfully"}
+	r.Diff = &PackageDiff{
+		Upgraded: []PackageChange{{Name: "sudo", Arch: "x86_64", OldNEVRA: "sudo-1.8.23-9.el7.x86_64", NewNEVRA: "sudo-1.8.23-10.el7_9.1.x86_64"}},
+	}
+
+	expected := `Node: node1
+Start: 2021-10-01 12:00:00 UTC
+End: 2021-10-01 12:05:00 UTC
+Dry-run: false
+Update mode: update-minimal
+Result: 1 packages updated, reboot scheduled
+
+Packages updated (1):
+  sudo.x86_64 1.8.23-10.el7_9.1 (rhel-7-server-rpms)
+
+Packages held back by a pin (1):
+  docker-ce.x86_64 3:20.10.8-3.el7 (docker-ce-stable)
+
+Changes: 1 upgraded, 0 installed, 0 removed, 0 downgraded
+  upgraded sudo-1.8.23-9.el7.x86_64 -> sudo-1.8.23-10.el7_9.1.x86_64
+
+Advisories (1):
+  RHSA-2021:0220 Important sudo-1.8.23-10.el7_9.1.x86_64
+
+Reboot scheduled: true
+
+Errors:
+  yum-check-update did not run successfully
+`
+	assert.Equal(t, expected, r.summary("node1"))
+}
+
+func TestNewRunResult(t *testing.T) {
+	assert.Equal(t, updateModeLatest, newRunResult(Config{}).UpdateMode)
+
+	r := newRunResult(Config{dryRun: true, updateMinimal: true})
+	assert.True(t, r.DryRun)
+	assert.Equal(t, updateModeMinimal, r.UpdateMode)
+	assert.Equal(t, categorySecurity, r.Category)
+
+	assert.Equal(t, categoryBugfix, newRunResult(Config{category: categoryBugfix}).Category)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rpmQueryFormat is the format used to query the installed packages,
+// one package per line with tab separated fields.
+const rpmQueryFormat string = `%{NAME}\t%{EPOCH}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{VENDOR}\t%{LICENSE}\n`
+
+// nevraRegex matches a name-[epoch:]version-release.arch at the end of a
+// string, like a CSAF product id "7Server-7.9.Z:sudo-0:1.8.23-10.el7_9.1.x86_64".
+var nevraRegex = regexp.MustCompile(`([^:]+)-(?:(\d+):)?([^\-:]+)-([^\-:]+)\.(\w+)$`)
+
+// installedPackage is a package installed on the host.
+type installedPackage struct {
+	name, epoch, version, release, arch, vendor, license string
+}
+
+// evr returns the [epoch:]version-release of the package.
+func (p installedPackage) evr() string {
+	if p.epoch != "" && p.epoch != "0" {
+		return fmt.Sprintf("%s:%s-%s", p.epoch, p.version, p.release)
+	}
+	return fmt.Sprintf("%s-%s", p.version, p.release)
+}
+
+// nevra returns the name-[epoch:]version-release.arch of the package.
+func (p installedPackage) nevra() string {
+	return fmt.Sprintf("%s-%s.%s", p.name, p.evr(), p.arch)
+}
+
+// parseInstalledPackages parses the output of rpm -qa with rpmQueryFormat.
+func parseInstalledPackages(output []byte) []installedPackage {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	packages := make([]installedPackage, 0)
+
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		// gpg keys are listed as packages without arch
+		if fields[0] == "gpg-pubkey" {
+			continue
+		}
+
+		for i, f := range fields {
+			if f == "(none)" {
+				fields[i] = ""
+			}
+		}
+
+		packages = append(packages, installedPackage{
+			name:    fields[0],
+			epoch:   fields[1],
+			version: fields[2],
+			release: fields[3],
+			arch:    fields[4],
+			vendor:  fields[5],
+			license: fields[6],
+		})
+	}
+
+	return packages
+}
+
+// buildRPMQueryCommand returns the exec command to
+// list the packages installed on the host.
+func buildRPMQueryCommand(packages ...string) *exec.Cmd {
+	cmd := []string{"rpm", "--queryformat", rpmQueryFormat}
+	if len(packages) == 0 {
+		cmd = append(cmd, "-qa")
+	} else {
+		cmd = append(cmd, "-q")
+		cmd = append(cmd, packages...)
+	}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// listInstalledPackages returns the packages installed on the host,
+// all of them if no package names are given.
+func listInstalledPackages(packages ...string) ([]installedPackage, error) {
+	log.Infof("list installed packages")
+
+	result := bytes.Buffer{}
+	cmd := buildRPMQueryCommand(packages...)
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("rpm query did not run successfully: %v", err)
+	}
+
+	return parseInstalledPackages(result.Bytes()), nil
+}
+
+// nevraName returns the name of a name-[epoch:]version-release.arch package.
+func nevraName(nevra string) string {
+	if m := nevraRegex.FindStringSubmatch(nevra); m != nil {
+		return m[1]
+	}
+	return nevra
+}
+
+// parseEVR splits an [epoch:]version[-release] string.
+func parseEVR(evr string) (epoch, version, release string) {
+	if i := strings.Index(evr, ":"); i >= 0 {
+		epoch, evr = evr[:i], evr[i+1:]
+	}
+	version = evr
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		version, release = evr[:i], evr[i+1:]
+	}
+	return epoch, version, release
+}
+
+// compareEVR compares two [epoch:]version-release strings and returns
+// -1, 0 or 1 if a is older, equal or newer than b.
+func compareEVR(a, b string) int {
+	aEpoch, aVersion, aRelease := parseEVR(a)
+	bEpoch, bVersion, bRelease := parseEVR(b)
+
+	if aEpoch == "" {
+		aEpoch = "0"
+	}
+	if bEpoch == "" {
+		bEpoch = "0"
+	}
+	if c := rpmvercmp(aEpoch, bEpoch); c != 0 {
+		return c
+	}
+	if c := rpmvercmp(aVersion, bVersion); c != 0 {
+		return c
+	}
+	// a missing release matches any release
+	if aRelease == "" || bRelease == "" {
+		return 0
+	}
+	return rpmvercmp(aRelease, bRelease)
+}
+
+// rpmvercmp compares two version or release strings the same way rpm does.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isAlnum := func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsLetter(r)
+	}
+	isSeparator := func(r rune) bool {
+		return !isAlnum(r) && r != '~' && r != '^'
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		a = strings.TrimLeftFunc(a, isSeparator)
+		b = strings.TrimLeftFunc(b, isSeparator)
+
+		// a tilde sorts before everything, even the end of the string
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// a caret sorts after the end of the string but before everything else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if a == "" || b == "" {
+			break
+		}
+
+		isNum := unicode.IsDigit(rune(a[0]))
+		segment := func(s string) string {
+			i := 0
+			for i < len(s) && isAlnum(rune(s[i])) && unicode.IsDigit(rune(s[i])) == isNum {
+				i++
+			}
+			return s[:i]
+		}
+		segA, segB := segment(a), segment(b)
+		a, b = a[len(segA):], b[len(segB):]
+
+		// numeric segments are newer than alpha segments
+		if segB == "" {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validInstalledPackages = []string{
+	"openssl-libs\t1\t1.0.2k\t21.el7_9\tx86_64\tRed Hat, Inc.\tOpenSSL",
+	"sudo\t(none)\t1.8.23\t10.el7_9.1\tx86_64\tRed Hat, Inc.\tISC",
+	"tzdata\t(none)\t2021a\t1.el7\tnoarch\t(none)\tPublic Domain",
+}
+
+func TestParseInstalledPackages(t *testing.T) {
+	output := strings.Join(append(validInstalledPackages,
+		"gpg-pubkey\t(none)\tfd431d51\t4ae0493b\t(none)\t(none)\tpubkey",
+		"invalid",
+		"",
+	), "\n")
+
+	packages := parseInstalledPackages([]byte(output))
+	assert.Equal(t, []installedPackage{
+		{name: "openssl-libs", epoch: "1", version: "1.0.2k", release: "21.el7_9", arch: "x86_64", vendor: "Red Hat, Inc.", license: "OpenSSL"},
+		{name: "sudo", version: "1.8.23", release: "10.el7_9.1", arch: "x86_64", vendor: "Red Hat, Inc.", license: "ISC"},
+		{name: "tzdata", version: "2021a", release: "1.el7", arch: "noarch", license: "Public Domain"},
+	}, packages)
+
+	assert.Equal(t, "1:1.0.2k-21.el7_9", packages[0].evr())
+	assert.Equal(t, "openssl-libs-1:1.0.2k-21.el7_9.x86_64", packages[0].nevra())
+	assert.Equal(t, "sudo-1.8.23-10.el7_9.1.x86_64", packages[1].nevra())
+}
+
+func TestBuildRPMQueryCommand(t *testing.T) {
+	cmd := buildRPMQueryCommand()
+	assert.Equal(t, hostCommand+"rpm --queryformat "+rpmQueryFormat+" -qa", strings.Join(cmd.Args, " "))
+
+	cmd = buildRPMQueryCommand("kernel")
+	assert.Equal(t, hostCommand+"rpm --queryformat "+rpmQueryFormat+" -q kernel", strings.Join(cmd.Args, " "))
+}
+
+func TestListInstalledPackages(t *testing.T) {
+	testName = testRPMQuery
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	packages, err := listInstalledPackages()
+	assert.NoError(t, err)
+	assert.Len(t, packages, 3)
+
+	testName = testDefaultFailure
+	_, err = listInstalledPackages()
+	assert.Error(t, err)
+}
+
+func TestParseEVR(t *testing.T) {
+	var tests = []struct {
+		evr, epoch, version, release string
+	}{
+		{"1:1.0.2k-21.el7_9", "1", "1.0.2k", "21.el7_9"},
+		{"1.8.23-10.el7_9.1", "", "1.8.23", "10.el7_9.1"},
+		{"3.10.0", "", "3.10.0", ""},
+	}
+
+	for _, tt := range tests {
+		epoch, version, release := parseEVR(tt.evr)
+		assert.Equal(t, []string{tt.epoch, tt.version, tt.release}, []string{epoch, version, release}, tt.evr)
+	}
+}
+
+func TestRPMVerCmp(t *testing.T) {
+	// from the rpm test suite
+	var tests = []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"8", "xyz.4", 1},
+		{"1.0010", "1.9", 1},
+		{"1.05", "1.5", 0},
+		{"1.0", "1", 1},
+		{"2.50", "2.5", 1},
+		{"fc4", "fc.4", 0},
+		{"FC5", "fc4", -1},
+		{"2a", "2.0", -1},
+		{"1.0", "1.fc4", 1},
+		{"3.0.0_fc", "3.0.0.fc", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, rpmvercmp(tt.a, tt.b), "%s <=> %s", tt.a, tt.b)
+	}
+}
+
+func TestCompareEVR(t *testing.T) {
+	var tests = []struct {
+		a, b     string
+		expected int
+	}{
+		{"1:1.0.2k-21.el7_9", "1:1.0.2k-21.el7_9", 0},
+		{"1:1.0.2k-19.el7", "1:1.0.2k-21.el7_9", -1},
+		{"1:1.0.2k-19.el7", "1.0.2k-21.el7_9", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"3.10.0-1160.el7", "3.10.0-957.el7", 1},
+		{"3.10.0", "3.10.0-957.el7", 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, compareEVR(tt.a, tt.b), "%s <=> %s", tt.a, tt.b)
+	}
+}
+
+func TestNEVRARegex(t *testing.T) {
+	var tests = []struct {
+		product  string
+		expected []string
+	}{
+		{"7Server-7.9.Z:sudo-0:1.8.23-10.el7_9.1.x86_64", []string{"sudo", "0", "1.8.23", "10.el7_9.1", "x86_64"}},
+		{"7Server-7.9.Z:bind-license-32:9.11.4-26.P2.el7_9.4.noarch", []string{"bind-license", "32", "9.11.4", "26.P2.el7_9.4", "noarch"}},
+		{"7Server:kernel-3.10.0-1160.45.1.el7.x86_64", []string{"kernel", "", "3.10.0", "1160.45.1.el7", "x86_64"}},
+		{"7Server-7.9.Z", nil},
+	}
+
+	for _, tt := range tests {
+		m := nevraRegex.FindStringSubmatch(tt.product)
+		if tt.expected == nil {
+			assert.Nil(t, m, tt.product)
+			continue
+		}
+		assert.Equal(t, tt.expected, m[1:], tt.product)
+	}
+}
+
+func TestNEVRAName(t *testing.T) {
+	assert.Equal(t, "bind-license", nevraName("bind-license-32:9.11.4-26.P2.el7_9.4.noarch"))
+	assert.Equal(t, "kernel", nevraName("kernel-3.10.0-1160.45.1.el7.x86_64"))
+	assert.Equal(t, "sudo", nevraName("sudo"))
+}
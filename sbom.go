@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	sbomPath string = "/api/v1/sbom"
+
+	sbomFormatCycloneDX string = "cyclonedx"
+	sbomFormatSPDX      string = "spdx"
+
+	sbomToolName string = "yumsecupdater"
+)
+
+// purlNamespaces maps the rpm vendors to the purl namespaces.
+var purlNamespaces = map[string]string{
+	"Red Hat, Inc.":                        "redhat",
+	"CentOS":                               "centos",
+	"Fedora Project":                       "fedora",
+	"Rocky Enterprise Software Foundation": "rocky",
+	"AlmaLinux":                            "almalinux",
+	"Oracle America":                       "oracle",
+}
+
+// purl returns the package URL of an installed package.
+func purl(p installedPackage) string {
+	name := url.PathEscape(p.name)
+	if ns, ok := purlNamespaces[p.vendor]; ok {
+		name = ns + "/" + name
+	}
+
+	qualifiers := url.Values{}
+	qualifiers.Set("arch", p.arch)
+	if p.epoch != "" {
+		qualifiers.Set("epoch", p.epoch)
+	}
+
+	return fmt.Sprintf("pkg:rpm/%s@%s?%s",
+		name, url.PathEscape(p.version+"-"+p.release), qualifiers.Encode())
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("can not generate uuid: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	Type      string             `json:"type"`
+	BOMRef    string             `json:"bom-ref,omitempty"`
+	Name      string             `json:"name"`
+	Version   string             `json:"version,omitempty"`
+	Publisher string             `json:"publisher,omitempty"`
+	PURL      string             `json:"purl,omitempty"`
+	Licenses  []cycloneDXLicense `json:"licenses,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	License cycloneDXLicenseName `json:"license"`
+}
+
+type cycloneDXLicenseName struct {
+	Name string `json:"name"`
+}
+
+// newCycloneDXBOM returns a CycloneDX document of the installed packages.
+func newCycloneDXBOM(node string, packages []installedPackage, now time.Time) cycloneDXBOM {
+	components := make([]cycloneDXComponent, 0, len(packages))
+	for _, p := range packages {
+		c := cycloneDXComponent{
+			Type:      "library",
+			BOMRef:    purl(p),
+			Name:      p.name,
+			Version:   p.evr(),
+			Publisher: p.vendor,
+			PURL:      purl(p),
+		}
+		if p.license != "" {
+			c.Licenses = []cycloneDXLicense{{License: cycloneDXLicenseName{Name: p.license}}}
+		}
+		components = append(components, c)
+	}
+
+	return cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: now.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: sbomToolName}},
+			Component: cycloneDXComponent{
+				Type: "operating-system",
+				Name: node,
+			},
+		},
+		Components: components,
+	}
+}
+
+type spdxDocument struct {
+	SPDXVersion       string           `json:"spdxVersion"`
+	DataLicense       string           `json:"dataLicense"`
+	SPDXID            string           `json:"SPDXID"`
+	Name              string           `json:"name"`
+	DocumentNamespace string           `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo `json:"creationInfo"`
+	Packages          []spdxPackage    `json:"packages"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo"`
+	Supplier         string            `json:"supplier"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+// newSPDXDocument returns a SPDX document of the installed packages.
+func newSPDXDocument(node string, packages []installedPackage, now time.Time) spdxDocument {
+	spdxPackages := make([]spdxPackage, 0, len(packages))
+	for i, p := range packages {
+		supplier := "NOASSERTION"
+		if p.vendor != "" {
+			supplier = "Organization: " + p.vendor
+		}
+		spdxPackages = append(spdxPackages, spdxPackage{
+			Name:             p.name,
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d", i),
+			VersionInfo:      p.evr(),
+			Supplier:         supplier,
+			DownloadLocation: "NOASSERTION",
+			FilesAnalyzed:    false,
+			// rpm licenses are not SPDX expressions.
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  purl(p),
+			}},
+		})
+	}
+
+	return spdxDocument{
+		SPDXVersion:       "SPDX-2.2",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              node,
+		DocumentNamespace: fmt.Sprintf("https://%s/spdx/%s-%s", sbomToolName, url.PathEscape(node), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  now.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+		Packages: spdxPackages,
+	}
+}
+
+// marshalSBOM returns the SBOM of the packages in the given format.
+func marshalSBOM(node, format string, packages []installedPackage, now time.Time) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case sbomFormatCycloneDX:
+		doc = newCycloneDXBOM(node, packages, now)
+	case sbomFormatSPDX:
+		doc = newSPDXDocument(node, packages, now)
+	default:
+		return nil, fmt.Errorf("invalid sbom format: %s", format)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// SBOMWriter generates the SBOM of the host on start and after each
+// update, it keeps the documents for the http server and writes them to
+// a directory if set.
+type SBOMWriter struct {
+	dir  string
+	node string
+
+	mutex     sync.RWMutex
+	documents map[string][]byte
+}
+
+// sbomWriter is the SBOM shared by the run loops and the http server.
+var sbomWriter = newSBOMWriter(defaultSBOMDir, "")
+
+// newSBOMWriter returns a SBOMWriter writing into dir, only kept in memory if empty.
+func newSBOMWriter(dir, node string) *SBOMWriter {
+	return &SBOMWriter{dir: dir, node: node}
+}
+
+// Send implements EventSink.
+func (s *SBOMWriter) Send(e Event) {
+	if e.Reason != eventUpdateSucceeded {
+		return
+	}
+	if err := s.write(); err != nil {
+		log.WithField("component", "sbom").Error(err)
+	}
+}
+
+// write generates the SBOM in all the formats from a single listing of the
+// installed packages, and writes them to the directory if set.
+func (s *SBOMWriter) write() error {
+	packages, err := listInstalledPackages()
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		sbomFormatCycloneDX: s.node + ".cdx.json",
+		sbomFormatSPDX:      s.node + ".spdx.json",
+	}
+	documents := map[string][]byte{}
+	now := time.Now()
+	for format, file := range files {
+		data, err := marshalSBOM(s.node, format, packages, now)
+		if err != nil {
+			return err
+		}
+		documents[format] = data
+
+		if s.dir == "" {
+			continue
+		}
+		path := filepath.Join(s.dir, file)
+		if err := writeFileAtomic(path, data); err != nil {
+			return fmt.Errorf("can not write sbom: %v", err)
+		}
+		log.WithField("component", "sbom").Infof("sbom written to %s", path)
+	}
+
+	s.mutex.Lock()
+	s.documents = documents
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// ServeHTTP serves the last SBOM generated, the format is selected
+// with the format query parameter and defaults to CycloneDX.
+func (s *SBOMWriter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = sbomFormatCycloneDX
+	}
+	format = strings.ToLower(format)
+	if format != sbomFormatCycloneDX && format != sbomFormatSPDX {
+		http.Error(w, fmt.Sprintf("invalid sbom format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	s.mutex.RLock()
+	data := s.documents[format]
+	s.mutex.RUnlock()
+	if data == nil {
+		http.Error(w, "sbom not generated yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
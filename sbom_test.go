@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testInstalledPackages = []installedPackage{
+	{name: "openssl-libs", epoch: "1", version: "1.0.2k", release: "21.el7_9", arch: "x86_64", vendor: "Red Hat, Inc.", license: "OpenSSL"},
+	{name: "tzdata", version: "2021a", release: "1.el7", arch: "noarch"},
+}
+
+func TestPurl(t *testing.T) {
+	assert.Equal(t, "pkg:rpm/redhat/openssl-libs@1.0.2k-21.el7_9?arch=x86_64&epoch=1", purl(testInstalledPackages[0]))
+	assert.Equal(t, "pkg:rpm/tzdata@2021a-1.el7?arch=noarch", purl(testInstalledPackages[1]))
+}
+
+func TestNewUUID(t *testing.T) {
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, newUUID())
+	assert.NotEqual(t, newUUID(), newUUID())
+}
+
+func TestNewCycloneDXBOM(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	bom := newCycloneDXBOM("node1", testInstalledPackages, now)
+
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Equal(t, "2021-10-01T12:00:00Z", bom.Metadata.Timestamp)
+	assert.Equal(t, "node1", bom.Metadata.Component.Name)
+	assert.Len(t, bom.Components, 2)
+	assert.Equal(t, cycloneDXComponent{
+		Type:      "library",
+		BOMRef:    "pkg:rpm/redhat/openssl-libs@1.0.2k-21.el7_9?arch=x86_64&epoch=1",
+		Name:      "openssl-libs",
+		Version:   "1:1.0.2k-21.el7_9",
+		Publisher: "Red Hat, Inc.",
+		PURL:      "pkg:rpm/redhat/openssl-libs@1.0.2k-21.el7_9?arch=x86_64&epoch=1",
+		Licenses:  []cycloneDXLicense{{License: cycloneDXLicenseName{Name: "OpenSSL"}}},
+	}, bom.Components[0])
+	assert.Empty(t, bom.Components[1].Licenses)
+}
+
+func TestNewSPDXDocument(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	doc := newSPDXDocument("node1", testInstalledPackages, now)
+
+	assert.Equal(t, "SPDX-2.2", doc.SPDXVersion)
+	assert.Equal(t, "2021-10-01T12:00:00Z", doc.CreationInfo.Created)
+	assert.Len(t, doc.Packages, 2)
+	assert.Equal(t, "SPDXRef-Package-0", doc.Packages[0].SPDXID)
+	assert.Equal(t, "Organization: Red Hat, Inc.", doc.Packages[0].Supplier)
+	assert.Equal(t, "NOASSERTION", doc.Packages[1].Supplier)
+	assert.Equal(t, "pkg:rpm/tzdata@2021a-1.el7?arch=noarch", doc.Packages[1].ExternalRefs[0].ReferenceLocator)
+}
+
+func TestSBOMWriterServeHTTP(t *testing.T) {
+	testName = testRPMQuery
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	w := newSBOMWriter("", "node1")
+	rr := httptest.NewRecorder()
+	w.ServeHTTP(rr, httptest.NewRequest("GET", sbomPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	assert.NoError(t, w.write())
+	// the requests are served from the SBOM generated, without rpm
+	execCommand = nil
+
+	var tests = []struct {
+		query string
+		code  int
+		key   string
+	}{
+		{"", http.StatusOK, "bomFormat"},
+		{"?format=cyclonedx", http.StatusOK, "bomFormat"},
+		{"?format=SPDX", http.StatusOK, "spdxVersion"},
+		{"?format=invalid", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", sbomPath+tt.query, nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		w.ServeHTTP(rr, req)
+		assert.Equal(t, tt.code, rr.Code, tt.query)
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		doc := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+		assert.Contains(t, doc, tt.key)
+	}
+}
+
+func TestSBOMWriter(t *testing.T) {
+	testName = testRPMQuery
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := newSBOMWriter(dir, "node1")
+	w.Send(Event{Reason: eventUpdateFailed})
+	_, err = os.Stat(filepath.Join(dir, "node1.cdx.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	w.Send(Event{Reason: eventUpdateSucceeded})
+	for _, file := range []string{"node1.cdx.json", "node1.spdx.json"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(data), file)
+	}
+}
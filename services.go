@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultRestartServices string = ""
+
+var serviceUnitRegex = regexp.MustCompile(`^[\w@:.\-\\]+$`)
+
+// buildServicesNeedingRestartCommand builds the command listing the
+// systemd services running outdated binaries or libraries.
+func buildServicesNeedingRestartCommand() *exec.Cmd {
+	cmd := []string{"needs-restarting", "-s"}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// buildRestartServiceCommand builds the command restarting a systemd service.
+func buildRestartServiceCommand(service string) *exec.Cmd {
+	cmd := []string{"systemctl", "restart", service}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// parseServicesNeedingRestart parses the output of needs-restarting -s.
+func parseServicesNeedingRestart(output []byte) []string {
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	services := make([]string, 0)
+
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if serviceUnitRegex.Match(line) {
+			services = append(services, serviceUnitName(string(line)))
+		}
+	}
+
+	return services
+}
+
+// serviceUnitName returns the unit name of a service, adding
+// the .service suffix if the name has no unit type.
+func serviceUnitName(name string) string {
+	if filepath.Ext(name) == "" {
+		return name + ".service"
+	}
+	return name
+}
+
+// listServicesNeedingRestart returns the services needing a restart.
+func listServicesNeedingRestart() ([]string, error) {
+	log.Infof("check if services need a restart")
+
+	result := bytes.Buffer{}
+	cmd := buildServicesNeedingRestartCommand()
+	cmd.Stdout = &result
+
+	if err := runCommand(cmd); err != nil {
+		return nil, fmt.Errorf("needs-restarting -s did not run successfully: %w", err)
+	}
+
+	services := parseServicesNeedingRestart(result.Bytes())
+	if len(services) > 0 {
+		log.WithField("services", services).Infof("services need a restart")
+	}
+
+	return services, nil
+}
+
+// restartServices restarts the services of the allowlist needing a
+// restart and returns the restarted ones and the remaining ones.
+func restartServices(services, allowlist []string) ([]string, []string) {
+	allowed := make([]string, 0, len(allowlist))
+	for _, s := range allowlist {
+		allowed = append(allowed, serviceUnitName(s))
+	}
+
+	restarted := make([]string, 0)
+	remaining := make([]string, 0)
+	for _, service := range services {
+		if !containsString(allowed, service) {
+			remaining = append(remaining, service)
+			continue
+		}
+
+		log.WithField("service", service).Infof("restart service")
+		if err := runCommand(buildRestartServiceCommand(service)); err != nil {
+			log.WithField("service", service).
+				Errorf("systemctl restart did not run successfully: %v", err)
+			remaining = append(remaining, service)
+			continue
+		}
+		restarted = append(restarted, service)
+	}
+
+	return restarted, remaining
+}
+
+// checkServices lists the services needing a restart and restarts the
+// allowlisted ones when no reboot is required.
+func checkServices(ctx context.Context, config Config, result *RunResult, rebootRequired bool) {
+	_, span := tracer.Start(ctx, "needs-restarting-services")
+	services, err := listServicesNeedingRestart()
+	endSpan(span, commandExitCode(err), err)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	result.ServicesNeedingRestart = services
+
+	// the services are restarted by the reboot.
+	if rebootRequired || len(config.restartServices) == 0 || len(services) == 0 {
+		return
+	}
+
+	_, span = tracer.Start(ctx, "restart-services")
+	result.RestartedServices, result.ServicesNeedingRestart = restartServices(services, config.restartServices)
+	span.SetAttributes(
+		attribute.Int("services.restarted", len(result.RestartedServices)),
+		attribute.Int("services.remaining", len(result.ServicesNeedingRestart)),
+	)
+	span.End()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var validServicesNeedingRestart = []string{
+	"Updating Subscription Management repositories.",
+	"sshd.service",
+	"chronyd.service",
+	"getty@tty1.service",
+	"",
+}
+
+func TestParseServicesNeedingRestart(t *testing.T) {
+	services := parseServicesNeedingRestart([]byte(strings.Join(validServicesNeedingRestart, "\n")))
+	assert.Equal(t, []string{"sshd.service", "chronyd.service", "getty@tty1.service"}, services)
+
+	services = parseServicesNeedingRestart([]byte("auditd\n"))
+	assert.Equal(t, []string{"auditd.service"}, services)
+}
+
+func TestBuildServicesCommands(t *testing.T) {
+	cmd := buildServicesNeedingRestartCommand()
+	assert.Equal(t, hostCommand+"needs-restarting -s", strings.Join(cmd.Args, " "))
+
+	cmd = buildRestartServiceCommand("sshd.service")
+	assert.Equal(t, hostCommand+"systemctl restart sshd.service", strings.Join(cmd.Args, " "))
+}
+
+func TestRestartServices(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	testName = testServicesRestart
+	restarted, remaining := restartServices([]string{"sshd.service", "chronyd.service"}, []string{"sshd"})
+	assert.Equal(t, []string{"sshd.service"}, restarted)
+	assert.Equal(t, []string{"chronyd.service"}, remaining)
+
+	testName = testDefaultFailure
+	restarted, remaining = restartServices([]string{"sshd.service"}, []string{"sshd.service"})
+	assert.Empty(t, restarted)
+	assert.Equal(t, []string{"sshd.service"}, remaining)
+}
+
+func TestRunRestartServices(t *testing.T) {
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	// no reboot required, the allowlisted services are restarted
+	testName = testServicesRestart
+	result := &RunResult{}
+	assert.NoError(t, run(Config{restartServices: []string{"sshd", "chronyd"}}, result))
+	assert.False(t, result.RebootRequired)
+	assert.Equal(t, []string{"sshd.service", "chronyd.service"}, result.RestartedServices)
+	assert.Equal(t, []string{"getty@tty1.service"}, result.ServicesNeedingRestart)
+
+	// reboot required, the services are left to the reboot
+	testName = testRunUpdateAvailable
+	result = &RunResult{}
+	assert.NoError(t, run(Config{restartServices: []string{"sshd"}}, result))
+	assert.True(t, result.RebootRequired)
+	assert.Empty(t, result.RestartedServices)
+	assert.Len(t, result.ServicesNeedingRestart, 3)
+}
+
+func TestServiceNeedsRestartMetric(t *testing.T) {
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+
+	m.Send(Event{Reason: eventRunCompleted, Result: &RunResult{ServicesNeedingRestart: []string{"sshd.service"}}})
+	// the run of another category keeps the services of the security category
+	m.Send(Event{Reason: eventRunCompleted, Result: &RunResult{Category: categoryBugfix, ServicesNeedingRestart: []string{"crond.service"}}})
+	m.Send(Event{Reason: eventRunCompleted, Result: &RunResult{Category: categoryBugfix}})
+
+	rr := httptest.NewRecorder()
+	m.Handler.ServeHTTP(rr, httptest.NewRequest("GET", metricsPath, nil))
+	assertMetricsOutput(t, rr.Body.String(), `yumsecupdater_service_needs_restart{category="security",node="localhost",service="sshd.service"} 1`)
+	assertMetricsNotInOutput(t, rr.Body.String(), `crond.service`)
+}
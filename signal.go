@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Targets of the reboot signal.
+const (
+	rebootSignalFile        = "file"
+	rebootSignalCommand     = "command"
+	rebootSignalNode        = "node"
+	rebootSignalCoordinator = "coordinator"
+)
+
+const (
+	defaultRebootSignals      string = rebootSignalFile
+	defaultSentinelFile       string = "/var/run/reboot-required"
+	defaultSentinelCommand    string = ""
+	defaultRebootCoordinator  string = ""
+	defaultCoordinatorTimeout        = 10 * time.Second
+
+	rebootReasonsKey string = nodeMetadataPrefix + "reboot-reasons"
+	rebootReasonsEnv string = "YUMSECUPDATER_REBOOT_REASONS"
+)
+
+// RebootSignaler signals that the node needs a reboot.
+type RebootSignaler interface {
+	// Signal requests a reboot for the given reasons.
+	Signal(reasons []string) error
+	// Clear withdraws a stale reboot request.
+	Clear() error
+}
+
+// rebootSignalers are the targets of the reboot signal.
+var rebootSignalers = []RebootSignaler{newSentinelFileSignaler(defaultSentinelFile)}
+
+// rebootSignaled tracks if the reboot signals may be raised, so they are only
+// cleared once. It is unknown on start, a signal raised before a restart of
+// the daemon is cleared by the first check.
+var rebootSignaled = struct {
+	sync.Mutex
+	raised bool
+}{raised: true}
+
+// validateRebootSignal checks if a reboot signal target is valid.
+func validateRebootSignal(s string) error {
+	switch s {
+	case rebootSignalFile, rebootSignalCommand, rebootSignalNode, rebootSignalCoordinator:
+		return nil
+	}
+	return fmt.Errorf("invalid reboot signal: %s", s)
+}
+
+// signalReboot signals the reboot to all the targets.
+func signalReboot(reasons []string) error {
+	rebootSignaled.Lock()
+	rebootSignaled.raised = true
+	rebootSignaled.Unlock()
+
+	errs := []string{}
+	for _, s := range rebootSignalers {
+		if err := s.Signal(reasons); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("reboot signal failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// clearStaleRebootSignals clears the reboot signals once the node
+// runs the newest installed kernel, if they were raised.
+func clearStaleRebootSignals() {
+	rebootSignaled.Lock()
+	defer rebootSignaled.Unlock()
+	if !rebootSignaled.raised {
+		return
+	}
+
+	kernel, err := getKernelInfo()
+	if err != nil {
+		log.Errorf("can not check for stale reboot signals: %v", err)
+		return
+	}
+	if kernel.outdated() {
+		log.WithFields(log.Fields{"running_kernel": kernel.running, "installed_kernel": kernel.installed}).
+			Infof("node not rebooted into the newest kernel yet, keep the reboot signals")
+		return
+	}
+
+	cleared := true
+	for _, s := range rebootSignalers {
+		if err := s.Clear(); err != nil {
+			log.Errorf("can not clear reboot signal: %v", err)
+			cleared = false
+		}
+	}
+	// the signals failing to clear are cleared again on the next run.
+	rebootSignaled.raised = !cleared
+	sendEvent(Event{
+		Reason:  eventRebootCleared,
+		Message: "No reboot is required anymore",
+	})
+}
+
+// SentinelFileSignaler creates a sentinel file on the host, like the
+// /var/run/reboot-required watched by kured.
+type SentinelFileSignaler struct {
+	path string
+}
+
+// newSentinelFileSignaler returns a SentinelFileSignaler for the given path.
+func newSentinelFileSignaler(path string) *SentinelFileSignaler {
+	return &SentinelFileSignaler{path: path}
+}
+
+// buildCreateSentinelFileCommand returns the exec command to
+// create the sentinel file with the reasons of the reboot.
+func buildCreateSentinelFileCommand(path string, reasons []string) *exec.Cmd {
+	cmd := []string{"tee", path}
+	cmd = buildHostCommand(cmd)
+	c := newCommand(cmd)
+	c.Stdin = strings.NewReader(fmt.Sprintf("reboot required by yumsecupdater: %s\n", strings.Join(reasons, ",")))
+	return c
+}
+
+// buildRemoveSentinelFileCommand returns the exec command to remove the sentinel file.
+func buildRemoveSentinelFileCommand(path string) *exec.Cmd {
+	cmd := []string{"rm", "-f", path}
+	cmd = buildHostCommand(cmd)
+	return newCommand(cmd)
+}
+
+// Signal implements RebootSignaler.
+func (s *SentinelFileSignaler) Signal(reasons []string) error {
+	log.WithField("path", s.path).Infof("create sentinel file")
+
+	if err := runCommand(buildCreateSentinelFileCommand(s.path, reasons)); err != nil {
+		return fmt.Errorf("create sentinel failed: %w", err)
+	}
+
+	log.Infof("sentinel file created successfully")
+
+	return nil
+}
+
+// Clear implements RebootSignaler.
+func (s *SentinelFileSignaler) Clear() error {
+	if err := runCommand(buildRemoveSentinelFileCommand(s.path)); err != nil {
+		return fmt.Errorf("remove sentinel failed: %w", err)
+	}
+	return nil
+}
+
+// CommandSignaler runs a command on the host with the reasons of
+// the reboot in the YUMSECUPDATER_REBOOT_REASONS environment variable.
+type CommandSignaler struct {
+	command []string
+}
+
+// newCommandSignaler returns a CommandSignaler for a command line.
+func newCommandSignaler(command string) (*CommandSignaler, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("sentinel command is missing")
+	}
+	return &CommandSignaler{command: fields}, nil
+}
+
+// buildSentinelCommand returns the exec command signaling the reboot.
+func (s *CommandSignaler) buildSentinelCommand(reasons []string) *exec.Cmd {
+	cmd := buildHostCommand(s.command)
+	c := newCommand(cmd)
+	c.Env = append(os.Environ(), fmt.Sprintf("%s=%s", rebootReasonsEnv, strings.Join(reasons, ",")))
+	return c
+}
+
+// Signal implements RebootSignaler.
+func (s *CommandSignaler) Signal(reasons []string) error {
+	if err := runCommand(s.buildSentinelCommand(reasons)); err != nil {
+		return fmt.Errorf("sentinel command did not run successfully: %w", err)
+	}
+	return nil
+}
+
+// Clear implements RebootSignaler, the command has nothing to clear.
+func (s *CommandSignaler) Clear() error {
+	return nil
+}
+
+// NodeSignaler sets the reboot-required annotation, and label if
+// enabled, on the Node object.
+type NodeSignaler struct {
+	reporter *NodeReporter
+}
+
+// newNodeSignaler returns a NodeSignaler patching the node with the reporter.
+func newNodeSignaler(reporter *NodeReporter) *NodeSignaler {
+	return &NodeSignaler{reporter: reporter}
+}
+
+// Signal implements RebootSignaler.
+func (s *NodeSignaler) Signal(reasons []string) error {
+	err := s.reporter.patchNode(map[string]string{
+		rebootRequiredKey: "true",
+		rebootReasonsKey:  strings.Join(reasons, ","),
+	})
+	if err != nil {
+		return fmt.Errorf("can not signal reboot on node %s: %v", s.reporter.nodeName, err)
+	}
+	return nil
+}
+
+// Clear implements RebootSignaler.
+func (s *NodeSignaler) Clear() error {
+	err := s.reporter.patchNode(map[string]string{
+		rebootRequiredKey: "false",
+		rebootReasonsKey:  "",
+	})
+	if err != nil {
+		return fmt.Errorf("can not clear reboot on node %s: %v", s.reporter.nodeName, err)
+	}
+	return nil
+}
+
+// CoordinatorSignaler requests a reboot from a local reboot-coordinator
+// with a POST of the node and the reasons, and withdraws it with a DELETE.
+type CoordinatorSignaler struct {
+	url    string
+	node   string
+	client *http.Client
+}
+
+// coordinatorRequest is the body posted to the reboot-coordinator.
+type coordinatorRequest struct {
+	Node    string   `json:"node"`
+	Reasons []string `json:"reasons"`
+}
+
+// newCoordinatorSignaler returns a CoordinatorSignaler for the given url.
+func newCoordinatorSignaler(url, node string) *CoordinatorSignaler {
+	return &CoordinatorSignaler{
+		url:    url,
+		node:   node,
+		client: &http.Client{Timeout: defaultCoordinatorTimeout},
+	}
+}
+
+func (s *CoordinatorSignaler) do(method string, reasons []string) error {
+	body, err := json.Marshal(coordinatorRequest{Node: s.node, Reasons: reasons})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Signal implements RebootSignaler.
+func (s *CoordinatorSignaler) Signal(reasons []string) error {
+	if err := s.do(http.MethodPost, reasons); err != nil {
+		return fmt.Errorf("can not request reboot from %s: %v", s.url, err)
+	}
+	return nil
+}
+
+// Clear implements RebootSignaler.
+func (s *CoordinatorSignaler) Clear() error {
+	if err := s.do(http.MethodDelete, nil); err != nil {
+		return fmt.Errorf("can not withdraw reboot from %s: %v", s.url, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordSignaler records the reboot signals.
+type recordSignaler struct {
+	reasons [][]string
+	cleared int
+	err     error
+}
+
+func (s *recordSignaler) Signal(reasons []string) error {
+	s.reasons = append(s.reasons, reasons)
+	return s.err
+}
+
+func (s *recordSignaler) Clear() error {
+	s.cleared++
+	return s.err
+}
+
+func withRecordSignalers(signalers ...RebootSignaler) func() {
+	previous := rebootSignalers
+	rebootSignalers = signalers
+	return func() { rebootSignalers = previous }
+}
+
+func TestSentinelFileCommands(t *testing.T) {
+	cmd := buildCreateSentinelFileCommand("/run/reboot-needed", []string{rebootReasonKernel, rebootReasonGlibc})
+	assert.Equal(t, hostCommand+"tee /run/reboot-needed", strings.Join(cmd.Args, " "))
+	stdin, err := ioutil.ReadAll(cmd.Stdin)
+	assert.NoError(t, err)
+	assert.Equal(t, "reboot required by yumsecupdater: kernel,glibc\n", string(stdin))
+
+	cmd = buildRemoveSentinelFileCommand("/run/reboot-needed")
+	assert.Equal(t, hostCommand+"rm -f /run/reboot-needed", strings.Join(cmd.Args, " "))
+}
+
+func TestCommandSignaler(t *testing.T) {
+	_, err := newCommandSignaler(" ")
+	assert.Error(t, err)
+
+	s, err := newCommandSignaler("/usr/local/bin/request-reboot --now")
+	assert.NoError(t, err)
+
+	cmd := s.buildSentinelCommand([]string{rebootReasonKernel})
+	assert.Equal(t, hostCommand+"/usr/local/bin/request-reboot --now", strings.Join(cmd.Args, " "))
+	assert.Contains(t, cmd.Env, rebootReasonsEnv+"=kernel")
+}
+
+func TestNodeSignaler(t *testing.T) {
+	n := newFakeNodeReporter(true)
+	s := newNodeSignaler(n)
+
+	assert.NoError(t, s.Signal([]string{rebootReasonKernel, rebootReasonSystemd}))
+	node := getFakeNode(t, n)
+	assert.Equal(t, "true", node.Annotations[rebootRequiredKey])
+	assert.Equal(t, "kernel,systemd", node.Annotations[rebootReasonsKey])
+	assert.Equal(t, "true", node.Labels[rebootRequiredKey])
+	assert.NotContains(t, node.Labels, rebootReasonsKey)
+
+	assert.NoError(t, s.Clear())
+	node = getFakeNode(t, n)
+	assert.Equal(t, "false", node.Annotations[rebootRequiredKey])
+	assert.Equal(t, "false", node.Labels[rebootRequiredKey])
+}
+
+func TestCoordinatorSignaler(t *testing.T) {
+	var requests []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := coordinatorRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, fmt.Sprintf("%s %s %v", r.Method, body.Node, body.Reasons))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s := newCoordinatorSignaler(server.URL, "node1")
+	assert.NoError(t, s.Signal([]string{rebootReasonKernel}))
+	assert.NoError(t, s.Clear())
+	assert.Equal(t, []string{"POST node1 [kernel]", "DELETE node1 []"}, requests)
+
+	status = http.StatusConflict
+	assert.Error(t, s.Signal([]string{rebootReasonKernel}))
+}
+
+func TestSignalReboot(t *testing.T) {
+	ok := &recordSignaler{}
+	failed := &recordSignaler{err: fmt.Errorf("failed")}
+	defer withRecordSignalers(ok, failed)()
+
+	err := signalReboot([]string{rebootReasonGlibc})
+	assert.EqualError(t, err, "reboot signal failed: failed")
+	assert.Equal(t, [][]string{{rebootReasonGlibc}}, ok.reasons)
+	assert.Len(t, failed.reasons, 1)
+}
+
+func TestClearStaleRebootSignals(t *testing.T) {
+	s := &recordSignaler{}
+	defer withRecordSignalers(s)()
+
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	sink, restore := withRecordSink()
+	defer restore()
+	rebootSignaled.raised = true
+
+	// still running an older kernel than the newest installed one
+	testName = testRunUpdateAvailable
+	clearStaleRebootSignals()
+	assert.Equal(t, 0, s.cleared)
+	assert.NotContains(t, sink.reasons, eventRebootCleared)
+
+	// no reboot required during the run and no newer kernel
+	testName = testServicesRestart
+	assert.NoError(t, run(Config{}, &RunResult{}))
+	assert.Equal(t, 1, s.cleared)
+	assert.Contains(t, sink.reasons, eventRebootCleared)
+
+	// the signals are cleared once
+	assert.NoError(t, run(Config{}, &RunResult{}))
+	assert.Equal(t, 1, s.cleared)
+
+	// and again once raised
+	assert.NoError(t, signalReboot([]string{rebootReasonKernel}))
+	clearStaleRebootSignals()
+	assert.Equal(t, 2, s.cleared)
+
+	// a failed clear is retried
+	s.err = fmt.Errorf("failed")
+	assert.Error(t, signalReboot([]string{rebootReasonKernel}))
+	clearStaleRebootSignals()
+	clearStaleRebootSignals()
+	assert.Equal(t, 4, s.cleared)
+}
+
+func TestRunSignalReboot(t *testing.T) {
+	s := &recordSignaler{}
+	defer withRecordSignalers(s)()
+
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	assert.NoError(t, run(Config{}, &RunResult{}))
+	assert.Equal(t, [][]string{{rebootReasonKernel, rebootReasonGlibc, rebootReasonSystemd}}, s.reasons)
+}
+
+func TestNewRebootSignaler(t *testing.T) {
+	_, err := newRebootSignaler("email", "node1")
+	assert.Error(t, err)
+
+	_, err = newRebootSignaler(rebootSignalCoordinator, "node1")
+	assert.Error(t, err)
+
+	s, err := newRebootSignaler(rebootSignalFile, "node1")
+	assert.NoError(t, err)
+	assert.IsType(t, &SentinelFileSignaler{}, s)
+}
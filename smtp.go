@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	smtpPasswordEnv string = "YUMSECUPDATER_SMTP_PASSWORD"
+
+	// defaultSMTPTimeout bounds the connection and the whole SMTP
+	// session, so a stalled server does not block the run loop.
+	defaultSMTPTimeout time.Duration = 30 * time.Second
+)
+
+// SMTPConfig holds the configuration of the SMTP notifier.
+type SMTPConfig struct {
+	host      string
+	port      string
+	username  string
+	password  string
+	from      string
+	to        []string
+	startTLS  bool
+	skipNoop  bool
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+// SMTPNotifier sends a summary of every run by email.
+type SMTPNotifier struct {
+	config SMTPConfig
+	node   string
+}
+
+// newSMTPNotifier returns a SMTPNotifier from its configuration.
+func newSMTPNotifier(config SMTPConfig, node string) (*SMTPNotifier, error) {
+	if config.host == "" {
+		return nil, fmt.Errorf("smtp host is missing")
+	}
+	if config.from == "" {
+		return nil, fmt.Errorf("smtp sender is missing")
+	}
+	if len(config.to) == 0 {
+		return nil, fmt.Errorf("smtp recipients are missing")
+	}
+	if config.tlsConfig == nil {
+		config.tlsConfig = &tls.Config{ServerName: config.host}
+	}
+	if config.timeout == 0 {
+		config.timeout = defaultSMTPTimeout
+	}
+
+	return &SMTPNotifier{config: config, node: node}, nil
+}
+
+// Send implements EventSink.
+func (s *SMTPNotifier) Send(e Event) {
+	if e.Reason != eventRunCompleted || e.Result == nil {
+		return
+	}
+
+	r := e.Result
+	if s.config.skipNoop && !r.Failed && !r.Updated && !r.RebootRequired {
+		return
+	}
+
+	logger := log.WithField("component", "smtp")
+	if err := s.sendMail(s.subject(r), r.summary(s.node)); err != nil {
+		logger.Errorf("can not send run summary: %v", err)
+		return
+	}
+
+	logger.Infof("run summary sent to %s", strings.Join(s.config.to, ","))
+}
+
+// subject returns the subject of the email for a run.
+func (s *SMTPNotifier) subject(r *RunResult) string {
+	return fmt.Sprintf("[yumsecupdater] %s: %s", s.node, r)
+}
+
+// buildMessage returns the email with its headers.
+func (s *SMTPNotifier) buildMessage(subject, body string) []byte {
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "From: %s\r\n", s.config.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.config.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return msg.Bytes()
+}
+
+// sendMail sends an email to the recipients.
+func (s *SMTPNotifier) sendMail(subject, body string) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.config.host, s.config.port), s.config.timeout)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(s.config.timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, s.config.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.config.startTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(s.config.tlsConfig); err != nil {
+			return fmt.Errorf("starttls failed: %v", err)
+		}
+	}
+
+	if s.config.username != "" {
+		auth := smtp.PlainAuth("", s.config.username, s.config.password, s.config.host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+
+	if err := c.Mail(s.config.from); err != nil {
+		return err
+	}
+	for _, to := range s.config.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.buildMessage(subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMail is an email received by the fake SMTP server.
+type fakeMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+	tls  bool
+}
+
+// startFakeSMTPServer starts a minimal SMTP server that handles a single
+// connection and returns its address with the channel receiving the email.
+func startFakeSMTPServer(t *testing.T, tlsConfig *tls.Config) (string, string, chan fakeMail) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	mails := make(chan fakeMail, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		mail := fakeMail{}
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.Fields(line)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				if tlsConfig != nil && !mail.tls {
+					tp.PrintfLine("250-localhost")
+					tp.PrintfLine("250-STARTTLS")
+				} else {
+					tp.PrintfLine("250-localhost")
+				}
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "STARTTLS":
+				if tlsConfig == nil {
+					tp.PrintfLine("502 not implemented")
+					continue
+				}
+				tp.PrintfLine("220 ready to start TLS")
+				tlsConn := tls.Server(conn, tlsConfig)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				conn = tlsConn
+				tp = textproto.NewConn(conn)
+				mail.tls = true
+			case "AUTH":
+				mail.auth = line
+				tp.PrintfLine("235 authenticated")
+			case "MAIL":
+				mail.from = line
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				mail.to = append(mail.to, line)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				mail.data = string(data)
+				tp.PrintfLine("250 ok")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				mails <- mail
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	assert.NoError(t, err)
+	return host, port, mails
+}
+
+func testRunResult() *RunResult {
+	return &RunResult{
+		Start:    time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC),
+		End:      time.Date(2021, 10, 1, 12, 5, 0, 0, time.UTC),
+		Packages: []packageWithUpdate{{name: "sudo", arch: "x86_64", version: "1.8.23-10.el7_9.1", repo: "rhel-7-server-rpms"}},
+		Advisories: []advisory{
+			{id: "RHSA-2021:0220", kind: "security", severity: "Important", pkg: "sudo-1.8.23-10.el7_9.1.x86_64"},
+		},
+		Updated:        true,
+		RebootRequired: true,
+	}
+}
+
+func TestSMTPNotifierSend(t *testing.T) {
+	_, port, mails := startFakeSMTPServer(t, nil)
+
+	// PlainAuth is only allowed without TLS on localhost
+	s, err := newSMTPNotifier(SMTPConfig{
+		host:     "localhost",
+		port:     port,
+		username: "user",
+		password: "password",
+		from:     "yumsecupdater@example.com",
+		to:       []string{"ops@example.com", "sec@example.com"},
+	}, "node1")
+	assert.NoError(t, err)
+
+	s.Send(Event{Reason: eventUpdateFailed})
+	s.Send(Event{Reason: eventRunCompleted, Result: testRunResult()})
+
+	select {
+	case mail := <-mails:
+		assert.True(t, strings.HasPrefix(mail.from, "MAIL FROM:<yumsecupdater@example.com>"), mail.from)
+		assert.Len(t, mail.to, 2)
+		assert.Contains(t, mail.auth, "AUTH PLAIN")
+		assert.Contains(t, mail.data, "Subject: [yumsecupdater] node1: 1 packages updated, reboot scheduled\n")
+		assert.Contains(t, mail.data, "sudo.x86_64 1.8.23-10.el7_9.1 (rhel-7-server-rpms)")
+		assert.Contains(t, mail.data, "RHSA-2021:0220 Important sudo-1.8.23-10.el7_9.1.x86_64")
+		assert.Contains(t, mail.data, "Reboot scheduled: true")
+		assert.False(t, mail.tls)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+}
+
+func TestSMTPNotifierStartTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(nil)
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	host, port, mails := startFakeSMTPServer(t, ts.TLS)
+	s, err := newSMTPNotifier(SMTPConfig{
+		host:      host,
+		port:      port,
+		from:      "yumsecupdater@example.com",
+		to:        []string{"ops@example.com"},
+		startTLS:  true,
+		tlsConfig: &tls.Config{RootCAs: pool, ServerName: "example.com"},
+	}, "node1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.sendMail("subject", "body"))
+	mail := <-mails
+	assert.True(t, mail.tls)
+	assert.Contains(t, mail.data, "body")
+}
+
+func TestSMTPNotifierStartTLSNotSupported(t *testing.T) {
+	host, port, _ := startFakeSMTPServer(t, nil)
+	s, err := newSMTPNotifier(SMTPConfig{
+		host:     host,
+		port:     port,
+		from:     "yumsecupdater@example.com",
+		to:       []string{"ops@example.com"},
+		startTLS: true,
+	}, "node1")
+	assert.NoError(t, err)
+	assert.Error(t, s.sendMail("subject", "body"))
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// a server accepting the connection without ever greeting
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	assert.NoError(t, err)
+	s, err := newSMTPNotifier(SMTPConfig{
+		host:    host,
+		port:    port,
+		from:    "yumsecupdater@example.com",
+		to:      []string{"ops@example.com"},
+		timeout: 100 * time.Millisecond,
+	}, "node1")
+	assert.NoError(t, err)
+
+	start := time.Now()
+	assert.Error(t, s.sendMail("subject", "body"))
+	assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
+
+func TestNewSMTPNotifierInvalid(t *testing.T) {
+	var tests = []SMTPConfig{
+		{},
+		{host: "localhost"},
+		{host: "localhost", from: "yumsecupdater@example.com"},
+	}
+	for _, tt := range tests {
+		_, err := newSMTPNotifier(tt, "node1")
+		assert.Error(t, err)
+	}
+}
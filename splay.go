@@ -0,0 +1,24 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// splayDuration returns a delay between 0 and max used to spread the
+// runs of all the nodes over time. When fromSeed is true, the delay is
+// derived from a hash of the seed so it stays the same across restarts.
+func splayDuration(max time.Duration, seed string, fromSeed bool) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	if fromSeed {
+		h := fnv.New64a()
+		h.Write([]byte(seed))
+		return time.Duration(h.Sum64() % uint64(max))
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
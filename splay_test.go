@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplayDuration(t *testing.T) {
+	assert.Equal(t, time.Duration(0), splayDuration(0, "node1", true))
+	assert.Equal(t, time.Duration(0), splayDuration(-time.Minute, "node1", false))
+
+	for i := 0; i < 100; i++ {
+		d := splayDuration(time.Minute, "node1", false)
+		assert.True(t, d >= 0 && d < time.Minute, d)
+	}
+
+	// the delay derived from the seed is stable
+	first := splayDuration(time.Hour, "node1", true)
+	assert.True(t, first >= 0 && first < time.Hour, first)
+	assert.Equal(t, first, splayDuration(time.Hour, "node1", true))
+	assert.NotEqual(t, first, splayDuration(time.Hour, "node2", true))
+}
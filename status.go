@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	statusPath  = "/api/v1/status"
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// Phases of the daemon.
+const (
+	phaseIdle          = "idle"
+	phaseChecking      = "checking"
+	phaseUpdating      = "updating"
+	phaseWaitingForYum = "waiting-for-yum"
+)
+
+// phaseOrder ranks the phases, the busiest phase of the run loops
+// is the phase of the daemon.
+var phaseOrder = map[string]int{
+	phaseIdle:          0,
+	phaseChecking:      1,
+	phaseWaitingForYum: 2,
+	phaseUpdating:      3,
+}
+
+// Status holds the state of the daemon exposed on the status endpoint.
+type Status struct {
+	mutex sync.RWMutex
+
+	Phase string `json:"phase"`
+	// Phases are the phases of the run loop of each advisory category.
+	Phases         map[string]string `json:"phases,omitempty"`
+	NextRun        time.Time         `json:"nextRun"`
+	NextMetricsRun time.Time         `json:"nextMetricsRun"`
+	Config         *StatusConfig     `json:"config,omitempty"`
+
+	ready bool
+	// heartbeats are the last times the run loop of each category was
+	// seen alive, a loop is stuck when no heartbeat happened during its
+	// stuckAfter.
+	heartbeats map[string]time.Time
+	stuckAfter map[string]time.Duration
+}
+
+// StatusConfig is the effective config of the daemon.
+type StatusConfig struct {
+	DryRun            bool     `json:"dryRun"`
+	UpdateMode        string   `json:"updateMode"`
+	Category          string   `json:"category"`
+	ExcludePackages   []string `json:"excludePackages"`
+	UpdatePackages    []string `json:"updatePackages"`
+	Severities        []string `json:"severities"`
+	Pins              []string `json:"pins,omitempty"`
+	PinMode           string   `json:"pinMode"`
+	CVEs              []string `json:"cves,omitempty"`
+	ExcludeCVEs       []string `json:"excludeCVEs,omitempty"`
+	Advisories        []string `json:"advisories,omitempty"`
+	ExcludeAdvisories []string `json:"excludeAdvisories,omitempty"`
+	RestartServices   []string `json:"restartServices"`
+	PreflightChecks   []string `json:"preflightChecks,omitempty"`
+	KeepKernels       int      `json:"keepKernels,omitempty"`
+	Interval          string   `json:"interval"`
+	IntervalSplay     string   `json:"intervalSplay"`
+	Splay             string   `json:"splay"`
+	MetricsInterval   string   `json:"metricsInterval"`
+	MetadataMaxAge    string   `json:"metadataMaxAge,omitempty"`
+
+	CategoryPolicies []CategoryPolicy `json:"categoryPolicies,omitempty"`
+}
+
+// statusResponse is the JSON document served on the status endpoint.
+type statusResponse struct {
+	*Status
+	LastResult *RunResult `json:"lastResult"`
+}
+
+// daemonStatus is the status shared by the run loops and the http server.
+var daemonStatus = &Status{Phase: phaseIdle}
+
+func (s *Status) setNextRun(t time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.NextRun = t
+}
+
+func (s *Status) setNextMetricsRun(t time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.NextMetricsRun = t
+}
+
+// setPhase sets the phase of the run loop of a category.
+func (s *Status) setPhase(loop, phase string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Phases == nil {
+		s.Phases = map[string]string{}
+	}
+	s.Phases[loop] = phase
+	s.updatePhase()
+}
+
+// updatePhase sets the phase of the daemon to the busiest phase of the loops.
+func (s *Status) updatePhase() {
+	s.Phase = phaseIdle
+	for _, phase := range s.Phases {
+		if phaseOrder[phase] > phaseOrder[s.Phase] {
+			s.Phase = phase
+		}
+	}
+}
+
+func (s *Status) setConfig(config StatusConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Config = &config
+}
+
+// setReady marks the initial check as completed.
+func (s *Status) setReady() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ready = true
+}
+
+// setStuckAfter sets the delay without heartbeat after which
+// the run loop of a category is considered stuck, never if 0.
+func (s *Status) setStuckAfter(loop string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stuckAfter == nil {
+		s.stuckAfter = map[string]time.Duration{}
+	}
+	s.stuckAfter[loop] = d
+}
+
+// beat records that the run loop of a category is alive.
+func (s *Status) beat(loop string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.heartbeats == nil {
+		s.heartbeats = map[string]time.Time{}
+	}
+	s.heartbeats[loop] = time.Now()
+}
+
+// healthy returns an error if a run loop is stuck.
+func (s *Status) healthy(now time.Time) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	loops := make([]string, 0, len(s.heartbeats))
+	for loop := range s.heartbeats {
+		loops = append(loops, loop)
+	}
+	sort.Strings(loops)
+	for _, loop := range loops {
+		heartbeat, stuckAfter := s.heartbeats[loop], s.stuckAfter[loop]
+		if stuckAfter == 0 || heartbeat.IsZero() {
+			continue
+		}
+		if since := now.Sub(heartbeat); since > stuckAfter {
+			return fmt.Errorf("run loop of the %s category stuck for %s", loop, since.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// ServeHTTP writes the status as JSON.
+func (s *Status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statusResponse{s, runHistory.last()}); err != nil {
+		log.Errorf("can not encode status: %v", err)
+	}
+}
+
+// healthzHandler reports if the run loop is alive.
+func (s *Status) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.healthy(time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler reports if the initial check is completed.
+func (s *Status) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	ready := s.ready
+	s.mutex.RUnlock()
+
+	if !ready {
+		http.Error(w, "initial check not completed", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHandler(t *testing.T) {
+	s := &Status{Phase: phaseIdle}
+	s.setConfig(StatusConfig{Interval: "24h0m0s"})
+	nextRun := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	s.setNextRun(nextRun)
+	s.setNextMetricsRun(nextRun.Add(time.Hour))
+
+	req, err := http.NewRequest("GET", statusPath, nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	result := struct {
+		Phase          string       `json:"phase"`
+		NextRun        time.Time    `json:"nextRun"`
+		NextMetricsRun time.Time    `json:"nextMetricsRun"`
+		Config         StatusConfig `json:"config"`
+		LastResult     *RunResult   `json:"lastResult"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, phaseIdle, result.Phase)
+	assert.Equal(t, nextRun, result.NextRun)
+	assert.Equal(t, nextRun.Add(time.Hour), result.NextMetricsRun)
+	assert.Equal(t, "24h0m0s", result.Config.Interval)
+	assert.Nil(t, result.LastResult)
+}
+
+func TestStatusLastResult(t *testing.T) {
+	history := runHistory
+	defer func() { runHistory = history }()
+	runHistory = newHistory(defaultHistorySize, defaultHistoryFile)
+	assert.NoError(t, runHistory.add(&RunResult{Updated: true}))
+
+	rr := httptest.NewRecorder()
+	(&Status{}).ServeHTTP(rr, httptest.NewRequest("GET", statusPath, nil))
+
+	result := struct {
+		LastResult *RunResult `json:"lastResult"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.True(t, result.LastResult.Updated)
+}
+
+func TestHealthz(t *testing.T) {
+	s := &Status{}
+	now := time.Now()
+
+	var tests = []struct {
+		stuckAfter time.Duration
+		heartbeat  time.Time
+		code       int
+	}{
+		{0, now.Add(-48 * time.Hour), http.StatusOK},
+		{time.Hour, time.Time{}, http.StatusOK},
+		{time.Hour, now.Add(-time.Minute), http.StatusOK},
+		{time.Hour, now.Add(-2 * time.Hour), http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		s.setStuckAfter(categorySecurity, test.stuckAfter)
+		s.beat(categorySecurity)
+		s.heartbeats[categorySecurity] = test.heartbeat
+
+		rr := httptest.NewRecorder()
+		s.healthzHandler(rr, httptest.NewRequest("GET", healthzPath, nil))
+		assert.Equal(t, test.code, rr.Code, "stuckAfter=%s heartbeat=%s", test.stuckAfter, test.heartbeat)
+	}
+
+	// a live loop does not hide a stuck one
+	s = &Status{}
+	s.setStuckAfter(categorySecurity, time.Hour)
+	s.setStuckAfter(categoryBugfix, 24*time.Hour)
+	s.beat(categorySecurity)
+	s.beat(categoryBugfix)
+	s.heartbeats[categoryBugfix] = now.Add(-48 * time.Hour)
+
+	rr := httptest.NewRecorder()
+	s.healthzHandler(rr, httptest.NewRequest("GET", healthzPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "run loop of the bugfix category stuck")
+}
+
+func TestStatusPhases(t *testing.T) {
+	s := &Status{Phase: phaseIdle}
+	s.setPhase(categorySecurity, phaseUpdating)
+	s.setPhase(categoryBugfix, phaseChecking)
+	assert.Equal(t, phaseUpdating, s.Phase)
+
+	// the end of a loop does not hide the update of another one
+	s.setPhase(categoryBugfix, phaseIdle)
+	assert.Equal(t, phaseUpdating, s.Phase)
+	s.setPhase(categorySecurity, phaseIdle)
+	assert.Equal(t, phaseIdle, s.Phase)
+}
+
+func TestReadyz(t *testing.T) {
+	s := &Status{}
+
+	rr := httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", readyzPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	s.setReady()
+	rr = httptest.NewRecorder()
+	s.readyzHandler(rr, httptest.NewRequest("GET", readyzPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestRunPhase(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	assert.NoError(t, run(Config{}, &RunResult{}))
+	assert.Equal(t, phaseIdle, daemonStatus.Phase)
+	assert.Equal(t, phaseIdle, daemonStatus.Phases[categorySecurity])
+
+	// the metrics check does not change the phase of the run loops
+	daemonStatus.setPhase(categorySecurity, phaseUpdating)
+	defer daemonStatus.setPhase(categorySecurity, phaseIdle)
+	m, err := newMetricsServer("localhost", "localhost", "9080")
+	assert.NoError(t, err)
+	m.fetchMetrics(Config{})
+	assert.Equal(t, phaseUpdating, daemonStatus.Phase)
+}
+
+func TestRunWaitingForYum(t *testing.T) {
+	testName = testRunUpdateAvailable
+	execCommand = helperCommand
+	defer func() { execCommand = exec.Command }()
+
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	varYumPID = filepath.Join(dir, "yum.pid")
+	yumRunningDelay = 10 * time.Millisecond
+	defer func() {
+		varYumPID = yumPID
+		yumRunningDelay = 10 * time.Second
+	}()
+
+	phase := func() string {
+		daemonStatus.mutex.RLock()
+		defer daemonStatus.mutex.RUnlock()
+		return daemonStatus.Phases[categorySecurity]
+	}
+	waitPhase := func(expected string) {
+		for i := 0; i < 100 && phase() != expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, expected, phase())
+	}
+
+	// another yum runs on the host
+	assert.NoError(t, ioutil.WriteFile(varYumPID, []byte("1"), 0644))
+	done := make(chan error)
+	go func() { done <- run(Config{dryRun: true}, &RunResult{}) }()
+	waitPhase(phaseWaitingForYum)
+	assert.NoError(t, os.Remove(varYumPID))
+	assert.NoError(t, <-done)
+	assert.Equal(t, phaseIdle, phase())
+
+	// another run loop runs a command
+	mutex.Lock()
+	go func() { done <- run(Config{dryRun: true}, &RunResult{}) }()
+	waitPhase(phaseWaitingForYum)
+	mutex.Unlock()
+	assert.NoError(t, <-done)
+	assert.Equal(t, phaseIdle, phase())
+}
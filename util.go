@@ -2,10 +2,24 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// advisoryIDPattern matches the advisory IDs of the Red Hat family
+// (RHSA-2021:0343), Amazon Linux (ALAS2-2021-1234) and Fedora
+// (FEDORA-2021-0a1b2c3d4e).
+const advisoryIDPattern = `[A-Z][A-Z0-9]*(?:-[A-Z0-9.]+)*-\d{4}(?::\d+(?:-\d+)?|-[\da-f]+)`
+
+var (
+	cveIDRegex      = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+	advisoryIDRegex = regexp.MustCompile(`^` + advisoryIDPattern + `$`)
+)
+
 // parseDurationString parses the cli values duration string.
 func parseDurationString(duration string) (time.Duration, error) {
 	var d time.Duration
@@ -42,3 +56,54 @@ func validateSeverity(s string) error {
 	}
 	return nil
 }
+
+// validateCVE checks if a CVE ID is valid, like CVE-2021-3156.
+func validateCVE(s string) error {
+	if !cveIDRegex.MatchString(s) {
+		return fmt.Errorf("invalid CVE: %s", s)
+	}
+	return nil
+}
+
+// validateAdvisory checks if an advisory ID is valid, like RHSA-2021:0343
+// or ALAS-2021-1234. CVE IDs have the same shape as the Amazon Linux
+// advisories but are rejected.
+func validateAdvisory(s string) error {
+	if !advisoryIDRegex.MatchString(s) || cveIDRegex.MatchString(s) {
+		return fmt.Errorf("invalid advisory: %s", s)
+	}
+	return nil
+}
+
+// containsString checks if a slice contains a string.
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFileAtomic writes data to a temporary file that is then renamed
+// to path, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,3 +68,81 @@ func TestValidateSeverity(t *testing.T) {
 	}
 
 }
+
+func TestValidateCVE(t *testing.T) {
+	var tests = []struct {
+		input   string
+		wantErr bool
+	}{
+		{"CVE-2021-3156", false},
+		{"CVE-2021-33909", false},
+		{"cve-2021-3156", true},
+		{"CVE-2021-315", true},
+		{"CVE-2021-3156,CVE-2021-3157", true},
+	}
+
+	for _, tt := range tests {
+		err := validateCVE(tt.input)
+		if tt.wantErr {
+			assert.Error(t, err, tt.input)
+		} else {
+			assert.NoError(t, err, tt.input)
+		}
+	}
+}
+
+func TestValidateAdvisory(t *testing.T) {
+	var tests = []struct {
+		input   string
+		wantErr bool
+	}{
+		{"RHSA-2021:0343", false},
+		{"RHEA-2021:1-2", false},
+		{"ALSA-2021:3798", false},
+		{"ALAS-2021-1234", false},
+		{"ALAS2-2021-1695", false},
+		{"ALASKERNEL-5.10-2022-001", false},
+		{"FEDORA-2021-abcdef", false},
+		{"FEDORA-EPEL-2021-6ac3a9e2b8", false},
+		{"RHSA-2021", true},
+		{"ALAS-2021", true},
+		{"FEDORA-2021-ABCDEF", true},
+		{"rhsa-2021:0343", true},
+		{"CVE-2021-3156", true},
+	}
+
+	for _, tt := range tests {
+		err := validateAdvisory(tt.input)
+		if tt.wantErr {
+			assert.Error(t, err, tt.input)
+		} else {
+			assert.NoError(t, err, tt.input)
+		}
+	}
+}
+
+func TestContainsString(t *testing.T) {
+	assert.True(t, containsString([]string{"Important", "Critical"}, "Critical"))
+	assert.False(t, containsString([]string{"Important"}, "Critical"))
+	assert.False(t, containsString(nil, "Critical"))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	assert.NoError(t, writeFileAtomic(path, []byte("first")))
+	assert.NoError(t, writeFileAtomic(path, []byte("second")))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	assert.Error(t, writeFileAtomic(filepath.Join(dir, "donotexist", "file"), []byte("data")))
+}
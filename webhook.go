@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/avast/retry-go/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookRetries uint          = 3
+	defaultWebhookDelay   time.Duration = 5 * time.Second
+	defaultWebhookTimeout time.Duration = 10 * time.Second
+	// defaultWebhookSendTimeout caps the time spent sending an event,
+	// the retries included.
+	defaultWebhookSendTimeout time.Duration = 30 * time.Second
+	// webhookQueueSize is the number of events waiting to be sent
+	// to a webhook, the next ones are dropped.
+	webhookQueueSize = 100
+
+	// defaultWebhookTemplate works with Slack, Teams and Mattermost.
+	defaultWebhookTemplate string = `{"text": {{ printf "[%s] %s: %s" .Node .Reason .Message | json }}}`
+)
+
+// defaultWebhookEvents are the events sent when a webhook does not define any.
+var defaultWebhookEvents = []string{
+	eventCriticalUpdatesPending,
+	eventUpdateFailed,
+	eventUpdateSkipped,
+	eventRebootRequired,
+}
+
+// WebhookConfig holds the configuration of a webhook.
+type WebhookConfig struct {
+	URL          string            `json:"url"`
+	Events       []string          `json:"events"`
+	Template     string            `json:"template"`
+	TemplateFile string            `json:"templateFile"`
+	Headers      map[string]string `json:"headers"`
+	Retries      uint              `json:"retries"`
+}
+
+// Webhook posts the lifecycle events to an http endpoint. The events are
+// sent in the background in their order, so an unreachable endpoint does
+// not hold the runs.
+type Webhook struct {
+	url         string
+	node        string
+	events      map[string]struct{}
+	template    *template.Template
+	headers     map[string]string
+	retries     uint
+	delay       time.Duration
+	sendTimeout time.Duration
+	client      *http.Client
+
+	queue   chan webhookDelivery
+	pending sync.WaitGroup
+}
+
+// webhookDelivery is a rendered event waiting to be sent.
+type webhookDelivery struct {
+	reason  string
+	payload []byte
+}
+
+// webhookPayload is the data passed to the webhook template, the packages
+// have exported fields to be used in the template.
+type webhookPayload struct {
+	Event
+	Node     string
+	Packages []packageWithUpdateJSON
+}
+
+// newWebhookPayload returns the data passed to the webhook template for an event.
+func newWebhookPayload(e Event, node string) webhookPayload {
+	packages := make([]packageWithUpdateJSON, 0, len(e.Packages))
+	for _, p := range e.Packages {
+		packages = append(packages, packageWithUpdateJSON{p.name, p.arch, p.version, p.repo})
+	}
+	return webhookPayload{Event: e, Node: node, Packages: packages}
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// loadWebhooksConfig reads the webhooks configuration from a JSON file.
+func loadWebhooksConfig(path string) ([]WebhookConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can not read webhooks config: %v", err)
+	}
+
+	configs := []WebhookConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("can not parse webhooks config: %v", err)
+	}
+
+	return configs, nil
+}
+
+// newWebhook returns a Webhook from its configuration.
+func newWebhook(config WebhookConfig, node string) (*Webhook, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook url is missing")
+	}
+
+	tmpl := config.Template
+	if config.TemplateFile != "" {
+		data, err := ioutil.ReadFile(config.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("can not read webhook template: %v", err)
+		}
+		tmpl = string(data)
+	}
+	if tmpl == "" {
+		tmpl = defaultWebhookTemplate
+	}
+
+	t, err := template.New(config.URL).Funcs(webhookTemplateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+
+	events := config.Events
+	if len(events) == 0 {
+		events = defaultWebhookEvents
+	}
+	eventsSet := map[string]struct{}{}
+	for _, e := range events {
+		if err := validateEventReason(e); err != nil {
+			return nil, err
+		}
+		eventsSet[e] = struct{}{}
+	}
+
+	retries := config.Retries
+	if retries == 0 {
+		retries = defaultWebhookRetries
+	}
+
+	w := &Webhook{
+		url:         config.URL,
+		node:        node,
+		events:      eventsSet,
+		template:    t,
+		headers:     config.Headers,
+		retries:     retries,
+		delay:       defaultWebhookDelay,
+		sendTimeout: defaultWebhookSendTimeout,
+		client:      &http.Client{Timeout: defaultWebhookTimeout},
+		queue:       make(chan webhookDelivery, webhookQueueSize),
+	}
+	go w.deliver()
+
+	return w, nil
+}
+
+// Send implements EventSink, the event is queued to be sent in the background.
+func (w *Webhook) Send(e Event) {
+	if _, ok := w.events[e.Reason]; !ok {
+		return
+	}
+
+	logger := log.WithField("component", "webhook").WithField("url", w.url)
+
+	body := bytes.Buffer{}
+	if err := w.template.Execute(&body, newWebhookPayload(e, w.node)); err != nil {
+		logger.Errorf("can not render %s payload: %v", e.Reason, err)
+		return
+	}
+
+	w.pending.Add(1)
+	select {
+	case w.queue <- webhookDelivery{reason: e.Reason, payload: body.Bytes()}:
+	default:
+		w.pending.Done()
+		logger.Errorf("can not send %s: too many events waiting to be sent", e.Reason)
+	}
+}
+
+// flush waits for the queued events to be sent.
+func (w *Webhook) flush() {
+	w.pending.Wait()
+}
+
+// deliver sends the queued events, each one with its retries for
+// sendTimeout at most.
+func (w *Webhook) deliver() {
+	logger := log.WithField("component", "webhook").WithField("url", w.url)
+
+	for d := range w.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), w.sendTimeout)
+		err := retry.Do(
+			func() error {
+				return w.post(ctx, d.payload)
+			},
+			retry.Context(ctx),
+			retry.Delay(w.delay),
+			retry.Attempts(w.retries),
+		)
+		cancel()
+		if err != nil {
+			logger.Errorf("can not send %s: %v", d.reason, err)
+		} else {
+			logger.Infof("%s sent", d.reason)
+		}
+		w.pending.Done()
+	}
+}
+
+// post sends the payload to the webhook url.
+func (w *Webhook) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
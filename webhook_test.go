@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWebhook(t *testing.T, config WebhookConfig) *Webhook {
+	w, err := newWebhook(config, "node1")
+	assert.NoError(t, err)
+	w.delay = time.Millisecond
+	return w
+}
+
+func TestWebhookSend(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	w := newTestWebhook(t, WebhookConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+	})
+
+	w.Send(Event{Reason: eventUpdateFailed, Message: `yum "update" failed`})
+	// not in the default events
+	w.Send(Event{Reason: eventUpdateStarted, Message: "started"})
+	w.flush()
+
+	assert.Equal(t, []string{
+		`{"text": "[node1] UpdateFailed: yum \"update\" failed"}`,
+	}, bodies)
+}
+
+func TestWebhookTemplateAndFilter(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	w := newTestWebhook(t, WebhookConfig{
+		URL:      server.URL,
+		Events:   []string{eventUpdateSucceeded},
+		Template: `{"node": {{ json .Node }}, "event": {{ json .Reason }}, "packages": {{ len .Packages }}}`,
+	})
+
+	w.Send(Event{Reason: eventUpdateFailed})
+	w.Send(Event{Reason: eventUpdateSucceeded, Packages: make([]packageWithUpdate, 2)})
+	w.flush()
+
+	assert.Equal(t, []string{
+		`{"node": "node1", "event": "UpdateSucceeded", "packages": 2}`,
+	}, bodies)
+
+	// the fields of the packages are exported to the template
+	bodies = nil
+	w = newTestWebhook(t, WebhookConfig{
+		URL:      server.URL,
+		Events:   []string{eventUpdateSucceeded},
+		Template: `{{range .Packages}}{{.Name}}-{{.Version}}.{{.Arch}} {{end}}{{ json .Packages }}`,
+	})
+	w.Send(Event{Reason: eventUpdateSucceeded, Packages: []packageWithUpdate{{name: "sudo", arch: "x86_64", version: "1.8.23-10.el7_9.1", repo: "rhel-7-server-rpms"}}})
+	w.flush()
+	assert.Equal(t, []string{
+		`sudo-1.8.23-10.el7_9.1.x86_64 [{"name":"sudo","arch":"x86_64","version":"1.8.23-10.el7_9.1","repo":"rhel-7-server-rpms"}]`,
+	}, bodies)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	w := newTestWebhook(t, WebhookConfig{URL: server.URL})
+	w.Send(Event{Reason: eventRebootRequired})
+	w.flush()
+	assert.Equal(t, 3, calls)
+
+	calls = -10
+	w.Send(Event{Reason: eventRebootRequired})
+	w.flush()
+	assert.Equal(t, -7, calls)
+}
+
+func TestWebhookUnreachable(t *testing.T) {
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-blocked:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(blocked)
+
+	w := newTestWebhook(t, WebhookConfig{URL: server.URL})
+	w.sendTimeout = 50 * time.Millisecond
+
+	// the events are sent in the background
+	start := time.Now()
+	w.Send(Event{Reason: eventRebootRequired})
+	w.Send(Event{Reason: eventUpdateFailed})
+	assert.Less(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	// and each one gives up after the send timeout
+	w.flush()
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestNewWebhookInvalid(t *testing.T) {
+	var tests = []WebhookConfig{
+		{},
+		{URL: "http://localhost", Events: []string{"Unknown"}},
+		{URL: "http://localhost", Template: "{{ .Node "},
+		{URL: "http://localhost", TemplateFile: "donotexist"},
+	}
+
+	for _, tt := range tests {
+		_, err := newWebhook(tt, "node1")
+		assert.Error(t, err)
+	}
+}
+
+func TestLoadWebhooksConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yumsecupdater")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "webhooks.json")
+	data := `[{"url": "http://localhost/hook", "events": ["UpdateFailed"], "retries": 5}]`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+
+	configs, err := loadWebhooksConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []WebhookConfig{{
+		URL:     "http://localhost/hook",
+		Events:  []string{eventUpdateFailed},
+		Retries: 5,
+	}}, configs)
+
+	_, err = loadWebhooksConfig(filepath.Join(dir, "donotexist"))
+	assert.Error(t, err)
+}